@@ -0,0 +1,67 @@
+// Command serve-fake-upstream runs the fake claude.ai API from package fakeupstream, for
+// trying the proxy offline. Start it, set upstream.baseURL to its address and use any
+// session keys:
+//
+//	go run ./cmd/serve-fake-upstream -addr 127.0.0.1:9090 -script sk-a=rate_limit,text
+package main
+
+import (
+	"claude2api/fakeupstream"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+)
+
+// scriptFlags collects repeated -script sessionKey=scenario,scenario flags.
+type scriptFlags map[string][]string
+
+func (f scriptFlags) String() string {
+	return fmt.Sprint(map[string][]string(f))
+}
+
+func (f scriptFlags) Set(value string) error {
+	sessionKey, raw, ok := strings.Cut(value, "=")
+	if !ok || strings.TrimSpace(sessionKey) == "" {
+		return fmt.Errorf("expected sessionKey=scenario,scenario, got %q", value)
+	}
+	script, err := fakeupstream.ParseScript(raw)
+	if err != nil {
+		return err
+	}
+	f[strings.TrimSpace(sessionKey)] = script
+	return nil
+}
+
+func main() {
+	scripts := scriptFlags{}
+	addr := flag.String("addr", "127.0.0.1:9090", "address to listen on")
+	scenario := flag.String("scenario", fakeupstream.ScenarioText, "scenario played when no script or prompt marker picks one")
+	orgID := flag.String("org", fakeupstream.DefaultOrgID, "organization UUID returned for every session")
+	chunkDelay := flag.Duration("chunk-delay", 50*time.Millisecond, "pause between SSE events")
+	retryAfter := flag.Duration("retry-after", fakeupstream.DefaultRetryAfter, "how far ahead rate limits reset")
+	flag.Var(scripts, "script", "per-session script as sessionKey=scenario,scenario (repeatable)")
+	flag.Parse()
+
+	defaults, err := fakeupstream.ParseScript(*scenario)
+	if err != nil || len(defaults) != 1 {
+		fmt.Fprintf(os.Stderr, "invalid -scenario %q, known: %s\n", *scenario, strings.Join(fakeupstream.Scenarios(), ", "))
+		os.Exit(2)
+	}
+
+	server := fakeupstream.New(fakeupstream.Options{
+		OrgID:           *orgID,
+		DefaultScenario: defaults[0],
+		Scripts:         scripts,
+		ChunkDelay:      *chunkDelay,
+		RetryAfter:      *retryAfter,
+	})
+	fmt.Printf("Fake claude.ai upstream listening on http://%s (scenarios: %s)\n", *addr, strings.Join(fakeupstream.Scenarios(), ", "))
+	fmt.Printf("Set upstream.baseURL to http://%s; call counters are at /fake/stats\n", *addr)
+	if err := http.ListenAndServe(*addr, server); err != nil {
+		fmt.Fprintf(os.Stderr, "fake upstream stopped: %v\n", err)
+		os.Exit(1)
+	}
+}
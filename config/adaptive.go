@@ -0,0 +1,121 @@
+package config
+
+import (
+	"math"
+	"strings"
+)
+
+const (
+	DefaultAdaptiveIncreaseAfter  = 20
+	DefaultAdaptiveDecreaseFactor = 0.5
+)
+
+// AdaptiveConcurrencyConfig turns the per-session concurrency limit into an AIMD
+// controller: the limit grows by one after IncreaseAfter consecutive successes and is
+// multiplied by DecreaseFactor after a rate limit or upstream error.
+type AdaptiveConcurrencyConfig struct {
+	Enabled        bool    `yaml:"enabled" json:"enabled"`
+	Min            int     `yaml:"min,omitempty" json:"min,omitempty"`
+	Max            int     `yaml:"max,omitempty" json:"max,omitempty"`
+	IncreaseAfter  int     `yaml:"increaseAfter,omitempty" json:"increase_after,omitempty"`
+	DecreaseFactor float64 `yaml:"decreaseFactor,omitempty" json:"decrease_factor,omitempty"`
+}
+
+// SessionAdaptiveLimit is the learned concurrency limit of one session.
+type SessionAdaptiveLimit struct {
+	Limit         int
+	SuccessStreak int
+}
+
+// NormalizeAdaptiveConcurrency fills defaults and keeps the bounds inside 1..10 with Min <= Max.
+func NormalizeAdaptiveConcurrency(settings AdaptiveConcurrencyConfig) AdaptiveConcurrencyConfig {
+	settings.Min = NormalizeMaxConcurrentPerKey(settings.Min)
+	if settings.Max <= 0 {
+		settings.Max = 10
+	}
+	settings.Max = NormalizeMaxConcurrentPerKey(settings.Max)
+	if settings.Max < settings.Min {
+		settings.Max = settings.Min
+	}
+	if settings.IncreaseAfter <= 0 {
+		settings.IncreaseAfter = DefaultAdaptiveIncreaseAfter
+	}
+	if settings.DecreaseFactor <= 0 || settings.DecreaseFactor >= 1 || math.IsNaN(settings.DecreaseFactor) {
+		settings.DecreaseFactor = DefaultAdaptiveDecreaseFactor
+	}
+	return settings
+}
+
+// sessionConcurrencyLimitLocked returns the per-session limit used for dispatch: the
+// learned limit when adaptive concurrency is on, otherwise MaxConcurrentPerKey.
+func (c *Config) sessionConcurrencyLimitLocked(sessionKey string) int {
+	maxPerKey := NormalizeMaxConcurrentPerKey(c.MaxConcurrentPerKey)
+	if !c.AdaptiveConcurrency.Enabled {
+		return maxPerKey
+	}
+	settings := NormalizeAdaptiveConcurrency(c.AdaptiveConcurrency)
+	limit := maxPerKey
+	if state, ok := c.SessionAdaptiveLimits[sessionKey]; ok {
+		limit = state.Limit
+	}
+	return clampInt(limit, settings.Min, settings.Max)
+}
+
+func (c *Config) increaseSessionConcurrencyLocked(sessionKey string) {
+	if !c.AdaptiveConcurrency.Enabled {
+		return
+	}
+	settings := NormalizeAdaptiveConcurrency(c.AdaptiveConcurrency)
+	state := SessionAdaptiveLimit{
+		Limit:         c.sessionConcurrencyLimitLocked(sessionKey),
+		SuccessStreak: c.SessionAdaptiveLimits[sessionKey].SuccessStreak + 1,
+	}
+	if state.SuccessStreak >= settings.IncreaseAfter {
+		state.SuccessStreak = 0
+		if state.Limit < settings.Max {
+			state.Limit++
+		}
+	}
+	c.SessionAdaptiveLimits[sessionKey] = state
+}
+
+func (c *Config) decreaseSessionConcurrencyLocked(sessionKey string) {
+	if !c.AdaptiveConcurrency.Enabled {
+		return
+	}
+	settings := NormalizeAdaptiveConcurrency(c.AdaptiveConcurrency)
+	limit := int(math.Floor(float64(c.sessionConcurrencyLimitLocked(sessionKey)) * settings.DecreaseFactor))
+	c.SessionAdaptiveLimits[sessionKey] = SessionAdaptiveLimit{
+		Limit: clampInt(limit, settings.Min, settings.Max),
+	}
+}
+
+// RecordSessionFailure cuts the session's adaptive limit after an upstream error.
+func (c *Config) RecordSessionFailure(sessionKey string) {
+	sessionKey = strings.TrimSpace(sessionKey)
+	if sessionKey == "" {
+		return
+	}
+
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+	c.decreaseSessionConcurrencyLocked(sessionKey)
+}
+
+// ResetSessionAdaptiveLimits forgets every learned limit, e.g. after the bounds change.
+func (c *Config) ResetSessionAdaptiveLimits() {
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.SessionAdaptiveLimits = make(map[string]SessionAdaptiveLimit)
+}
+
+func clampInt(value int, min int, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
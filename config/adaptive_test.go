@@ -0,0 +1,89 @@
+package config
+
+import (
+	"claude2api/logger"
+	"testing"
+	"time"
+)
+
+func TestNormalizeAdaptiveConcurrencyFillsDefaults(t *testing.T) {
+	settings := NormalizeAdaptiveConcurrency(AdaptiveConcurrencyConfig{Min: 4, Max: 2, DecreaseFactor: 1.5})
+	if settings.Min != 4 || settings.Max != 4 {
+		t.Fatalf("expected max raised to min, got %+v", settings)
+	}
+	if settings.IncreaseAfter != DefaultAdaptiveIncreaseAfter || settings.DecreaseFactor != DefaultAdaptiveDecreaseFactor {
+		t.Fatalf("expected defaults, got %+v", settings)
+	}
+}
+
+func TestAdaptiveConcurrencyIncreasesAndDecreases(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+		},
+		MaxConcurrentPerKey:  1,
+		MaxGlobalConcurrency: 10,
+		AdaptiveConcurrency:  AdaptiveConcurrencyConfig{Enabled: true, Min: 1, Max: 4, IncreaseAfter: 2, DecreaseFactor: 0.5},
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 5, 12, 0, 0, 0, time.Local)
+
+	limit := func() int {
+		_, maxPerKey, _, _, _ := cfg.GetSessionDispatchSnapshot(0, now)
+		return maxPerKey
+	}
+	if got := limit(); got != 1 {
+		t.Fatalf("expected initial limit from maxConcurrentPerKey, got %d", got)
+	}
+
+	for i := 0; i < 6; i++ {
+		cfg.RecordSessionSuccess("sk-a", now)
+	}
+	if got := limit(); got != 4 {
+		t.Fatalf("expected limit to grow to 4 after sustained success, got %d", got)
+	}
+	cfg.RecordSessionSuccess("sk-a", now)
+	cfg.RecordSessionSuccess("sk-a", now)
+	if got := limit(); got != 4 {
+		t.Fatalf("expected limit to stay at max 4, got %d", got)
+	}
+
+	first := cfg.AcquireSessionLease(0, nil, now)
+	second := cfg.AcquireSessionLease(0, nil, now)
+	if !first.OK || !second.OK {
+		t.Fatal("expected the learned limit to allow parallel leases")
+	}
+	first.Lease.Release()
+	second.Lease.Release()
+
+	cfg.RecordSessionRateLimit("sk-a", now)
+	if got := limit(); got != 2 {
+		t.Fatalf("expected rate limit to halve the limit, got %d", got)
+	}
+	cfg.RecordSessionFailure("sk-a")
+	cfg.RecordSessionFailure("sk-a")
+	if got := limit(); got != 1 {
+		t.Fatalf("expected errors to stop at the minimum, got %d", got)
+	}
+}
+
+func TestAdaptiveConcurrencyDisabledUsesStaticLimit(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+		},
+		MaxConcurrentPerKey:  3,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 5, 12, 0, 0, 0, time.Local)
+
+	cfg.RecordSessionRateLimit("sk-a", now)
+	if _, maxPerKey, _, _, _ := cfg.GetSessionDispatchSnapshot(0, now); maxPerKey != 3 {
+		t.Fatalf("expected static limit 3, got %d", maxPerKey)
+	}
+}
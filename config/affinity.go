@@ -0,0 +1,182 @@
+package config
+
+import (
+	"sort"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultSessionAffinityTTL = 30 * time.Minute
+	sessionAffinityPruneEvery = time.Minute
+)
+
+// SessionAffinityConfig pins repeated requests from the same end user to one session.
+type SessionAffinityConfig struct {
+	Enabled bool `yaml:"enabled" json:"enabled"`
+	// Header optionally names a request header that identifies the end user;
+	// when absent the OpenAI "user" field is used.
+	Header     string `yaml:"header,omitempty" json:"header,omitempty"`
+	TTLSeconds int    `yaml:"ttlSeconds,omitempty" json:"ttl_seconds,omitempty"`
+}
+
+// SessionAffinityEntry maps a hashed end-user identity to its preferred session.
+type SessionAffinityEntry struct {
+	SessionKey string
+	BoundAt    time.Time
+	LastSeenAt time.Time
+	ExpiresAt  time.Time
+	Hits       int64
+}
+
+// SessionAffinityStatus is a read-only view of one affinity entry.
+type SessionAffinityStatus struct {
+	AffinityKey  string    `json:"affinity_key"`
+	SessionIndex int       `json:"session_index"`
+	SessionKey   string    `json:"-"`
+	BoundAt      time.Time `json:"bound_at"`
+	LastSeenAt   time.Time `json:"last_seen_at"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	Hits         int64     `json:"hits"`
+}
+
+func NormalizeSessionAffinityTTL(seconds int) time.Duration {
+	if seconds <= 0 {
+		return DefaultSessionAffinityTTL
+	}
+	if seconds < 60 {
+		seconds = 60
+	}
+	if seconds > 86400 {
+		seconds = 86400
+	}
+	return time.Duration(seconds) * time.Second
+}
+
+// pickAffinityCandidateLocked returns the candidate position of the user's preferred
+// session, or -1 when there is no live mapping or that session cannot take the request.
+func (c *Config) pickAffinityCandidateLocked(affinityKey string, candidates []SessionCandidate, now time.Time) int {
+	if affinityKey == "" || !c.SessionAffinity.Enabled {
+		return -1
+	}
+	entry, ok := c.SessionAffinityEntries[affinityKey]
+	if !ok || !entry.ExpiresAt.After(now) {
+		return -1
+	}
+	for i, candidate := range candidates {
+		if candidate.SessionKey == entry.SessionKey {
+			return i
+		}
+	}
+	return -1
+}
+
+// bindSessionAffinityLocked records the session that served the user. An existing
+// mapping is kept when its session is only busy, so the user returns to it later;
+// it moves when that session is cooling down, quarantined or no longer configured.
+func (c *Config) bindSessionAffinityLocked(affinityKey string, sessionKey string, now time.Time) {
+	if affinityKey == "" || !c.SessionAffinity.Enabled {
+		return
+	}
+	c.pruneSessionAffinityLocked(now)
+
+	ttl := NormalizeSessionAffinityTTL(c.SessionAffinity.TTLSeconds)
+	entry, ok := c.SessionAffinityEntries[affinityKey]
+	if ok && entry.ExpiresAt.After(now) && entry.SessionKey != sessionKey && c.isAffinityTargetUsableLocked(entry.SessionKey, now) {
+		return
+	}
+	if !ok || !entry.ExpiresAt.After(now) || entry.SessionKey != sessionKey {
+		entry = SessionAffinityEntry{
+			SessionKey: sessionKey,
+			BoundAt:    now,
+		}
+	}
+	entry.LastSeenAt = now
+	entry.ExpiresAt = now.Add(ttl)
+	entry.Hits++
+	c.SessionAffinityEntries[affinityKey] = entry
+}
+
+func (c *Config) isAffinityTargetUsableLocked(sessionKey string, now time.Time) bool {
+	for index, session := range c.Sessions {
+		if strings.TrimSpace(session.SessionKey) != sessionKey {
+			continue
+		}
+		if c.isSessionQuarantinedLocked(sessionKey, now) {
+			return false
+		}
+		_, _, coolingDown := c.getSessionCooldownInfoLocked(index, now)
+		return !coolingDown
+	}
+	return false
+}
+
+func (c *Config) pruneSessionAffinityLocked(now time.Time) {
+	if now.Sub(c.affinityPrunedAt) < sessionAffinityPruneEvery {
+		return
+	}
+	c.affinityPrunedAt = now
+	for key, entry := range c.SessionAffinityEntries {
+		if !entry.ExpiresAt.After(now) {
+			delete(c.SessionAffinityEntries, key)
+		}
+	}
+}
+
+// GetSessionAffinitySnapshot lists live affinity entries, most recently used first.
+func (c *Config) GetSessionAffinitySnapshot(now time.Time) []SessionAffinityStatus {
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	c.RwMutx.RLock()
+	defer c.RwMutx.RUnlock()
+
+	indexByKey := make(map[string]int, len(c.Sessions))
+	for index, session := range c.Sessions {
+		indexByKey[strings.TrimSpace(session.SessionKey)] = index
+	}
+
+	result := make([]SessionAffinityStatus, 0, len(c.SessionAffinityEntries))
+	for affinityKey, entry := range c.SessionAffinityEntries {
+		if !entry.ExpiresAt.After(now) {
+			continue
+		}
+		index, ok := indexByKey[entry.SessionKey]
+		if !ok {
+			index = -1
+		}
+		result = append(result, SessionAffinityStatus{
+			AffinityKey:  affinityKey,
+			SessionIndex: index,
+			SessionKey:   entry.SessionKey,
+			BoundAt:      entry.BoundAt,
+			LastSeenAt:   entry.LastSeenAt,
+			ExpiresAt:    entry.ExpiresAt,
+			Hits:         entry.Hits,
+		})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].LastSeenAt.After(result[j].LastSeenAt)
+	})
+	return result
+}
+
+// ClearSessionAffinity removes one affinity entry, or all of them when affinityKey is empty.
+func (c *Config) ClearSessionAffinity(affinityKey string) int {
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+
+	affinityKey = strings.TrimSpace(affinityKey)
+	if affinityKey == "" {
+		count := len(c.SessionAffinityEntries)
+		c.SessionAffinityEntries = make(map[string]SessionAffinityEntry)
+		return count
+	}
+	if _, ok := c.SessionAffinityEntries[affinityKey]; !ok {
+		return 0
+	}
+	delete(c.SessionAffinityEntries, affinityKey)
+	return 1
+}
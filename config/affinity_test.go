@@ -0,0 +1,143 @@
+package config
+
+import (
+	"claude2api/logger"
+	"testing"
+	"time"
+)
+
+func TestSessionAffinityReturnsUserToSameSession(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+			{SessionKey: "sk-c"},
+		},
+		MaxConcurrentPerKey:  1,
+		MaxGlobalConcurrency: 10,
+		SessionAffinity:      SessionAffinityConfig{Enabled: true, TTLSeconds: 600},
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 2, 9, 0, 0, 0, time.Local)
+
+	first := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 1, Now: now, AffinityKey: "user-1"})
+	if !first.OK || first.AffinityHit {
+		t.Fatalf("expected first request to bind without a hit, got ok=%v hit=%v", first.OK, first.AffinityHit)
+	}
+	bound := first.Lease.Index
+	first.Lease.Release()
+
+	second := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: bound + 1, Now: now.Add(time.Minute), AffinityKey: "user-1"})
+	if !second.OK || !second.AffinityHit || second.Lease.Index != bound {
+		t.Fatalf("expected affinity hit on session %d, got ok=%v hit=%v index=%d", bound, second.OK, second.AffinityHit, second.Lease.Index)
+	}
+	second.Lease.Release()
+
+	entries := cfg.GetSessionAffinitySnapshot(now.Add(time.Minute))
+	if len(entries) != 1 || entries[0].SessionIndex != bound || entries[0].Hits != 2 {
+		t.Fatalf("unexpected affinity table: %+v", entries)
+	}
+}
+
+func TestSessionAffinityFallsBackWhenPreferredSessionIsBusy(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+			{SessionKey: "sk-c"},
+		},
+		MaxConcurrentPerKey:  1,
+		MaxGlobalConcurrency: 10,
+		SessionAffinity:      SessionAffinityConfig{Enabled: true, TTLSeconds: 600},
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 2, 9, 0, 0, 0, time.Local)
+
+	first := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now, AffinityKey: "user-1"})
+	if !first.OK || first.Lease.Index != 0 {
+		t.Fatalf("expected binding to session 0, got index=%d", first.Lease.Index)
+	}
+
+	busy := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now.Add(time.Second), AffinityKey: "user-1"})
+	if !busy.OK || busy.AffinityHit || busy.Lease.Index == 0 {
+		t.Fatalf("expected fallback away from busy session 0, got hit=%v index=%d", busy.AffinityHit, busy.Lease.Index)
+	}
+	busy.Lease.Release()
+	first.Lease.Release()
+
+	again := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 2, Now: now.Add(2 * time.Second), AffinityKey: "user-1"})
+	if !again.OK || !again.AffinityHit || again.Lease.Index != 0 {
+		t.Fatalf("expected busy fallback to keep affinity on session 0, got hit=%v index=%d", again.AffinityHit, again.Lease.Index)
+	}
+	again.Lease.Release()
+}
+
+func TestSessionAffinityMovesAwayFromCoolingSession(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+			{SessionKey: "sk-c"},
+		},
+		MaxConcurrentPerKey:  1,
+		MaxGlobalConcurrency: 10,
+		SessionAffinity:      SessionAffinityConfig{Enabled: true, TTLSeconds: 600},
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 2, 9, 0, 0, 0, time.Local)
+
+	first := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now, AffinityKey: "user-1"})
+	first.Lease.Release()
+	cfg.CooldownSessionUntil("sk-a", now.Add(time.Hour))
+
+	moved := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now.Add(time.Second), AffinityKey: "user-1"})
+	if !moved.OK || moved.AffinityHit || moved.Lease.Index == 0 {
+		t.Fatalf("expected cooling session to be skipped, got hit=%v index=%d", moved.AffinityHit, moved.Lease.Index)
+	}
+	moved.Lease.Release()
+
+	entries := cfg.GetSessionAffinitySnapshot(now.Add(time.Second))
+	if len(entries) != 1 || entries[0].SessionIndex != moved.Lease.Index {
+		t.Fatalf("expected affinity to move to session %d, got %+v", moved.Lease.Index, entries)
+	}
+}
+
+func TestSessionAffinityExpiresAfterTTL(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+			{SessionKey: "sk-c"},
+		},
+		MaxConcurrentPerKey:  1,
+		MaxGlobalConcurrency: 10,
+		SessionAffinity:      SessionAffinityConfig{Enabled: true, TTLSeconds: 600},
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 2, 9, 0, 0, 0, time.Local)
+
+	first := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now, AffinityKey: "user-1"})
+	first.Lease.Release()
+
+	later := now.Add(11 * time.Minute)
+	if entries := cfg.GetSessionAffinitySnapshot(later); len(entries) != 0 {
+		t.Fatalf("expected expired affinity to be hidden, got %+v", entries)
+	}
+	result := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 1, Now: later, AffinityKey: "user-1"})
+	if result.AffinityHit {
+		t.Fatal("expected expired affinity not to count as a hit")
+	}
+	result.Lease.Release()
+
+	if removed := cfg.ClearSessionAffinity(""); removed != 1 {
+		t.Fatalf("expected one rebound entry to be cleared, got %d", removed)
+	}
+}
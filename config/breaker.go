@@ -0,0 +1,178 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	BreakerStateClosed   = "closed"
+	BreakerStateOpen     = "open"
+	BreakerStateHalfOpen = "half_open"
+
+	DefaultBreakerFailureThreshold = 2
+	DefaultBreakerOpenSeconds      = 300
+	DefaultBreakerMaxOpenSeconds   = 3600
+)
+
+// CircuitBreakerConfig quarantines sessions whose credentials keep being rejected.
+// It is on by default; set disabled to turn it off.
+type CircuitBreakerConfig struct {
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled"`
+	// FailureThreshold is the number of consecutive auth failures that opens the breaker.
+	FailureThreshold int `yaml:"failureThreshold,omitempty" json:"failure_threshold,omitempty"`
+	// OpenSeconds is the first quarantine; every failed half-open probe doubles it up to MaxOpenSeconds.
+	OpenSeconds    int `yaml:"openSeconds,omitempty" json:"open_seconds,omitempty"`
+	MaxOpenSeconds int `yaml:"maxOpenSeconds,omitempty" json:"max_open_seconds,omitempty"`
+}
+
+// SessionBreaker is the circuit breaker state of one session.
+type SessionBreaker struct {
+	State               string        `json:"state"`
+	ConsecutiveFailures int           `json:"consecutive_failures"`
+	OpenedAt            time.Time     `json:"opened_at"`
+	OpenUntil           time.Time     `json:"open_until"`
+	OpenDuration        time.Duration `json:"-"`
+	LastError           string        `json:"last_error,omitempty"`
+	ProbeInFlight       bool          `json:"probe_in_flight"`
+}
+
+func NormalizeCircuitBreaker(settings CircuitBreakerConfig) CircuitBreakerConfig {
+	if settings.FailureThreshold <= 0 {
+		settings.FailureThreshold = DefaultBreakerFailureThreshold
+	}
+	if settings.FailureThreshold > 20 {
+		settings.FailureThreshold = 20
+	}
+	if settings.OpenSeconds <= 0 {
+		settings.OpenSeconds = DefaultBreakerOpenSeconds
+	}
+	if settings.OpenSeconds < 10 {
+		settings.OpenSeconds = 10
+	}
+	if settings.MaxOpenSeconds <= 0 {
+		settings.MaxOpenSeconds = DefaultBreakerMaxOpenSeconds
+	}
+	if settings.MaxOpenSeconds < settings.OpenSeconds {
+		settings.MaxOpenSeconds = settings.OpenSeconds
+	}
+	return settings
+}
+
+// RecordSessionAuthFailure counts a 401/403 for the session. It opens the breaker once the
+// threshold is reached, or straight away when a half-open probe fails, and returns the
+// quarantine end when the session is (still) quarantined.
+func (c *Config) RecordSessionAuthFailure(sessionKey string, message string, now time.Time) (time.Time, bool) {
+	sessionKey = strings.TrimSpace(sessionKey)
+	if sessionKey == "" || c.CircuitBreaker.Disabled {
+		return time.Time{}, false
+	}
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+
+	settings := NormalizeCircuitBreaker(c.CircuitBreaker)
+	breaker := c.sessionBreakerLocked(sessionKey, now)
+	breaker.ConsecutiveFailures++
+	breaker.LastError = message
+	breaker.ProbeInFlight = false
+
+	switch {
+	case breaker.State == BreakerStateHalfOpen:
+		breaker.OpenDuration *= 2
+	case breaker.State == BreakerStateClosed && breaker.ConsecutiveFailures >= settings.FailureThreshold:
+		breaker.OpenDuration = time.Duration(settings.OpenSeconds) * time.Second
+	default:
+		c.SessionBreakers[sessionKey] = breaker
+		return breaker.OpenUntil, breaker.State == BreakerStateOpen
+	}
+	if maxOpen := time.Duration(settings.MaxOpenSeconds) * time.Second; breaker.OpenDuration > maxOpen {
+		breaker.OpenDuration = maxOpen
+	}
+	breaker.State = BreakerStateOpen
+	breaker.OpenedAt = now
+	breaker.OpenUntil = now.Add(breaker.OpenDuration)
+	c.SessionBreakers[sessionKey] = breaker
+	return breaker.OpenUntil, true
+}
+
+// ResetSessionBreaker closes the session's breaker, e.g. after a successful request or test.
+func (c *Config) ResetSessionBreaker(sessionKey string) {
+	sessionKey = strings.TrimSpace(sessionKey)
+	if sessionKey == "" {
+		return
+	}
+
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+	delete(c.SessionBreakers, sessionKey)
+}
+
+// GetSessionBreakerByIndex returns the session's breaker state; closed sessions report ok=false.
+func (c *Config) GetSessionBreakerByIndex(idx int, now time.Time) (SessionBreaker, bool) {
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+
+	if idx < 0 || idx >= len(c.Sessions) {
+		return SessionBreaker{}, false
+	}
+	breaker := c.sessionBreakerLocked(strings.TrimSpace(c.Sessions[idx].SessionKey), now)
+	return breaker, breaker.State != BreakerStateClosed
+}
+
+// sessionBreakerLocked returns the breaker with an expired open period moved to half-open.
+func (c *Config) sessionBreakerLocked(sessionKey string, now time.Time) SessionBreaker {
+	breaker, ok := c.SessionBreakers[sessionKey]
+	if !ok {
+		return SessionBreaker{State: BreakerStateClosed}
+	}
+	if breaker.State == BreakerStateOpen && !breaker.OpenUntil.After(now) {
+		breaker.State = BreakerStateHalfOpen
+		c.SessionBreakers[sessionKey] = breaker
+	}
+	return breaker
+}
+
+// isSessionQuarantinedLocked reports whether dispatch must skip the session: its breaker
+// is open, or half-open with the single probe request already running.
+func (c *Config) isSessionQuarantinedLocked(sessionKey string, now time.Time) bool {
+	if c.CircuitBreaker.Disabled {
+		return false
+	}
+	breaker := c.sessionBreakerLocked(sessionKey, now)
+	switch breaker.State {
+	case BreakerStateOpen:
+		return true
+	case BreakerStateHalfOpen:
+		return breaker.ProbeInFlight
+	default:
+		return false
+	}
+}
+
+// markSessionProbeLocked records that a half-open session was handed out as the probe.
+func (c *Config) markSessionProbeLocked(sessionKey string) {
+	breaker, ok := c.SessionBreakers[sessionKey]
+	if ok && breaker.State == BreakerStateHalfOpen {
+		breaker.ProbeInFlight = true
+		c.SessionBreakers[sessionKey] = breaker
+	}
+}
+
+func (c *Config) clearSessionProbeLocked(sessionKey string) {
+	breaker, ok := c.SessionBreakers[sessionKey]
+	if ok && breaker.ProbeInFlight {
+		breaker.ProbeInFlight = false
+		c.SessionBreakers[sessionKey] = breaker
+	}
+}
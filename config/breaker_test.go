@@ -0,0 +1,110 @@
+package config
+
+import (
+	"claude2api/logger"
+	"testing"
+	"time"
+)
+
+func TestCircuitBreakerQuarantinesAfterConsecutiveAuthFailures(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 6, 9, 0, 0, 0, time.Local)
+
+	if _, quarantined := cfg.RecordSessionAuthFailure("sk-a", "401", now); quarantined {
+		t.Fatal("expected a single auth failure to stay below the threshold")
+	}
+	until, quarantined := cfg.RecordSessionAuthFailure("sk-a", "401", now)
+	if !quarantined || !until.Equal(now.Add(DefaultBreakerOpenSeconds*time.Second)) {
+		t.Fatalf("expected quarantine until %s, got %s quarantined=%v", now.Add(DefaultBreakerOpenSeconds*time.Second), until, quarantined)
+	}
+
+	if _, _, _, status, available := cfg.GetSessionDispatchSnapshot(0, now); status != "quarantined" || available {
+		t.Fatalf("expected quarantined dispatch status, got %s available=%v", status, available)
+	}
+	result := cfg.AcquireSessionLease(0, nil, now)
+	if !result.OK || result.Lease.Index != 1 || result.QuarantinedCount != 1 {
+		t.Fatalf("expected quarantined session to be skipped, got ok=%v index=%d quarantined=%d", result.OK, result.Lease.Index, result.QuarantinedCount)
+	}
+	result.Lease.Release()
+
+	only := cfg.AcquireSessionLease(0, map[int]bool{1: true}, now)
+	if only.OK || only.Reason != "all Claude sessions are quarantined after authentication failures" {
+		t.Fatalf("unexpected result with only quarantined sessions: ok=%v reason=%q", only.OK, only.Reason)
+	}
+}
+
+func TestCircuitBreakerHalfOpenAllowsSingleProbe(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		CircuitBreaker:       CircuitBreakerConfig{FailureThreshold: 1, OpenSeconds: 60, MaxOpenSeconds: 100},
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 6, 9, 0, 0, 0, time.Local)
+	cfg.RecordSessionAuthFailure("sk-a", "403", now)
+
+	later := now.Add(61 * time.Second)
+	probe := cfg.AcquireSessionLease(0, nil, later)
+	if !probe.OK {
+		t.Fatalf("expected half-open session to accept a probe, got %q", probe.Reason)
+	}
+	if second := cfg.AcquireSessionLease(0, nil, later); second.OK {
+		t.Fatal("expected only one probe while half-open")
+	}
+
+	until, quarantined := cfg.RecordSessionAuthFailure("sk-a", "403", later)
+	probe.Lease.Release()
+	if !quarantined || !until.Equal(later.Add(100*time.Second)) {
+		t.Fatalf("expected failed probe to reopen with doubled, capped duration, got %s", until)
+	}
+
+	recovered := later.Add(101 * time.Second)
+	probe = cfg.AcquireSessionLease(0, nil, recovered)
+	if !probe.OK {
+		t.Fatalf("expected second probe, got %q", probe.Reason)
+	}
+	probe.Lease.Release()
+	cfg.RecordSessionSuccess("sk-a", recovered)
+	if _, open := cfg.GetSessionBreakerByIndex(0, recovered); open {
+		t.Fatal("expected successful probe to close the breaker")
+	}
+}
+
+func TestCircuitBreakerDisabled(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		CircuitBreaker:       CircuitBreakerConfig{Disabled: true},
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 6, 9, 0, 0, 0, time.Local)
+
+	for i := 0; i < 5; i++ {
+		if _, quarantined := cfg.RecordSessionAuthFailure("sk-a", "401", now); quarantined {
+			t.Fatal("expected disabled breaker never to quarantine")
+		}
+	}
+	if result := cfg.AcquireSessionLease(0, nil, now); !result.OK {
+		t.Fatalf("expected session to stay dispatchable, got %q", result.Reason)
+	}
+}
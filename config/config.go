@@ -20,6 +20,7 @@ type SessionInfo struct {
 	OrgID        string `yaml:"orgID" json:"org_id"`
 	CFClearance  string `yaml:"cfClearance,omitempty" json:"cf_clearance,omitempty"`
 	CookieString string `yaml:"cookieString,omitempty" json:"cookie_string,omitempty"`
+	Weight       int    `yaml:"weight,omitempty" json:"weight,omitempty"`
 }
 
 type SessionRagen struct {
@@ -35,6 +36,18 @@ type SessionLease struct {
 	released   bool
 }
 
+type SessionAcquireRequest struct {
+	StartIndex int
+	Excluded   map[int]bool
+	Now        time.Time
+	// Strategy names the selection strategy; empty uses Config.SessionStrategy.
+	Strategy string
+	// Selector overrides Strategy when set.
+	Selector SessionSelector
+	// AffinityKey identifies the end user for sticky session affinity.
+	AffinityKey string
+}
+
 type SessionAcquireResult struct {
 	Lease            SessionLease
 	OK               bool
@@ -44,6 +57,9 @@ type SessionAcquireResult struct {
 	AvailableCount   int
 	BusyCount        int
 	CoolingCount     int
+	RestingCount     int
+	QuarantinedCount int
+	AffinityHit      bool
 }
 
 type ModelDefinition struct {
@@ -56,35 +72,65 @@ type ModelDefinition struct {
 	Visible              bool   `yaml:"visible" json:"visible"`
 	SystemPromptOverride string `yaml:"systemPromptOverride,omitempty" json:"system_prompt_override,omitempty"`
 	PromptOverrideMode   string `yaml:"promptOverrideMode,omitempty" json:"prompt_override_mode,omitempty"`
+	SessionStrategy      string `yaml:"sessionStrategy,omitempty" json:"session_strategy,omitempty"`
 	Notes                string `yaml:"notes,omitempty" json:"notes,omitempty"`
+	// Upstream overrides the global upstream settings for this model; unset fields inherit.
+	Upstream *UpstreamConfig `yaml:"upstream,omitempty" json:"upstream,omitempty"`
 }
 
 type Config struct {
-	Sessions                   []SessionInfo        `yaml:"sessions"`
-	Address                    string               `yaml:"address"`
-	APIKey                     string               `yaml:"apiKey"`
-	Proxy                      string               `yaml:"proxy"`
-	ChatDelete                 bool                 `yaml:"chatDelete"`
-	MaxChatHistoryLength       int                  `yaml:"maxChatHistoryLength"`
-	RetryCount                 int                  `yaml:"retryCount"`
-	InternalRetryCount         int                  `yaml:"internalRetryCount"`
-	MaxConcurrentPerKey        int                  `yaml:"maxConcurrentPerKey"`
-	MaxGlobalConcurrency       int                  `yaml:"maxGlobalConcurrency"`
-	NoRolePrefix               bool                 `yaml:"noRolePrefix"`
-	PromptDisableArtifacts     bool                 `yaml:"promptDisableArtifacts"`
-	EnableMirrorApi            bool                 `yaml:"enableMirrorApi"`
-	MirrorApiPrefix            string               `yaml:"mirrorApiPrefix"`
-	AdminPassword              string               `yaml:"adminPassword"`
-	GlobalSystemPromptOverride string               `yaml:"globalSystemPromptOverride"`
-	GlobalPromptOverrideMode   string               `yaml:"globalPromptOverrideMode"`
-	ModelDefinitions           []ModelDefinition    `yaml:"modelDefinitions"`
-	RequestLogRetention        int                  `yaml:"requestLogRetention"`
-	SessionCooldownUntil       map[string]time.Time `yaml:"-" json:"-"`
-	SessionCooldownSource      map[string]string    `yaml:"-" json:"-"`
-	SessionInFlight            map[string]int       `yaml:"-" json:"-"`
-	SessionLastUsedAt          map[string]time.Time `yaml:"-" json:"-"`
-	GlobalInFlight             int                  `yaml:"-" json:"-"`
-	RwMutx                     sync.RWMutex         `yaml:"-"` // 不从YAML加载
+	Sessions                   []SessionInfo                   `yaml:"sessions"`
+	Address                    string                          `yaml:"address"`
+	APIKey                     string                          `yaml:"apiKey"`
+	Proxy                      string                          `yaml:"proxy"`
+	ChatDelete                 bool                            `yaml:"chatDelete"`
+	MaxChatHistoryLength       int                             `yaml:"maxChatHistoryLength"`
+	RetryCount                 int                             `yaml:"retryCount"`
+	InternalRetryCount         int                             `yaml:"internalRetryCount"`
+	MaxConcurrentPerKey        int                             `yaml:"maxConcurrentPerKey"`
+	MaxGlobalConcurrency       int                             `yaml:"maxGlobalConcurrency"`
+	SessionStrategy            string                          `yaml:"sessionStrategy"`
+	SessionAffinity            SessionAffinityConfig           `yaml:"sessionAffinity"`
+	PredictiveRateLimit        PredictiveRateLimitConfig       `yaml:"predictiveRateLimit"`
+	AdaptiveConcurrency        AdaptiveConcurrencyConfig       `yaml:"adaptiveConcurrency"`
+	CircuitBreaker             CircuitBreakerConfig            `yaml:"circuitBreaker"`
+	HealthProbe                HealthProbeConfig               `yaml:"healthProbe"`
+	Notifications              NotificationConfig              `yaml:"notifications"`
+	RuntimeState               RuntimeStateConfig              `yaml:"runtimeState"`
+	Metrics                    MetricsConfig                   `yaml:"metrics"`
+	Tracing                    TracingConfig                   `yaml:"tracing"`
+	Heartbeat                  HeartbeatConfig                 `yaml:"heartbeat"`
+	Upstream                   UpstreamConfig                  `yaml:"upstream"`
+	Transcripts                TranscriptConfig                `yaml:"transcripts"`
+	NoRolePrefix               bool                            `yaml:"noRolePrefix"`
+	DiagnosticHeaders          bool                            `yaml:"diagnosticHeaders"`
+	PromptDisableArtifacts     bool                            `yaml:"promptDisableArtifacts"`
+	EnableMirrorApi            bool                            `yaml:"enableMirrorApi"`
+	MirrorApiPrefix            string                          `yaml:"mirrorApiPrefix"`
+	AdminPassword              string                          `yaml:"adminPassword"`
+	GlobalSystemPromptOverride string                          `yaml:"globalSystemPromptOverride"`
+	GlobalPromptOverrideMode   string                          `yaml:"globalPromptOverrideMode"`
+	ModelDefinitions           []ModelDefinition               `yaml:"modelDefinitions"`
+	RequestLogRetention        int                             `yaml:"requestLogRetention"`
+	RequestLogStorage          RequestLogStorageConfig         `yaml:"requestLogStorage"`
+	Logging                    LoggingConfig                   `yaml:"logging"`
+	SessionCooldownUntil       map[string]time.Time            `yaml:"-" json:"-"`
+	SessionCooldownSource      map[string]string               `yaml:"-" json:"-"`
+	SessionInFlight            map[string]int                  `yaml:"-" json:"-"`
+	SessionLastUsedAt          map[string]time.Time            `yaml:"-" json:"-"`
+	GlobalInFlight             int                             `yaml:"-" json:"-"`
+	SessionAffinityEntries     map[string]SessionAffinityEntry `yaml:"-" json:"-"`
+	SessionRecentSuccesses     map[string][]time.Time          `yaml:"-" json:"-"`
+	SessionQuotas              map[string]SessionQuota         `yaml:"-" json:"-"`
+	SessionAdaptiveLimits      map[string]SessionAdaptiveLimit `yaml:"-" json:"-"`
+	SessionBreakers            map[string]SessionBreaker       `yaml:"-" json:"-"`
+	SessionHealthStates        map[string]SessionHealth        `yaml:"-" json:"-"`
+	RwMutx                     sync.RWMutex                    `yaml:"-"` // 不从YAML加载
+
+	// SessionStatsSource feeds per-session history to selection strategies;
+	// nil uses logger.GlobalRequestLogger.
+	SessionStatsSource func() map[int]logger.SessionStats `yaml:"-" json:"-"`
+	affinityPrunedAt   time.Time
 }
 
 const (
@@ -138,17 +184,7 @@ func NormalizeMaxGlobalConcurrency(value int) int {
 }
 
 func MaskSecret(value string) string {
-	value = strings.TrimSpace(value)
-	if value == "" {
-		return ""
-	}
-	if len(value) <= 8 {
-		return "****"
-	}
-	if len(value) <= 20 {
-		return value[:4] + "..." + value[len(value)-4:]
-	}
-	return value[:10] + "..." + value[len(value)-5:]
+	return logger.MaskSecret(value)
 }
 
 // 解析 SESSION 格式的环境变量
@@ -212,15 +248,48 @@ func (c *Config) ensureRuntimeStateLocked() {
 	if c.SessionLastUsedAt == nil {
 		c.SessionLastUsedAt = make(map[string]time.Time)
 	}
+	if c.SessionAffinityEntries == nil {
+		c.SessionAffinityEntries = make(map[string]SessionAffinityEntry)
+	}
+	if c.SessionRecentSuccesses == nil {
+		c.SessionRecentSuccesses = make(map[string][]time.Time)
+	}
+	if c.SessionQuotas == nil {
+		c.SessionQuotas = make(map[string]SessionQuota)
+	}
+	if c.SessionAdaptiveLimits == nil {
+		c.SessionAdaptiveLimits = make(map[string]SessionAdaptiveLimit)
+	}
+	if c.SessionBreakers == nil {
+		c.SessionBreakers = make(map[string]SessionBreaker)
+	}
+	if c.SessionHealthStates == nil {
+		c.SessionHealthStates = make(map[string]SessionHealth)
+	}
 	if c.GlobalInFlight < 0 {
 		c.GlobalInFlight = 0
 	}
 }
 
 func (c *Config) AcquireSessionLease(startIndex int, excluded map[int]bool, now time.Time) SessionAcquireResult {
+	return c.AcquireSessionLeaseWith(SessionAcquireRequest{
+		StartIndex: startIndex,
+		Excluded:   excluded,
+		Now:        now,
+	})
+}
+
+// AcquireSessionLeaseWith filters out cooling and saturated sessions, then lets the
+// requested selection strategy pick one of the remaining candidates.
+func (c *Config) AcquireSessionLeaseWith(request SessionAcquireRequest) SessionAcquireResult {
+	now := request.Now
 	if now.IsZero() {
 		now = time.Now()
 	}
+	startIndex := request.StartIndex
+	excluded := request.Excluded
+
+	stats := c.sessionStatsSnapshot()
 
 	c.RwMutx.Lock()
 	defer c.RwMutx.Unlock()
@@ -235,8 +304,16 @@ func (c *Config) AcquireSessionLease(startIndex int, excluded map[int]bool, now
 	}
 	startIndex %= sessionCount
 
+	selector := request.Selector
+	if selector == nil {
+		strategy := request.Strategy
+		if strings.TrimSpace(strategy) == "" {
+			strategy = c.SessionStrategy
+		}
+		selector = GetSessionSelector(strategy)
+	}
+
 	maxGlobal := NormalizeMaxGlobalConcurrency(c.MaxGlobalConcurrency)
-	maxPerKey := NormalizeMaxConcurrentPerKey(c.MaxConcurrentPerKey)
 	if c.GlobalInFlight >= maxGlobal {
 		return SessionAcquireResult{
 			Reason:       "all Claude sessions are busy; global concurrency limit reached",
@@ -245,13 +322,10 @@ func (c *Config) AcquireSessionLease(startIndex int, excluded map[int]bool, now
 		}
 	}
 
-	bestIndex := -1
-	bestInFlight := 0
-	bestDistance := sessionCount + 1
-	bestLastUsed := time.Time{}
-	availableCount := 0
+	candidates := make([]SessionCandidate, 0, sessionCount)
 	busyCount := 0
 	coolingCount := 0
+	quarantinedCount := 0
 	earliestCooldown := time.Time{}
 	earliestSource := ""
 
@@ -267,6 +341,11 @@ func (c *Config) AcquireSessionLease(startIndex int, excluded map[int]bool, now
 			continue
 		}
 
+		if c.isSessionQuarantinedLocked(sessionKey, now) {
+			quarantinedCount++
+			continue
+		}
+
 		if cooldownUntil, source, coolingDown := c.getSessionCooldownInfoLocked(index, now); coolingDown {
 			coolingCount++
 			if earliestCooldown.IsZero() || cooldownUntil.Before(earliestCooldown) {
@@ -277,27 +356,31 @@ func (c *Config) AcquireSessionLease(startIndex int, excluded map[int]bool, now
 		}
 
 		inFlight := c.SessionInFlight[sessionKey]
-		if inFlight >= maxPerKey {
+		if inFlight >= c.sessionConcurrencyLimitLocked(sessionKey) {
 			busyCount++
 			continue
 		}
 
-		availableCount++
-		lastUsed := c.SessionLastUsedAt[sessionKey]
-		if bestIndex < 0 ||
-			inFlight < bestInFlight ||
-			(inFlight == bestInFlight && lastUsed.Before(bestLastUsed)) ||
-			(inFlight == bestInFlight && lastUsed.Equal(bestLastUsed) && offset < bestDistance) {
-			bestIndex = index
-			bestInFlight = inFlight
-			bestDistance = offset
-			bestLastUsed = lastUsed
-		}
+		candidates = append(candidates, SessionCandidate{
+			Index:      index,
+			SessionKey: sessionKey,
+			InFlight:   inFlight,
+			LastUsedAt: c.SessionLastUsedAt[sessionKey],
+			Distance:   offset,
+			Weight:     NormalizeSessionWeight(session.Weight),
+			Stats:      stats[index],
+		})
 	}
+	candidates, restingCount := c.applyPredictiveRateLimitLocked(candidates, now)
+	availableCount := len(candidates)
 
-	if bestIndex < 0 {
+	if availableCount == 0 {
 		reason := "no available Claude sessions"
-		if coolingCount > 0 && busyCount == 0 {
+		if quarantinedCount > 0 && busyCount == 0 && coolingCount == 0 && restingCount == 0 {
+			reason = "all Claude sessions are quarantined after authentication failures"
+		} else if restingCount > 0 && busyCount == 0 && coolingCount == 0 {
+			reason = "all available Claude sessions are resting near their learned rate limit budget"
+		} else if coolingCount > 0 && busyCount == 0 {
 			reason = "all Claude sessions are cooling down after rate limits"
 		} else if busyCount > 0 && coolingCount == 0 {
 			reason = "all Claude sessions are busy"
@@ -311,14 +394,30 @@ func (c *Config) AcquireSessionLease(startIndex int, excluded map[int]bool, now
 			AvailableCount:   availableCount,
 			BusyCount:        busyCount,
 			CoolingCount:     coolingCount,
+			RestingCount:     restingCount,
+			QuarantinedCount: quarantinedCount,
+		}
+	}
+
+	affinityHit := false
+	picked := c.pickAffinityCandidateLocked(request.AffinityKey, candidates, now)
+	if picked >= 0 {
+		affinityHit = true
+	} else {
+		picked = selector.Select(candidates)
+		if picked < 0 || picked >= availableCount {
+			picked = selectLeastLoaded(candidates)
 		}
 	}
+	bestIndex := candidates[picked].Index
 
 	session := c.Sessions[bestIndex]
 	sessionKey := strings.TrimSpace(session.SessionKey)
 	c.SessionInFlight[sessionKey]++
 	c.GlobalInFlight++
 	c.SessionLastUsedAt[sessionKey] = now
+	c.markSessionProbeLocked(sessionKey)
+	c.bindSessionAffinityLocked(request.AffinityKey, sessionKey, now)
 
 	return SessionAcquireResult{
 		OK: true,
@@ -328,10 +427,23 @@ func (c *Config) AcquireSessionLease(startIndex int, excluded map[int]bool, now
 			SessionKey: sessionKey,
 			config:     c,
 		},
-		AvailableCount: availableCount,
-		BusyCount:      busyCount,
-		CoolingCount:   coolingCount,
+		AvailableCount:   availableCount,
+		BusyCount:        busyCount,
+		CoolingCount:     coolingCount,
+		RestingCount:     restingCount,
+		QuarantinedCount: quarantinedCount,
+		AffinityHit:      affinityHit,
+	}
+}
+
+func (c *Config) sessionStatsSnapshot() map[int]logger.SessionStats {
+	if c.SessionStatsSource != nil {
+		return c.SessionStatsSource()
 	}
+	if logger.GlobalRequestLogger == nil {
+		return nil
+	}
+	return logger.GlobalRequestLogger.GetStatsBySession()
 }
 
 func (l *SessionLease) Release() {
@@ -356,8 +468,11 @@ func (c *Config) releaseSessionLease(sessionKey string) {
 	if c.GlobalInFlight > 0 {
 		c.GlobalInFlight--
 	}
+	c.clearSessionProbeLocked(sessionKey)
 }
 
+// GetSessionDispatchSnapshot returns in-flight count, effective per-session limit, global
+// limit, dispatch status and availability for one session.
 func (c *Config) GetSessionDispatchSnapshot(idx int, now time.Time) (int, int, int, string, bool) {
 	if now.IsZero() {
 		now = time.Now()
@@ -372,11 +487,14 @@ func (c *Config) GetSessionDispatchSnapshot(idx int, now time.Time) (int, int, i
 	}
 	sessionKey := strings.TrimSpace(c.Sessions[idx].SessionKey)
 	inFlight := c.SessionInFlight[sessionKey]
-	maxPerKey := NormalizeMaxConcurrentPerKey(c.MaxConcurrentPerKey)
+	maxPerKey := c.sessionConcurrencyLimitLocked(sessionKey)
 	maxGlobal := NormalizeMaxGlobalConcurrency(c.MaxGlobalConcurrency)
 	status := "ready"
 	available := true
-	if _, _, coolingDown := c.getSessionCooldownInfoLocked(idx, now); coolingDown {
+	if c.isSessionQuarantinedLocked(sessionKey, now) {
+		status = "quarantined"
+		available = false
+	} else if _, _, coolingDown := c.getSessionCooldownInfoLocked(idx, now); coolingDown {
 		status = "cooling"
 		available = false
 	} else if c.GlobalInFlight >= maxGlobal {
@@ -508,12 +626,14 @@ func (c *Config) getSessionCooldownInfoLocked(idx int, now time.Time) (time.Time
 	return cooldownUntil, source, true
 }
 
-func (c *Config) SetSessionOrgID(sessionKey, orgID string) {
+// SetSessionOrgID stores the org ID of a session, logging through log so the line carries
+// the fields of the request that looked it up.
+func (c *Config) SetSessionOrgID(sessionKey, orgID string, log *logger.Entry) {
 	c.RwMutx.Lock()
 	defer c.RwMutx.Unlock()
 	for i, session := range c.Sessions {
 		if session.SessionKey == sessionKey {
-			logger.Info(fmt.Sprintf("Setting OrgID for session %s to %s", MaskSecret(sessionKey), MaskSecret(orgID)))
+			log.Info(fmt.Sprintf("Setting OrgID for session %s to %s", MaskSecret(sessionKey), MaskSecret(orgID)))
 			c.Sessions[i].OrgID = orgID
 			return
 		}
@@ -577,9 +697,23 @@ func loadConfigFromYAML(configPath string) (*Config, error) {
 		config.AdminPassword = "claude2apidev"
 	}
 	config.RequestLogRetention = NormalizeRequestLogRetention(config.RequestLogRetention)
+	config.RequestLogStorage = NormalizeRequestLogStorage(config.RequestLogStorage)
+	config.Logging = NormalizeLogging(config.Logging)
 	config.InternalRetryCount = NormalizeInternalRetryCount(config.InternalRetryCount)
 	config.MaxConcurrentPerKey = NormalizeMaxConcurrentPerKey(config.MaxConcurrentPerKey)
 	config.MaxGlobalConcurrency = NormalizeMaxGlobalConcurrency(config.MaxGlobalConcurrency)
+	config.SessionStrategy = NormalizeSessionStrategy(config.SessionStrategy)
+	config.PredictiveRateLimit.Mode = NormalizePredictiveMode(config.PredictiveRateLimit.Mode)
+	config.AdaptiveConcurrency = NormalizeAdaptiveConcurrency(config.AdaptiveConcurrency)
+	config.CircuitBreaker = NormalizeCircuitBreaker(config.CircuitBreaker)
+	config.HealthProbe = NormalizeHealthProbe(config.HealthProbe)
+	config.Notifications = NormalizeNotification(config.Notifications)
+	config.RuntimeState = NormalizeRuntimeState(config.RuntimeState)
+	config.Metrics = NormalizeMetrics(config.Metrics)
+	config.Tracing = NormalizeTracing(config.Tracing)
+	config.Heartbeat = NormalizeHeartbeat(config.Heartbeat)
+	config.Upstream = NormalizeUpstream(config.Upstream)
+	config.Transcripts = NormalizeTranscripts(config.Transcripts)
 
 	return &config, nil
 }
@@ -606,6 +740,62 @@ func loadConfigFromEnv() *Config {
 	if err != nil {
 		maxGlobalConcurrency = DefaultMaxGlobalConcurrency
 	}
+	affinityTTL, err := strconv.Atoi(os.Getenv("SESSION_AFFINITY_TTL"))
+	if err != nil {
+		affinityTTL = 0
+	}
+	predictiveWindow, err := strconv.Atoi(os.Getenv("PREDICTIVE_RATE_LIMIT_WINDOW"))
+	if err != nil {
+		predictiveWindow = 0
+	}
+	adaptiveMin, err := strconv.Atoi(os.Getenv("ADAPTIVE_CONCURRENCY_MIN"))
+	if err != nil {
+		adaptiveMin = 0
+	}
+	adaptiveMax, err := strconv.Atoi(os.Getenv("ADAPTIVE_CONCURRENCY_MAX"))
+	if err != nil {
+		adaptiveMax = 0
+	}
+	probeInterval, err := strconv.Atoi(os.Getenv("HEALTH_PROBE_INTERVAL"))
+	if err != nil {
+		probeInterval = 0
+	}
+	logMaxSize, err := strconv.Atoi(os.Getenv("REQUEST_LOG_MAX_SIZE_MB"))
+	if err != nil {
+		logMaxSize = 0
+	}
+	logMaxAge, err := strconv.Atoi(os.Getenv("REQUEST_LOG_MAX_AGE_DAYS"))
+	if err != nil {
+		logMaxAge = 0
+	}
+	serverLogMaxSize, err := strconv.Atoi(os.Getenv("LOG_MAX_SIZE_MB"))
+	if err != nil {
+		serverLogMaxSize = 0
+	}
+	serverLogBackups, err := strconv.Atoi(os.Getenv("LOG_MAX_BACKUPS"))
+	if err != nil {
+		serverLogBackups = 0
+	}
+	stateSaveInterval, err := strconv.Atoi(os.Getenv("RUNTIME_STATE_SAVE_INTERVAL"))
+	if err != nil {
+		stateSaveInterval = 0
+	}
+	heartbeatInterval, err := strconv.Atoi(os.Getenv("HEARTBEAT_INTERVAL_SECONDS"))
+	if err != nil {
+		heartbeatInterval = 0
+	}
+	upstreamTimeout, err := strconv.Atoi(os.Getenv("UPSTREAM_TIMEOUT_SECONDS"))
+	if err != nil {
+		upstreamTimeout = 0
+	}
+	upstreamHeaderTimeout, err := strconv.Atoi(os.Getenv("UPSTREAM_RESPONSE_HEADER_TIMEOUT_SECONDS"))
+	if err != nil {
+		upstreamHeaderTimeout = 0
+	}
+	predictiveThreshold, err := strconv.ParseFloat(os.Getenv("PREDICTIVE_RATE_LIMIT_THRESHOLD"), 64)
+	if err != nil {
+		predictiveThreshold = 0
+	}
 	retryCount, sessions := parseSessionEnv(os.Getenv("SESSIONS"))
 	adminPassword := os.Getenv("ADMIN_PASSWORD")
 	if adminPassword == "" {
@@ -633,8 +823,79 @@ func loadConfigFromEnv() *Config {
 		MaxConcurrentPerKey: NormalizeMaxConcurrentPerKey(maxConcurrentPerKey),
 		// 设置全局最大并发
 		MaxGlobalConcurrency: NormalizeMaxGlobalConcurrency(maxGlobalConcurrency),
+		// 设置 Session 选择策略
+		SessionStrategy: NormalizeSessionStrategy(os.Getenv("SESSION_STRATEGY")),
+		// 设置用户粘性 Session
+		SessionAffinity: SessionAffinityConfig{
+			Enabled:    os.Getenv("SESSION_AFFINITY") == "true",
+			Header:     os.Getenv("SESSION_AFFINITY_HEADER"),
+			TTLSeconds: affinityTTL,
+		},
+		// 设置预测性限流规避
+		PredictiveRateLimit: PredictiveRateLimitConfig{
+			Enabled:       os.Getenv("PREDICTIVE_RATE_LIMIT") == "true",
+			WindowMinutes: predictiveWindow,
+			Threshold:     predictiveThreshold,
+			Mode:          NormalizePredictiveMode(os.Getenv("PREDICTIVE_RATE_LIMIT_MODE")),
+		},
+		// 设置自适应并发
+		AdaptiveConcurrency: NormalizeAdaptiveConcurrency(AdaptiveConcurrencyConfig{
+			Enabled: os.Getenv("ADAPTIVE_CONCURRENCY") == "true",
+			Min:     adaptiveMin,
+			Max:     adaptiveMax,
+		}),
+		// 设置认证失败熔断
+		CircuitBreaker: NormalizeCircuitBreaker(CircuitBreakerConfig{
+			Disabled: os.Getenv("CIRCUIT_BREAKER_DISABLED") == "true",
+		}),
+		// 设置后台健康探测
+		HealthProbe: NormalizeHealthProbe(HealthProbeConfig{
+			Enabled:         os.Getenv("HEALTH_PROBE") == "true",
+			IntervalSeconds: probeInterval,
+			Mode:            os.Getenv("HEALTH_PROBE_MODE"),
+			Model:           os.Getenv("HEALTH_PROBE_MODEL"),
+		}),
+		// 设置 Webhook 通知
+		Notifications: parseNotificationEnv(),
+		// 设置 Prometheus 指标
+		Metrics: NormalizeMetrics(MetricsConfig{
+			Enabled: os.Getenv("METRICS_ENABLED") == "true",
+			Token:   os.Getenv("METRICS_TOKEN"),
+		}),
+		// 设置请求链路追踪
+		Tracing: NormalizeTracing(TracingConfig{
+			Enabled:  os.Getenv("TRACING_ENABLED") == "true",
+			Exporter: os.Getenv("TRACING_EXPORTER"),
+			FilePath: os.Getenv("TRACING_FILE"),
+			Endpoint: os.Getenv("TRACING_ENDPOINT"),
+		}),
+		// 设置长思考期间的保活心跳
+		Heartbeat: NormalizeHeartbeat(HeartbeatConfig{
+			Enabled:         os.Getenv("HEARTBEAT_ENABLED") == "true",
+			IntervalSeconds: heartbeatInterval,
+			NonStream:       os.Getenv("HEARTBEAT_NON_STREAM") == "true",
+		}),
+		// 设置上游地址和超时
+		Upstream: NormalizeUpstream(UpstreamConfig{
+			BaseURL:                      os.Getenv("UPSTREAM_BASE_URL"),
+			TimeoutSeconds:               upstreamTimeout,
+			ResponseHeaderTimeoutSeconds: upstreamHeaderTimeout,
+		}),
+		// 设置上游流录制
+		Transcripts: NormalizeTranscripts(TranscriptConfig{
+			Enabled: os.Getenv("TRANSCRIPTS_ENABLED") == "true",
+			Dir:     os.Getenv("TRANSCRIPTS_DIR"),
+		}),
+		// 设置运行时状态持久化
+		RuntimeState: NormalizeRuntimeState(RuntimeStateConfig{
+			Disabled:            os.Getenv("RUNTIME_STATE_DISABLED") == "true",
+			Path:                os.Getenv("RUNTIME_STATE_PATH"),
+			SaveIntervalSeconds: stateSaveInterval,
+		}),
 		// 设置是否使用角色前缀
 		NoRolePrefix: os.Getenv("NO_ROLE_PREFIX") == "true",
+		// 设置是否返回诊断响应头
+		DiagnosticHeaders: os.Getenv("DIAGNOSTIC_HEADERS") == "true",
 		// 设置是否使用提示词禁用artifacts
 		PromptDisableArtifacts: os.Getenv("PROMPT_DISABLE_ARTIFACTS") == "true",
 		// 设置是否启用镜像API
@@ -645,6 +906,22 @@ func loadConfigFromEnv() *Config {
 		AdminPassword: adminPassword,
 		// 设置请求日志保留条数
 		RequestLogRetention: NormalizeRequestLogRetention(requestLogRetention),
+		// 设置请求日志持久化
+		RequestLogStorage: NormalizeRequestLogStorage(RequestLogStorageConfig{
+			Enabled:    os.Getenv("REQUEST_LOG_STORAGE") == "true",
+			Dir:        os.Getenv("REQUEST_LOG_DIR"),
+			MaxSizeMB:  logMaxSize,
+			MaxAgeDays: logMaxAge,
+		}),
+		// 设置服务日志
+		Logging: NormalizeLogging(LoggingConfig{
+			Level:            os.Getenv("LOG_LEVEL"),
+			Format:           os.Getenv("LOG_FORMAT"),
+			File:             os.Getenv("LOG_FILE"),
+			MaxSizeMB:        serverLogMaxSize,
+			MaxBackups:       serverLogBackups,
+			DisableRedaction: os.Getenv("LOG_REDACTION_DISABLED") == "true",
+		}),
 		// 设置读写锁
 		RwMutx: sync.RWMutex{},
 	}
@@ -714,7 +991,21 @@ func createDefaultConfigFile(config *Config) error {
 		"internalRetryCount":         NormalizeInternalRetryCount(config.InternalRetryCount),
 		"maxConcurrentPerKey":        NormalizeMaxConcurrentPerKey(config.MaxConcurrentPerKey),
 		"maxGlobalConcurrency":       NormalizeMaxGlobalConcurrency(config.MaxGlobalConcurrency),
+		"sessionStrategy":            NormalizeSessionStrategy(config.SessionStrategy),
+		"sessionAffinity":            config.SessionAffinity,
+		"predictiveRateLimit":        config.PredictiveRateLimit,
+		"adaptiveConcurrency":        NormalizeAdaptiveConcurrency(config.AdaptiveConcurrency),
+		"circuitBreaker":             NormalizeCircuitBreaker(config.CircuitBreaker),
+		"healthProbe":                NormalizeHealthProbe(config.HealthProbe),
+		"notifications":              NormalizeNotification(config.Notifications),
+		"runtimeState":               NormalizeRuntimeState(config.RuntimeState),
+		"metrics":                    NormalizeMetrics(config.Metrics),
+		"tracing":                    NormalizeTracing(config.Tracing),
+		"heartbeat":                  NormalizeHeartbeat(config.Heartbeat),
+		"upstream":                   NormalizeUpstream(config.Upstream),
+		"transcripts":                NormalizeTranscripts(config.Transcripts),
 		"noRolePrefix":               config.NoRolePrefix,
+		"diagnosticHeaders":          config.DiagnosticHeaders,
 		"promptDisableArtifacts":     config.PromptDisableArtifacts,
 		"enableMirrorApi":            config.EnableMirrorApi,
 		"mirrorApiPrefix":            config.MirrorApiPrefix,
@@ -723,6 +1014,8 @@ func createDefaultConfigFile(config *Config) error {
 		"globalPromptOverrideMode":   config.GlobalPromptOverrideMode,
 		"modelDefinitions":           config.ModelDefinitions,
 		"requestLogRetention":        config.RequestLogRetention,
+		"requestLogStorage":          NormalizeRequestLogStorage(config.RequestLogStorage),
+		"logging":                    NormalizeLogging(config.Logging),
 	}
 
 	// 序列化为 YAML
@@ -739,6 +1032,19 @@ func createDefaultConfigFile(config *Config) error {
 	return nil
 }
 
+// parseNotificationEnv 从环境变量解析 Webhook 通知，多个地址用逗号分隔
+func parseNotificationEnv() NotificationConfig {
+	settings := NotificationConfig{}
+	format := os.Getenv("NOTIFY_WEBHOOK_FORMAT")
+	for _, url := range strings.Split(os.Getenv("NOTIFY_WEBHOOK_URLS"), ",") {
+		if url = strings.TrimSpace(url); url != "" {
+			settings.Webhooks = append(settings.Webhooks, WebhookConfig{URL: url, Format: format})
+		}
+	}
+	settings.Enabled = len(settings.Webhooks) > 0
+	return NormalizeNotification(settings)
+}
+
 // parseSessionsFromEnv 从环境变量解析 Session
 func parseSessionsFromEnv() []SessionInfo {
 	_, sessions := parseSessionEnv(os.Getenv("SESSIONS"))
@@ -793,7 +1099,10 @@ func mergeSessions(config *Config, envSessions []SessionInfo) *Config {
 var ConfigInstance *Config
 var Sr *SessionRagen
 
-func init() {
+// Init loads the configuration of the proxy server from .env, config.yaml and the
+// environment into ConfigInstance, creating a default config.yaml when there is none.
+// Importing this package has no side effects until Init is called.
+func Init() {
 	rand.Seed(time.Now().UnixNano())
 	// 加载环境变量
 	_ = godotenv.Load()
@@ -802,12 +1111,28 @@ func init() {
 		Mutex: sync.Mutex{},
 	}
 	ConfigInstance = LoadConfig()
+	if err := ApplyLogging(ConfigInstance.Logging); err != nil {
+		logger.Error(fmt.Sprintf("Failed to configure logging: %v", err))
+	}
 	logger.GlobalRequestLogger.SetMaxLogs(ConfigInstance.RequestLogRetention)
 	logger.Info("Loaded config:")
 	logger.Info(fmt.Sprintf("Max Retry count: %d", ConfigInstance.RetryCount))
 	logger.Info(fmt.Sprintf("Internal Retry count: %d", ConfigInstance.InternalRetryCount))
 	logger.Info(fmt.Sprintf("Max concurrent per key: %d", NormalizeMaxConcurrentPerKey(ConfigInstance.MaxConcurrentPerKey)))
 	logger.Info(fmt.Sprintf("Max global concurrency: %d", NormalizeMaxGlobalConcurrency(ConfigInstance.MaxGlobalConcurrency)))
+	logger.Info(fmt.Sprintf("Session strategy: %s", NormalizeSessionStrategy(ConfigInstance.SessionStrategy)))
+	logger.Info(fmt.Sprintf("Session affinity: %t", ConfigInstance.SessionAffinity.Enabled))
+	logger.Info(fmt.Sprintf("Adaptive concurrency: %t", ConfigInstance.AdaptiveConcurrency.Enabled))
+	logger.Info(fmt.Sprintf("Circuit breaker: %t", !ConfigInstance.CircuitBreaker.Disabled))
+	logger.Info(fmt.Sprintf("Health probe: %t", ConfigInstance.HealthProbe.Enabled))
+	logger.Info(fmt.Sprintf("Notifications: %t (%d webhooks)", ConfigInstance.Notifications.Enabled, len(ConfigInstance.Notifications.Webhooks)))
+	logger.Info(fmt.Sprintf("Metrics: %t (token: %s)", ConfigInstance.Metrics.Enabled, MaskSecret(ConfigInstance.Metrics.Token)))
+	logger.Info(fmt.Sprintf("Tracing: %t (%s)", ConfigInstance.Tracing.Enabled, ConfigInstance.Tracing.Exporter))
+	logger.Info(fmt.Sprintf("Upstream: %s (timeout %ds, header timeout %ds)", ConfigInstance.Upstream.BaseURL, ConfigInstance.Upstream.TimeoutSeconds, ConfigInstance.Upstream.ResponseHeaderTimeoutSeconds))
+	logger.Info(fmt.Sprintf("Transcripts: %t (%s)", ConfigInstance.Transcripts.Enabled, ConfigInstance.Transcripts.Dir))
+	logger.Info(fmt.Sprintf("Heartbeat: %t (every %ds, non-stream: %t)", ConfigInstance.Heartbeat.Enabled, ConfigInstance.Heartbeat.IntervalSeconds, ConfigInstance.Heartbeat.NonStream))
+	logger.Info(fmt.Sprintf("Runtime state file: %s (disabled: %t)", ConfigInstance.RuntimeState.Path, ConfigInstance.RuntimeState.Disabled))
+	logger.Info(fmt.Sprintf("Predictive rate limit: %t (%s)", ConfigInstance.PredictiveRateLimit.Enabled, NormalizePredictiveMode(ConfigInstance.PredictiveRateLimit.Mode)))
 	for _, session := range ConfigInstance.Sessions {
 		logger.Info(fmt.Sprintf("Session: %s, OrgID: %s", MaskSecret(session.SessionKey), MaskSecret(session.OrgID)))
 	}
@@ -817,8 +1142,11 @@ func init() {
 	logger.Info(fmt.Sprintf("ChatDelete: %t", ConfigInstance.ChatDelete))
 	logger.Info(fmt.Sprintf("MaxChatHistoryLength: %d", ConfigInstance.MaxChatHistoryLength))
 	logger.Info(fmt.Sprintf("NoRolePrefix: %t", ConfigInstance.NoRolePrefix))
+	logger.Info(fmt.Sprintf("DiagnosticHeaders: %t", ConfigInstance.DiagnosticHeaders))
 	logger.Info(fmt.Sprintf("PromptDisableArtifacts: %t", ConfigInstance.PromptDisableArtifacts))
 	logger.Info(fmt.Sprintf("EnableMirrorApi: %t", ConfigInstance.EnableMirrorApi))
 	logger.Info(fmt.Sprintf("MirrorApiPrefix: %s", ConfigInstance.MirrorApiPrefix))
 	logger.Info(fmt.Sprintf("RequestLogRetention: %d", ConfigInstance.RequestLogRetention))
+	logger.Info(fmt.Sprintf("RequestLogStorage: %t (%s)", ConfigInstance.RequestLogStorage.Enabled, ConfigInstance.RequestLogStorage.Dir))
+	logger.Info(fmt.Sprintf("Logging: level %s, format %s, file %q", ConfigInstance.Logging.Level, ConfigInstance.Logging.Format, ConfigInstance.Logging.File))
 }
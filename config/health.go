@@ -0,0 +1,108 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+const (
+	HealthProbeModeOrganizations = "organizations"
+	HealthProbeModeCompletion    = "completion"
+	DefaultHealthProbeInterval   = 600
+	DefaultHealthProbeJitter     = 60
+
+	SessionHealthUnknown   = "unknown"
+	SessionHealthHealthy   = "healthy"
+	SessionHealthUnhealthy = "unhealthy"
+)
+
+// HealthProbeConfig schedules background liveness checks of every session.
+type HealthProbeConfig struct {
+	Enabled         bool `yaml:"enabled" json:"enabled"`
+	IntervalSeconds int  `yaml:"intervalSeconds,omitempty" json:"interval_seconds,omitempty"`
+	JitterSeconds   int  `yaml:"jitterSeconds,omitempty" json:"jitter_seconds,omitempty"`
+	// Mode "organizations" only checks auth; "completion" sends a tiny chat with Model.
+	Mode  string `yaml:"mode,omitempty" json:"mode,omitempty"`
+	Model string `yaml:"model,omitempty" json:"model,omitempty"`
+}
+
+// SessionHealth is the outcome of the latest background probe of a session.
+type SessionHealth struct {
+	Status              string    `json:"status"`
+	CheckedAt           time.Time `json:"checked_at"`
+	LastHealthyAt       time.Time `json:"last_healthy_at"`
+	LatencyMs           int64     `json:"latency_ms"`
+	ConsecutiveFailures int       `json:"consecutive_failures"`
+	LastError           string    `json:"last_error,omitempty"`
+}
+
+func NormalizeHealthProbe(settings HealthProbeConfig) HealthProbeConfig {
+	if settings.IntervalSeconds <= 0 {
+		settings.IntervalSeconds = DefaultHealthProbeInterval
+	}
+	if settings.IntervalSeconds < 60 {
+		settings.IntervalSeconds = 60
+	}
+	if settings.JitterSeconds <= 0 {
+		settings.JitterSeconds = DefaultHealthProbeJitter
+	}
+	if settings.JitterSeconds > settings.IntervalSeconds {
+		settings.JitterSeconds = settings.IntervalSeconds
+	}
+	switch strings.ToLower(strings.TrimSpace(settings.Mode)) {
+	case HealthProbeModeCompletion:
+		settings.Mode = HealthProbeModeCompletion
+	default:
+		settings.Mode = HealthProbeModeOrganizations
+	}
+	settings.Model = strings.TrimSpace(settings.Model)
+	return settings
+}
+
+// RecordSessionHealth stores a probe result and reports whether the session just
+// recovered from an unhealthy state.
+func (c *Config) RecordSessionHealth(sessionKey string, healthy bool, latency time.Duration, message string, now time.Time) bool {
+	sessionKey = strings.TrimSpace(sessionKey)
+	if sessionKey == "" {
+		return false
+	}
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+
+	health := c.SessionHealthStates[sessionKey]
+	recovered := healthy && health.Status == SessionHealthUnhealthy
+	health.CheckedAt = now
+	health.LatencyMs = latency.Milliseconds()
+	if healthy {
+		health.Status = SessionHealthHealthy
+		health.LastHealthyAt = now
+		health.ConsecutiveFailures = 0
+		health.LastError = ""
+	} else {
+		health.Status = SessionHealthUnhealthy
+		health.ConsecutiveFailures++
+		health.LastError = message
+	}
+	c.SessionHealthStates[sessionKey] = health
+	return recovered
+}
+
+// GetSessionHealthByIndex returns the latest probe result; unprobed sessions are "unknown".
+func (c *Config) GetSessionHealthByIndex(idx int) SessionHealth {
+	c.RwMutx.RLock()
+	defer c.RwMutx.RUnlock()
+
+	if idx < 0 || idx >= len(c.Sessions) {
+		return SessionHealth{Status: SessionHealthUnknown}
+	}
+	health, ok := c.SessionHealthStates[strings.TrimSpace(c.Sessions[idx].SessionKey)]
+	if !ok {
+		return SessionHealth{Status: SessionHealthUnknown}
+	}
+	return health
+}
@@ -0,0 +1,49 @@
+package config
+
+import (
+	"claude2api/logger"
+	"testing"
+	"time"
+)
+
+func TestRecordSessionHealthReportsRecovery(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 7, 8, 0, 0, 0, time.Local)
+
+	if got := cfg.GetSessionHealthByIndex(0).Status; got != SessionHealthUnknown {
+		t.Fatalf("expected unprobed session to be unknown, got %s", got)
+	}
+	if recovered := cfg.RecordSessionHealth("sk-a", true, 80*time.Millisecond, "", now); recovered {
+		t.Fatal("expected first healthy probe not to count as a recovery")
+	}
+	cfg.RecordSessionHealth("sk-a", false, time.Second, "timeout", now.Add(time.Minute))
+	cfg.RecordSessionHealth("sk-a", false, time.Second, "timeout", now.Add(2*time.Minute))
+	if health := cfg.GetSessionHealthByIndex(0); health.ConsecutiveFailures != 2 || health.LastHealthyAt != now {
+		t.Fatalf("unexpected unhealthy state: %+v", health)
+	}
+	if recovered := cfg.RecordSessionHealth("sk-a", true, 50*time.Millisecond, "", now.Add(3*time.Minute)); !recovered {
+		t.Fatal("expected healthy probe after failures to be a recovery")
+	}
+	if health := cfg.GetSessionHealthByIndex(0); health.LatencyMs != 50 || health.LastError != "" {
+		t.Fatalf("unexpected recovered state: %+v", health)
+	}
+}
+
+func TestNormalizeHealthProbe(t *testing.T) {
+	settings := NormalizeHealthProbe(HealthProbeConfig{IntervalSeconds: 5, JitterSeconds: 500, Mode: "Completion"})
+	if settings.IntervalSeconds != 60 || settings.JitterSeconds != 60 || settings.Mode != HealthProbeModeCompletion {
+		t.Fatalf("unexpected normalized settings: %+v", settings)
+	}
+	if got := NormalizeHealthProbe(HealthProbeConfig{}).Mode; got != HealthProbeModeOrganizations {
+		t.Fatalf("expected organizations mode by default, got %s", got)
+	}
+}
@@ -0,0 +1,23 @@
+package config
+
+const DefaultHeartbeatIntervalSeconds = 15
+
+// HeartbeatConfig keeps quiet responses alive while Claude is still thinking, so
+// proxies and clients with idle timeouts do not drop them. Streaming responses get SSE
+// comment lines; with NonStream, non-stream responses get leading whitespace before
+// the JSON body.
+type HeartbeatConfig struct {
+	Enabled         bool `yaml:"enabled" json:"enabled"`
+	IntervalSeconds int  `yaml:"intervalSeconds,omitempty" json:"interval_seconds,omitempty"`
+	NonStream       bool `yaml:"nonStream,omitempty" json:"non_stream,omitempty"`
+}
+
+func NormalizeHeartbeat(settings HeartbeatConfig) HeartbeatConfig {
+	if settings.IntervalSeconds <= 0 {
+		settings.IntervalSeconds = DefaultHeartbeatIntervalSeconds
+	}
+	if settings.IntervalSeconds > 300 {
+		settings.IntervalSeconds = 300
+	}
+	return settings
+}
@@ -0,0 +1,65 @@
+package config
+
+import (
+	"claude2api/logger"
+	"strings"
+)
+
+const (
+	DefaultLogLevel      = "info"
+	DefaultLogMaxSizeMB  = 50
+	DefaultLogMaxBackups = 5
+)
+
+// LoggingConfig controls server logs. Format "json" writes one JSON object per line
+// with fields such as request_id, session_label and model; File adds a size-rotated
+// copy next to stdout. Secrets are masked unless DisableRedaction is set.
+type LoggingConfig struct {
+	Level            string `yaml:"level,omitempty" json:"level,omitempty"`
+	Format           string `yaml:"format,omitempty" json:"format,omitempty"`
+	File             string `yaml:"file,omitempty" json:"file,omitempty"`
+	MaxSizeMB        int    `yaml:"maxSizeMB,omitempty" json:"max_size_mb,omitempty"`
+	MaxBackups       int    `yaml:"maxBackups,omitempty" json:"max_backups,omitempty"`
+	DisableRedaction bool   `yaml:"disableRedaction,omitempty" json:"disable_redaction,omitempty"`
+}
+
+func NormalizeLogging(settings LoggingConfig) LoggingConfig {
+	level, ok := logger.ParseLevel(settings.Level)
+	if !ok {
+		level = logger.INFO
+	}
+	settings.Level = strings.ToLower(logger.GetLevelName(level))
+	if strings.EqualFold(strings.TrimSpace(settings.Format), logger.FormatJSON) {
+		settings.Format = logger.FormatJSON
+	} else {
+		settings.Format = logger.FormatText
+	}
+	settings.File = strings.TrimSpace(settings.File)
+	if settings.MaxSizeMB <= 0 {
+		settings.MaxSizeMB = DefaultLogMaxSizeMB
+	}
+	if settings.MaxSizeMB > 1024 {
+		settings.MaxSizeMB = 1024
+	}
+	if settings.MaxBackups <= 0 {
+		settings.MaxBackups = DefaultLogMaxBackups
+	}
+	if settings.MaxBackups > 100 {
+		settings.MaxBackups = 100
+	}
+	return settings
+}
+
+// ApplyLogging configures the logger package from the settings.
+func ApplyLogging(settings LoggingConfig) error {
+	settings = NormalizeLogging(settings)
+	level, _ := logger.ParseLevel(settings.Level)
+	return logger.Configure(logger.Options{
+		Level:      level,
+		Format:     settings.Format,
+		FilePath:   settings.File,
+		MaxBytes:   int64(settings.MaxSizeMB) * 1024 * 1024,
+		MaxBackups: settings.MaxBackups,
+		Redact:     !settings.DisableRedaction,
+	})
+}
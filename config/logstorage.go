@@ -0,0 +1,39 @@
+package config
+
+import "strings"
+
+const (
+	DefaultRequestLogDir        = "logs"
+	DefaultRequestLogMaxSizeMB  = 50
+	DefaultRequestLogMaxAgeDays = 30
+)
+
+// RequestLogStorageConfig controls the durable JSONL store behind the in-memory
+// request log. The active file rotates by size or after a day; rotated files older
+// than MaxAgeDays are deleted.
+type RequestLogStorageConfig struct {
+	Enabled    bool   `yaml:"enabled" json:"enabled"`
+	Dir        string `yaml:"dir,omitempty" json:"dir,omitempty"`
+	MaxSizeMB  int    `yaml:"maxSizeMB,omitempty" json:"max_size_mb,omitempty"`
+	MaxAgeDays int    `yaml:"maxAgeDays,omitempty" json:"max_age_days,omitempty"`
+}
+
+func NormalizeRequestLogStorage(settings RequestLogStorageConfig) RequestLogStorageConfig {
+	settings.Dir = strings.TrimSpace(settings.Dir)
+	if settings.Dir == "" {
+		settings.Dir = DefaultRequestLogDir
+	}
+	if settings.MaxSizeMB <= 0 {
+		settings.MaxSizeMB = DefaultRequestLogMaxSizeMB
+	}
+	if settings.MaxSizeMB > 1024 {
+		settings.MaxSizeMB = 1024
+	}
+	if settings.MaxAgeDays <= 0 {
+		settings.MaxAgeDays = DefaultRequestLogMaxAgeDays
+	}
+	if settings.MaxAgeDays > 365 {
+		settings.MaxAgeDays = 365
+	}
+	return settings
+}
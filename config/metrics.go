@@ -0,0 +1,15 @@
+package config
+
+import "strings"
+
+// MetricsConfig exposes Prometheus metrics on /metrics. With Token set, scrapers
+// authenticate with "Authorization: Bearer <token>" instead of the API key.
+type MetricsConfig struct {
+	Enabled bool   `yaml:"enabled" json:"enabled"`
+	Token   string `yaml:"token,omitempty" json:"token,omitempty"`
+}
+
+func NormalizeMetrics(settings MetricsConfig) MetricsConfig {
+	settings.Token = strings.TrimSpace(settings.Token)
+	return settings
+}
@@ -0,0 +1,79 @@
+package config
+
+import "strings"
+
+const (
+	NotifyFormatJSON     = "json"
+	NotifyFormatSlack    = "slack"
+	NotifyFormatFeishu   = "feishu"
+	NotifyFormatDingTalk = "dingtalk"
+
+	NotifyEventSessionQuarantined = "session_quarantined"
+	NotifyEventCooldownSet        = "cooldown_set"
+	NotifyEventPoolExhausted      = "pool_exhausted"
+	NotifyEventProberRecovery     = "prober_recovery"
+
+	DefaultNotifyDedupSeconds = 600
+	DefaultNotifyMaxRetries   = 3
+)
+
+// WebhookConfig is one notification target.
+type WebhookConfig struct {
+	URL string `yaml:"url" json:"url"`
+	// Format selects the payload shape: json, slack, feishu or dingtalk.
+	Format string `yaml:"format,omitempty" json:"format,omitempty"`
+	// Events limits the webhook to these event types; empty means all events.
+	Events []string `yaml:"events,omitempty" json:"events,omitempty"`
+}
+
+// NotificationConfig controls webhook notifications for session and pool events.
+type NotificationConfig struct {
+	Enabled  bool            `yaml:"enabled" json:"enabled"`
+	Webhooks []WebhookConfig `yaml:"webhooks,omitempty" json:"webhooks,omitempty"`
+	// DedupSeconds drops repeats of the same event for the same target within the window.
+	DedupSeconds int `yaml:"dedupSeconds,omitempty" json:"dedup_seconds,omitempty"`
+	MaxRetries   int `yaml:"maxRetries,omitempty" json:"max_retries,omitempty"`
+}
+
+func NormalizeNotifyFormat(format string) string {
+	switch strings.ToLower(strings.TrimSpace(format)) {
+	case NotifyFormatSlack:
+		return NotifyFormatSlack
+	case NotifyFormatFeishu, "lark":
+		return NotifyFormatFeishu
+	case NotifyFormatDingTalk, "dingding":
+		return NotifyFormatDingTalk
+	default:
+		return NotifyFormatJSON
+	}
+}
+
+func NormalizeNotification(settings NotificationConfig) NotificationConfig {
+	webhooks := make([]WebhookConfig, 0, len(settings.Webhooks))
+	for _, webhook := range settings.Webhooks {
+		webhook.URL = strings.TrimSpace(webhook.URL)
+		if webhook.URL == "" {
+			continue
+		}
+		webhook.Format = NormalizeNotifyFormat(webhook.Format)
+		events := make([]string, 0, len(webhook.Events))
+		for _, event := range webhook.Events {
+			if event = strings.ToLower(strings.TrimSpace(event)); event != "" {
+				events = append(events, event)
+			}
+		}
+		webhook.Events = events
+		webhooks = append(webhooks, webhook)
+	}
+	settings.Webhooks = webhooks
+	if settings.DedupSeconds <= 0 {
+		settings.DedupSeconds = DefaultNotifyDedupSeconds
+	}
+	if settings.MaxRetries <= 0 {
+		settings.MaxRetries = DefaultNotifyMaxRetries
+	}
+	if settings.MaxRetries > 10 {
+		settings.MaxRetries = 10
+	}
+	return settings
+}
@@ -0,0 +1,179 @@
+package config
+
+import (
+	"claude2api/logger"
+	"math"
+	"strings"
+	"time"
+)
+
+const (
+	PredictiveModeDeprioritize       = "deprioritize"
+	PredictiveModeRest               = "rest"
+	DefaultPredictiveWindowMinutes   = 300
+	DefaultPredictiveThreshold       = 0.8
+	maxPredictiveSuccessesPerSession = 5000
+	minPredictiveBudget              = 1.0
+)
+
+// PredictiveRateLimitConfig steers traffic away from sessions that are close to the
+// number of successful requests they usually serve before Claude rate limits them.
+type PredictiveRateLimitConfig struct {
+	Enabled       bool `yaml:"enabled" json:"enabled"`
+	WindowMinutes int  `yaml:"windowMinutes,omitempty" json:"window_minutes,omitempty"`
+	// Threshold is the fraction of the learned budget at which a session counts as pressured.
+	Threshold float64 `yaml:"threshold,omitempty" json:"threshold,omitempty"`
+	// Mode is "deprioritize" (only used when nothing else is free) or "rest" (skipped).
+	Mode string `yaml:"mode,omitempty" json:"mode,omitempty"`
+}
+
+// SessionBudgetStatus reports how much of its learned budget a session has used.
+type SessionBudgetStatus struct {
+	HasBudget   bool    `json:"has_budget"`
+	Budget      float64 `json:"budget"`
+	WindowUsage int     `json:"window_usage"`
+	Pressured   bool    `json:"pressured"`
+}
+
+func NormalizePredictiveWindow(minutes int) time.Duration {
+	if minutes <= 0 {
+		minutes = DefaultPredictiveWindowMinutes
+	}
+	if minutes > 1440 {
+		minutes = 1440
+	}
+	return time.Duration(minutes) * time.Minute
+}
+
+func NormalizePredictiveThreshold(value float64) float64 {
+	if value <= 0 || math.IsNaN(value) {
+		return DefaultPredictiveThreshold
+	}
+	if value < 0.1 {
+		return 0.1
+	}
+	if value > 1 {
+		return 1
+	}
+	return value
+}
+
+func NormalizePredictiveMode(mode string) string {
+	switch strings.ToLower(strings.TrimSpace(mode)) {
+	case PredictiveModeRest:
+		return PredictiveModeRest
+	default:
+		return PredictiveModeDeprioritize
+	}
+}
+
+// RecordSessionSuccess counts one successful request toward the session's rolling window
+// and its adaptive concurrency streak, and closes its circuit breaker.
+func (c *Config) RecordSessionSuccess(sessionKey string, now time.Time) {
+	sessionKey = strings.TrimSpace(sessionKey)
+	if sessionKey == "" {
+		return
+	}
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+
+	successes := c.pruneSessionSuccessesLocked(sessionKey, now)
+	successes = append(successes, now)
+	if len(successes) > maxPredictiveSuccessesPerSession {
+		successes = successes[len(successes)-maxPredictiveSuccessesPerSession:]
+	}
+	c.SessionRecentSuccesses[sessionKey] = successes
+	c.increaseSessionConcurrencyLocked(sessionKey)
+	delete(c.SessionBreakers, sessionKey)
+}
+
+// RecordSessionRateLimit starts a fresh window, since the successes so far are what the
+// session managed before this rate limit, and cuts its adaptive concurrency limit.
+func (c *Config) RecordSessionRateLimit(sessionKey string, now time.Time) {
+	sessionKey = strings.TrimSpace(sessionKey)
+	if sessionKey == "" {
+		return
+	}
+
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+	delete(c.SessionRecentSuccesses, sessionKey)
+	c.decreaseSessionConcurrencyLocked(sessionKey)
+}
+
+// GetSessionBudgetStatus reports the learned budget and rolling-window usage of a session.
+func (c *Config) GetSessionBudgetStatus(idx int, stats logger.SessionStats, now time.Time) SessionBudgetStatus {
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+
+	if idx < 0 || idx >= len(c.Sessions) {
+		return SessionBudgetStatus{}
+	}
+	return c.sessionBudgetStatusLocked(strings.TrimSpace(c.Sessions[idx].SessionKey), stats, now)
+}
+
+func (c *Config) sessionBudgetStatusLocked(sessionKey string, stats logger.SessionStats, now time.Time) SessionBudgetStatus {
+	usage := len(c.pruneSessionSuccessesLocked(sessionKey, now))
+	budget := learnedRateLimitBudget(stats)
+	if math.IsInf(budget, 1) || budget < minPredictiveBudget {
+		return SessionBudgetStatus{WindowUsage: usage}
+	}
+	threshold := NormalizePredictiveThreshold(c.PredictiveRateLimit.Threshold)
+	return SessionBudgetStatus{
+		HasBudget:   true,
+		Budget:      budget,
+		WindowUsage: usage,
+		Pressured:   float64(usage) >= budget*threshold,
+	}
+}
+
+func (c *Config) pruneSessionSuccessesLocked(sessionKey string, now time.Time) []time.Time {
+	successes := c.SessionRecentSuccesses[sessionKey]
+	cutoff := now.Add(-NormalizePredictiveWindow(c.PredictiveRateLimit.WindowMinutes))
+	drop := 0
+	for drop < len(successes) && !successes[drop].After(cutoff) {
+		drop++
+	}
+	if drop == 0 {
+		return successes
+	}
+	successes = successes[drop:]
+	if len(successes) == 0 {
+		delete(c.SessionRecentSuccesses, sessionKey)
+		return nil
+	}
+	c.SessionRecentSuccesses[sessionKey] = successes
+	return successes
+}
+
+// applyPredictiveRateLimitLocked removes pressured candidates. In deprioritize mode they
+// stay eligible when every candidate is pressured; in rest mode they are always skipped.
+func (c *Config) applyPredictiveRateLimitLocked(candidates []SessionCandidate, now time.Time) ([]SessionCandidate, int) {
+	if !c.PredictiveRateLimit.Enabled || len(candidates) == 0 {
+		return candidates, 0
+	}
+
+	relaxed := make([]SessionCandidate, 0, len(candidates))
+	for _, candidate := range candidates {
+		if c.sessionBudgetStatusLocked(candidate.SessionKey, candidate.Stats, now).Pressured {
+			continue
+		}
+		relaxed = append(relaxed, candidate)
+	}
+	pressured := len(candidates) - len(relaxed)
+	if len(relaxed) == 0 && NormalizePredictiveMode(c.PredictiveRateLimit.Mode) == PredictiveModeDeprioritize {
+		return candidates, 0
+	}
+	return relaxed, pressured
+}
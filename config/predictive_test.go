@@ -0,0 +1,113 @@
+package config
+
+import (
+	"claude2api/logger"
+	"testing"
+	"time"
+)
+
+func TestPredictiveRateLimitDeprioritizesPressuredSession(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		PredictiveRateLimit:  PredictiveRateLimitConfig{Enabled: true, WindowMinutes: 60, Threshold: 0.5, Mode: PredictiveModeDeprioritize},
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return map[int]logger.SessionStats{
+				0: {RateLimitRequests: 2, AvgSuccessesBeforeRateLimit: 4},
+			}
+		},
+	}
+	now := time.Date(2026, 7, 3, 8, 0, 0, 0, time.Local)
+	cfg.RecordSessionSuccess("sk-a", now.Add(-2*time.Minute))
+	cfg.RecordSessionSuccess("sk-a", now.Add(-time.Minute))
+
+	status := cfg.GetSessionBudgetStatus(0, cfg.SessionStatsSource()[0], now)
+	if !status.HasBudget || status.Budget != 4 || status.WindowUsage != 2 || !status.Pressured {
+		t.Fatalf("unexpected budget status: %+v", status)
+	}
+
+	result := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now, Strategy: SessionStrategyRoundRobin})
+	if !result.OK || result.Lease.Index != 1 || result.RestingCount != 1 {
+		t.Fatalf("expected pressured session 0 to be skipped, got ok=%v index=%d resting=%d", result.OK, result.Lease.Index, result.RestingCount)
+	}
+	defer result.Lease.Release()
+
+	cfg.MaxConcurrentPerKey = 1
+	fallback := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now, Strategy: SessionStrategyRoundRobin})
+	if !fallback.OK || fallback.Lease.Index != 0 {
+		t.Fatalf("expected deprioritized session to serve when nothing else is free, got ok=%v index=%d", fallback.OK, fallback.Lease.Index)
+	}
+	fallback.Lease.Release()
+}
+
+func TestPredictiveRateLimitRestModeSkipsPressuredSession(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+		},
+		MaxConcurrentPerKey:  1,
+		MaxGlobalConcurrency: 10,
+		PredictiveRateLimit:  PredictiveRateLimitConfig{Enabled: true, WindowMinutes: 60, Threshold: 0.5, Mode: PredictiveModeRest},
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return map[int]logger.SessionStats{
+				0: {RateLimitRequests: 2, AvgSuccessesBeforeRateLimit: 4},
+			}
+		},
+	}
+	now := time.Date(2026, 7, 3, 8, 0, 0, 0, time.Local)
+	cfg.RecordSessionSuccess("sk-a", now.Add(-time.Minute))
+	cfg.RecordSessionSuccess("sk-a", now.Add(-time.Minute))
+
+	busy := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 1, Now: now, Strategy: SessionStrategyRoundRobin})
+	if !busy.OK || busy.Lease.Index != 1 {
+		t.Fatalf("expected session 1, got ok=%v index=%d", busy.OK, busy.Lease.Index)
+	}
+	defer busy.Lease.Release()
+
+	rested := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now, Strategy: SessionStrategyRoundRobin})
+	if rested.OK || rested.RestingCount != 1 {
+		t.Fatalf("expected resting session to be refused, got ok=%v resting=%d", rested.OK, rested.RestingCount)
+	}
+}
+
+func TestPredictiveRateLimitWindowRollsAndResetsOnRateLimit(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		PredictiveRateLimit:  PredictiveRateLimitConfig{Enabled: true, WindowMinutes: 60, Threshold: 0.5, Mode: PredictiveModeRest},
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return map[int]logger.SessionStats{
+				0: {RateLimitRequests: 2, AvgSuccessesBeforeRateLimit: 4},
+			}
+		},
+	}
+	now := time.Date(2026, 7, 3, 8, 0, 0, 0, time.Local)
+	stats := cfg.SessionStatsSource()[0]
+
+	cfg.RecordSessionSuccess("sk-a", now.Add(-90*time.Minute))
+	cfg.RecordSessionSuccess("sk-a", now.Add(-time.Minute))
+	if status := cfg.GetSessionBudgetStatus(0, stats, now); status.WindowUsage != 1 || status.Pressured {
+		t.Fatalf("expected successes outside the window to be dropped, got %+v", status)
+	}
+
+	cfg.RecordSessionSuccess("sk-a", now)
+	if status := cfg.GetSessionBudgetStatus(0, stats, now); !status.Pressured {
+		t.Fatalf("expected session to be pressured, got %+v", status)
+	}
+	cfg.RecordSessionRateLimit("sk-a", now)
+	if status := cfg.GetSessionBudgetStatus(0, stats, now); status.WindowUsage != 0 || status.Pressured {
+		t.Fatalf("expected rate limit to reset the window, got %+v", status)
+	}
+	if status := cfg.GetSessionBudgetStatus(1, logger.SessionStats{}, now); status.HasBudget {
+		t.Fatalf("expected never rate limited session to have no learned budget, got %+v", status)
+	}
+}
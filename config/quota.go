@@ -0,0 +1,74 @@
+package config
+
+import (
+	"strings"
+	"time"
+)
+
+// Quota types as Claude reports them in message_limit events.
+const (
+	SessionQuotaWithin      = "within_limit"
+	SessionQuotaApproaching = "approaching_limit"
+	SessionQuotaExceeded    = "exceeded_limit"
+)
+
+// SessionQuota is the latest usage limit state Claude reported for a session.
+type SessionQuota struct {
+	Type string `json:"type"`
+	// Remaining is -1 when Claude did not report a count.
+	Remaining   int       `json:"remaining"`
+	ResetsAt    time.Time `json:"resets_at"`
+	Utilization float64   `json:"utilization"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// UpdateSessionQuota stores the session's reported quota. When the quota is used up and
+// Claude named a usable reset time, the session gets an official cooldown right away so
+// the scheduler stops picking it before the next request runs into a 429.
+func (c *Config) UpdateSessionQuota(sessionKey string, quota SessionQuota, now time.Time) (time.Time, bool) {
+	sessionKey = strings.TrimSpace(sessionKey)
+	if sessionKey == "" {
+		return time.Time{}, false
+	}
+	if now.IsZero() {
+		now = time.Now()
+	}
+	quota.UpdatedAt = now
+
+	c.RwMutx.Lock()
+	c.ensureRuntimeStateLocked()
+	c.SessionQuotas[sessionKey] = quota
+	c.RwMutx.Unlock()
+
+	exhausted := quota.Type == SessionQuotaExceeded || quota.Remaining == 0
+	if !exhausted || quota.ResetsAt.IsZero() || !quota.ResetsAt.After(now.Add(MinRateLimitResetWindow)) {
+		return time.Time{}, false
+	}
+	until, source := c.setSessionCooldownUntil(sessionKey, quota.ResetsAt, CooldownSourceOfficial)
+	return until, source == CooldownSourceOfficial
+}
+
+// GetSessionQuotaByIndex returns the last reported quota, dropping it once its window reset.
+func (c *Config) GetSessionQuotaByIndex(idx int, now time.Time) (SessionQuota, bool) {
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+
+	if idx < 0 || idx >= len(c.Sessions) {
+		return SessionQuota{}, false
+	}
+	sessionKey := strings.TrimSpace(c.Sessions[idx].SessionKey)
+	quota, ok := c.SessionQuotas[sessionKey]
+	if !ok {
+		return SessionQuota{}, false
+	}
+	if !quota.ResetsAt.IsZero() && !quota.ResetsAt.After(now) {
+		delete(c.SessionQuotas, sessionKey)
+		return SessionQuota{}, false
+	}
+	return quota, true
+}
@@ -0,0 +1,67 @@
+package config
+
+import (
+	"claude2api/logger"
+	"testing"
+	"time"
+)
+
+func TestUpdateSessionQuotaCoolsDownExhaustedSession(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 4, 10, 0, 0, 0, time.Local)
+	reset := now.Add(2 * time.Hour)
+
+	if _, cooled := cfg.UpdateSessionQuota("sk-a", SessionQuota{Type: SessionQuotaApproaching, Remaining: 3, ResetsAt: reset}, now); cooled {
+		t.Fatal("expected approaching quota not to cool the session down")
+	}
+	quota, ok := cfg.GetSessionQuotaByIndex(0, now)
+	if !ok || quota.Remaining != 3 || !quota.UpdatedAt.Equal(now) {
+		t.Fatalf("unexpected stored quota: ok=%v %+v", ok, quota)
+	}
+
+	until, cooled := cfg.UpdateSessionQuota("sk-a", SessionQuota{Type: SessionQuotaExceeded, Remaining: -1, ResetsAt: reset}, now)
+	if !cooled || !until.Equal(reset) {
+		t.Fatalf("expected official cooldown until %s, got %s cooled=%v", reset, until, cooled)
+	}
+	if _, source, coolingDown := cfg.GetSessionCooldownInfoByIndex(0, now); !coolingDown || source != CooldownSourceOfficial {
+		t.Fatalf("expected official cooldown, got cooling=%v source=%s", coolingDown, source)
+	}
+
+	result := cfg.AcquireSessionLease(0, nil, now)
+	if !result.OK || result.Lease.Index != 1 {
+		t.Fatalf("expected exhausted session to be skipped, got index=%d", result.Lease.Index)
+	}
+	result.Lease.Release()
+
+	if _, ok := cfg.GetSessionQuotaByIndex(0, reset.Add(time.Second)); ok {
+		t.Fatal("expected quota to be dropped after its reset time")
+	}
+}
+
+func TestUpdateSessionQuotaIgnoresTooCloseReset(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 4, 10, 0, 0, 0, time.Local)
+
+	if _, cooled := cfg.UpdateSessionQuota("sk-a", SessionQuota{Type: SessionQuotaExceeded, Remaining: 0, ResetsAt: now.Add(10 * time.Second)}, now); cooled {
+		t.Fatal("expected reset inside the minimum window not to freeze the session")
+	}
+}
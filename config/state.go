@@ -0,0 +1,182 @@
+package config
+
+import (
+	"claude2api/logger"
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+const (
+	DefaultRuntimeStatePath         = "runtime-state.json"
+	DefaultRuntimeStateSaveInterval = 30
+	runtimeStateVersion             = 1
+)
+
+// RuntimeStateConfig controls the state file that keeps cooldowns and session
+// statistics across restarts. It is on by default; set disabled to turn it off.
+type RuntimeStateConfig struct {
+	Disabled bool `yaml:"disabled,omitempty" json:"disabled"`
+	// Path is relative to the working directory unless absolute.
+	Path                string `yaml:"path,omitempty" json:"path,omitempty"`
+	SaveIntervalSeconds int    `yaml:"saveIntervalSeconds,omitempty" json:"save_interval_seconds,omitempty"`
+}
+
+// RuntimeState is the persisted runtime state, keyed by session key so that
+// reordering sessions in the config does not move state between accounts.
+type RuntimeState struct {
+	Version  int                            `json:"version"`
+	SavedAt  time.Time                      `json:"saved_at"`
+	Sessions map[string]SessionRuntimeState `json:"sessions"`
+}
+
+type SessionRuntimeState struct {
+	CooldownUntil   time.Time                    `json:"cooldown_until,omitempty"`
+	CooldownSource  string                       `json:"cooldown_source,omitempty"`
+	LastUsedAt      time.Time                    `json:"last_used_at,omitempty"`
+	RecentSuccesses []time.Time                  `json:"recent_successes,omitempty"`
+	Quota           *SessionQuota                `json:"quota,omitempty"`
+	Breaker         *SessionBreaker              `json:"breaker,omitempty"`
+	OpenDurationSec int64                        `json:"breaker_open_seconds,omitempty"`
+	Stats           *logger.SessionStatsSnapshot `json:"stats,omitempty"`
+}
+
+func NormalizeRuntimeState(settings RuntimeStateConfig) RuntimeStateConfig {
+	settings.Path = strings.TrimSpace(settings.Path)
+	if settings.Path == "" {
+		settings.Path = DefaultRuntimeStatePath
+	}
+	if settings.SaveIntervalSeconds <= 0 {
+		settings.SaveIntervalSeconds = DefaultRuntimeStateSaveInterval
+	}
+	if settings.SaveIntervalSeconds < 5 {
+		settings.SaveIntervalSeconds = 5
+	}
+	return settings
+}
+
+// ExportRuntimeState captures the state worth keeping across a restart. Expired
+// cooldowns are dropped; in-flight counters and affinity bindings are not saved.
+func (c *Config) ExportRuntimeState(stats map[int]logger.SessionStatsSnapshot, now time.Time) RuntimeState {
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+
+	state := RuntimeState{Version: runtimeStateVersion, SavedAt: now, Sessions: make(map[string]SessionRuntimeState)}
+	for idx, session := range c.Sessions {
+		sessionKey := strings.TrimSpace(session.SessionKey)
+		if sessionKey == "" {
+			continue
+		}
+		entry := SessionRuntimeState{LastUsedAt: c.SessionLastUsedAt[sessionKey]}
+		if until := c.SessionCooldownUntil[sessionKey]; until.After(now) {
+			entry.CooldownUntil = until
+			entry.CooldownSource = c.SessionCooldownSource[sessionKey]
+		}
+		entry.RecentSuccesses = append([]time.Time(nil), c.SessionRecentSuccesses[sessionKey]...)
+		if quota, ok := c.SessionQuotas[sessionKey]; ok {
+			entry.Quota = &quota
+		}
+		if breaker, ok := c.SessionBreakers[sessionKey]; ok {
+			breaker.ProbeInFlight = false
+			entry.Breaker = &breaker
+			entry.OpenDurationSec = int64(breaker.OpenDuration / time.Second)
+		}
+		if snapshot, ok := stats[idx]; ok {
+			entry.Stats = &snapshot
+		}
+		state.Sessions[sessionKey] = entry
+	}
+	return state
+}
+
+// ImportRuntimeState restores saved state for the sessions that are still configured
+// and returns the per-index stats to hand to the request logger.
+func (c *Config) ImportRuntimeState(state RuntimeState, now time.Time) (int, map[int]logger.SessionStatsSnapshot) {
+	if now.IsZero() {
+		now = time.Now()
+	}
+
+	c.RwMutx.Lock()
+	defer c.RwMutx.Unlock()
+	c.ensureRuntimeStateLocked()
+
+	restored := 0
+	stats := make(map[int]logger.SessionStatsSnapshot)
+	for idx, session := range c.Sessions {
+		sessionKey := strings.TrimSpace(session.SessionKey)
+		entry, ok := state.Sessions[sessionKey]
+		if sessionKey == "" || !ok {
+			continue
+		}
+		restored++
+		if entry.CooldownUntil.After(now) {
+			c.SessionCooldownUntil[sessionKey] = entry.CooldownUntil
+			c.SessionCooldownSource[sessionKey] = entry.CooldownSource
+		}
+		if !entry.LastUsedAt.IsZero() {
+			c.SessionLastUsedAt[sessionKey] = entry.LastUsedAt
+		}
+		if len(entry.RecentSuccesses) > 0 {
+			c.SessionRecentSuccesses[sessionKey] = append([]time.Time(nil), entry.RecentSuccesses...)
+		}
+		if entry.Quota != nil {
+			c.SessionQuotas[sessionKey] = *entry.Quota
+		}
+		if entry.Breaker != nil {
+			breaker := *entry.Breaker
+			breaker.ProbeInFlight = false
+			breaker.OpenDuration = time.Duration(entry.OpenDurationSec) * time.Second
+			c.SessionBreakers[sessionKey] = breaker
+		}
+		if entry.Stats != nil {
+			stats[idx] = *entry.Stats
+		}
+	}
+	return restored, stats
+}
+
+// ReadRuntimeState loads a state file; a missing file yields an empty state.
+func ReadRuntimeState(path string) (RuntimeState, error) {
+	state := RuntimeState{Sessions: make(map[string]SessionRuntimeState)}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return state, nil
+	}
+	if err != nil {
+		return state, err
+	}
+	if err := json.Unmarshal(data, &state); err != nil {
+		return state, err
+	}
+	if state.Sessions == nil {
+		state.Sessions = make(map[string]SessionRuntimeState)
+	}
+	return state, nil
+}
+
+// WriteRuntimeState writes the state file atomically, so a crash mid-write
+// never leaves a truncated file behind.
+func WriteRuntimeState(path string, state RuntimeState) error {
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	if dir := filepath.Dir(path); dir != "." {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			return err
+		}
+	}
+	tmpPath := path + ".tmp"
+	if err := os.WriteFile(tmpPath, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, path)
+}
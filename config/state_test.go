@@ -0,0 +1,99 @@
+package config
+
+import (
+	"claude2api/logger"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestRuntimeStateRoundTripFollowsSessionKeys(t *testing.T) {
+	now := time.Date(2026, 7, 8, 8, 0, 0, 0, time.Local)
+	resetAt := now.Add(2 * time.Hour)
+
+	before := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	if until, source := before.CooldownSessionAfterRateLimit("sk-b", resetAt, now); source != CooldownSourceOfficial || !until.Equal(resetAt) {
+		t.Fatalf("expected official cooldown, got %s until %s", source, until)
+	}
+	before.RecordSessionAuthFailure("sk-a", "invalid session", now)
+	before.RecordSessionAuthFailure("sk-a", "invalid session", now)
+	stats := map[int]logger.SessionStatsSnapshot{
+		1: {Stats: logger.SessionStats{TotalRequests: 7, SuccessRequests: 6}, SuccessesBeforeRateLimitTotal: 6},
+	}
+
+	path := filepath.Join(t.TempDir(), "state", "runtime-state.json")
+	if err := WriteRuntimeState(path, before.ExportRuntimeState(stats, now)); err != nil {
+		t.Fatalf("write state: %v", err)
+	}
+	state, err := ReadRuntimeState(path)
+	if err != nil {
+		t.Fatalf("read state: %v", err)
+	}
+
+	// The sessions are reordered and a new one is added before the restart.
+	after := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-new"},
+			{SessionKey: "sk-b"},
+			{SessionKey: "sk-a"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	restored, restoredStats := after.ImportRuntimeState(state, now.Add(time.Minute))
+	if restored != 2 {
+		t.Fatalf("expected 2 restored sessions, got %d", restored)
+	}
+	if until, source, ok := after.GetSessionCooldownInfoByIndex(1, now.Add(time.Minute)); !ok || source != CooldownSourceOfficial || !until.Equal(resetAt) {
+		t.Fatalf("expected sk-b cooldown to follow its key, got %s %s %t", until, source, ok)
+	}
+	if _, ok := after.GetSessionCooldownByIndex(0, now.Add(time.Minute)); ok {
+		t.Fatal("expected new session not to inherit a cooldown")
+	}
+	if breaker, ok := after.GetSessionBreakerByIndex(2, now.Add(time.Minute)); !ok || breaker.State != BreakerStateOpen || breaker.OpenDuration != 300*time.Second {
+		t.Fatalf("expected sk-a breaker to stay open, got %+v", breaker)
+	}
+	if got := restoredStats[1].Stats.TotalRequests; got != 7 || len(restoredStats) != 1 {
+		t.Fatalf("expected sk-b stats at its new index, got %+v", restoredStats)
+	}
+}
+
+func TestRuntimeStateDropsExpiredCooldowns(t *testing.T) {
+	now := time.Date(2026, 7, 8, 8, 0, 0, 0, time.Local)
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	cfg.CooldownSessionAfterRateLimit("sk-a", now.Add(time.Hour), now)
+
+	state := cfg.ExportRuntimeState(nil, now.Add(2*time.Hour))
+	if entry := state.Sessions["sk-a"]; !entry.CooldownUntil.IsZero() {
+		t.Fatalf("expected expired cooldown to be dropped, got %s", entry.CooldownUntil)
+	}
+}
+
+func TestReadRuntimeStateMissingFile(t *testing.T) {
+	state, err := ReadRuntimeState(filepath.Join(t.TempDir(), "missing.json"))
+	if err != nil || len(state.Sessions) != 0 {
+		t.Fatalf("expected empty state for missing file, got %+v, %v", state, err)
+	}
+}
@@ -0,0 +1,217 @@
+package config
+
+import (
+	"claude2api/logger"
+	"math"
+	"math/rand"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	SessionStrategyLeastLoaded      = "least_loaded"
+	SessionStrategyRoundRobin       = "round_robin"
+	SessionStrategyWeighted         = "weighted"
+	SessionStrategyRandom           = "random"
+	SessionStrategyLeastRateLimited = "least_rate_limited"
+	DefaultSessionStrategy          = SessionStrategyLeastLoaded
+)
+
+// SessionCandidate describes one dispatchable session offered to a SessionSelector.
+type SessionCandidate struct {
+	Index      int
+	SessionKey string
+	InFlight   int
+	LastUsedAt time.Time
+	// Distance is the ring distance from the round-robin start index.
+	Distance int
+	Weight   int
+	Stats    logger.SessionStats
+}
+
+// SessionSelector picks one of the candidates and returns its position in the slice.
+// Candidates are never empty and are already filtered for cooldown and concurrency.
+type SessionSelector interface {
+	Select(candidates []SessionCandidate) int
+}
+
+// SessionSelectorFunc adapts a plain function to SessionSelector.
+type SessionSelectorFunc func(candidates []SessionCandidate) int
+
+func (f SessionSelectorFunc) Select(candidates []SessionCandidate) int {
+	return f(candidates)
+}
+
+var (
+	sessionSelectorsMu sync.RWMutex
+	sessionSelectors   = map[string]SessionSelector{
+		SessionStrategyLeastLoaded:      SessionSelectorFunc(selectLeastLoaded),
+		SessionStrategyRoundRobin:       SessionSelectorFunc(selectRoundRobin),
+		SessionStrategyWeighted:         NewWeightedSessionSelector(nil),
+		SessionStrategyRandom:           NewRandomSessionSelector(nil),
+		SessionStrategyLeastRateLimited: SessionSelectorFunc(selectLeastRateLimited),
+	}
+)
+
+// RegisterSessionSelector adds or replaces a named selection strategy.
+func RegisterSessionSelector(name string, selector SessionSelector) {
+	name = normalizeSessionStrategyName(name)
+	if name == "" || selector == nil {
+		return
+	}
+	sessionSelectorsMu.Lock()
+	defer sessionSelectorsMu.Unlock()
+	sessionSelectors[name] = selector
+}
+
+// GetSessionSelector returns the selector for a strategy, falling back to the default.
+func GetSessionSelector(strategy string) SessionSelector {
+	sessionSelectorsMu.RLock()
+	defer sessionSelectorsMu.RUnlock()
+	if selector, ok := sessionSelectors[normalizeSessionStrategyName(strategy)]; ok {
+		return selector
+	}
+	return sessionSelectors[DefaultSessionStrategy]
+}
+
+// SessionStrategies lists the registered strategy names in stable order.
+func SessionStrategies() []string {
+	sessionSelectorsMu.RLock()
+	defer sessionSelectorsMu.RUnlock()
+	names := make([]string, 0, len(sessionSelectors))
+	for name := range sessionSelectors {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func IsValidSessionStrategy(value string) bool {
+	sessionSelectorsMu.RLock()
+	defer sessionSelectorsMu.RUnlock()
+	_, ok := sessionSelectors[normalizeSessionStrategyName(value)]
+	return ok
+}
+
+func NormalizeSessionStrategy(value string) string {
+	if IsValidSessionStrategy(value) {
+		return normalizeSessionStrategyName(value)
+	}
+	return DefaultSessionStrategy
+}
+
+func normalizeSessionStrategyName(value string) string {
+	value = strings.ToLower(strings.TrimSpace(value))
+	return strings.ReplaceAll(value, "-", "_")
+}
+
+// NormalizeSessionWeight treats missing or negative weights as 1.
+func NormalizeSessionWeight(value int) int {
+	if value < 1 {
+		return 1
+	}
+	if value > 100 {
+		return 100
+	}
+	return value
+}
+
+// lessLoaded is the historical ordering: fewest in-flight, then least recently
+// used, then closest to the round-robin start index.
+func lessLoaded(a, b SessionCandidate) bool {
+	if a.InFlight != b.InFlight {
+		return a.InFlight < b.InFlight
+	}
+	if !a.LastUsedAt.Equal(b.LastUsedAt) {
+		return a.LastUsedAt.Before(b.LastUsedAt)
+	}
+	return a.Distance < b.Distance
+}
+
+func selectLeastLoaded(candidates []SessionCandidate) int {
+	best := 0
+	for i := 1; i < len(candidates); i++ {
+		if lessLoaded(candidates[i], candidates[best]) {
+			best = i
+		}
+	}
+	return best
+}
+
+func selectRoundRobin(candidates []SessionCandidate) int {
+	best := 0
+	for i := 1; i < len(candidates); i++ {
+		if candidates[i].Distance < candidates[best].Distance {
+			best = i
+		}
+	}
+	return best
+}
+
+// selectLeastRateLimited prefers sessions that have never been rate limited, then
+// sessions that historically survive the most successes before a 429.
+func selectLeastRateLimited(candidates []SessionCandidate) int {
+	best := 0
+	bestBudget := learnedRateLimitBudget(candidates[0].Stats)
+	for i := 1; i < len(candidates); i++ {
+		budget := learnedRateLimitBudget(candidates[i].Stats)
+		if budget > bestBudget || (budget == bestBudget && lessLoaded(candidates[i], candidates[best])) {
+			best = i
+			bestBudget = budget
+		}
+	}
+	return best
+}
+
+func learnedRateLimitBudget(stats logger.SessionStats) float64 {
+	if stats.RateLimitRequests == 0 {
+		return math.Inf(1)
+	}
+	return stats.AvgSuccessesBeforeRateLimit
+}
+
+type weightedSessionSelector struct {
+	intn func(n int) int
+}
+
+// NewWeightedSessionSelector picks sessions at random in proportion to their weight.
+// intn defaults to math/rand.Intn.
+func NewWeightedSessionSelector(intn func(n int) int) SessionSelector {
+	if intn == nil {
+		intn = rand.Intn
+	}
+	return weightedSessionSelector{intn: intn}
+}
+
+func (s weightedSessionSelector) Select(candidates []SessionCandidate) int {
+	total := 0
+	for _, candidate := range candidates {
+		total += NormalizeSessionWeight(candidate.Weight)
+	}
+	pick := s.intn(total)
+	for i, candidate := range candidates {
+		pick -= NormalizeSessionWeight(candidate.Weight)
+		if pick < 0 {
+			return i
+		}
+	}
+	return len(candidates) - 1
+}
+
+type randomSessionSelector struct {
+	intn func(n int) int
+}
+
+// NewRandomSessionSelector picks a uniformly random session. intn defaults to math/rand.Intn.
+func NewRandomSessionSelector(intn func(n int) int) SessionSelector {
+	if intn == nil {
+		intn = rand.Intn
+	}
+	return randomSessionSelector{intn: intn}
+}
+
+func (s randomSessionSelector) Select(candidates []SessionCandidate) int {
+	return s.intn(len(candidates))
+}
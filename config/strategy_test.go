@@ -0,0 +1,216 @@
+package config
+
+import (
+	"claude2api/logger"
+	"testing"
+	"time"
+)
+
+func TestNormalizeSessionStrategy(t *testing.T) {
+	if got := NormalizeSessionStrategy(""); got != DefaultSessionStrategy {
+		t.Fatalf("expected default strategy, got %s", got)
+	}
+	if got := NormalizeSessionStrategy("Round-Robin"); got != SessionStrategyRoundRobin {
+		t.Fatalf("expected round_robin, got %s", got)
+	}
+	if got := NormalizeSessionStrategy("bogus"); got != DefaultSessionStrategy {
+		t.Fatalf("expected unknown strategy to fall back to default, got %s", got)
+	}
+}
+
+func TestLeastLoadedStrategyPrefersFewestInFlight(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 1, 10, 0, 0, 0, time.Local)
+
+	first := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now, Strategy: SessionStrategyLeastLoaded})
+	if !first.OK || first.Lease.Index != 0 {
+		t.Fatalf("expected first lease on session 0, got ok=%v index=%d", first.OK, first.Lease.Index)
+	}
+	defer first.Lease.Release()
+
+	second := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now.Add(time.Second), Strategy: SessionStrategyLeastLoaded})
+	if !second.OK || second.Lease.Index != 1 {
+		t.Fatalf("expected busier session 0 to be skipped, got index=%d", second.Lease.Index)
+	}
+	second.Lease.Release()
+}
+
+func TestRoundRobinStrategyFollowsStartIndex(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+			{SessionKey: "sk-c"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 1, 10, 0, 0, 0, time.Local)
+
+	first := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 2, Now: now, Strategy: SessionStrategyRoundRobin})
+	if !first.OK || first.Lease.Index != 2 {
+		t.Fatalf("expected round robin to start at session 2, got index=%d", first.Lease.Index)
+	}
+	defer first.Lease.Release()
+
+	// Session 2 still has capacity, so round robin keeps it even though it is busier.
+	second := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 2, Now: now.Add(time.Second), Strategy: SessionStrategyRoundRobin})
+	if !second.OK || second.Lease.Index != 2 {
+		t.Fatalf("expected round robin to ignore load, got index=%d", second.Lease.Index)
+	}
+	defer second.Lease.Release()
+
+	third := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 2, Now: now.Add(2 * time.Second), Strategy: SessionStrategyRoundRobin})
+	if !third.OK || third.Lease.Index != 0 {
+		t.Fatalf("expected saturated session to wrap to session 0, got index=%d", third.Lease.Index)
+	}
+	third.Lease.Release()
+}
+
+func TestWeightedStrategyHonorsSessionWeights(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a", Weight: 1},
+			{SessionKey: "sk-b", Weight: 3},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 1, 10, 0, 0, 0, time.Local)
+
+	picks := []int{0, 1, 3}
+	expected := []int{0, 1, 1}
+	for i, pick := range picks {
+		value := pick
+		selector := NewWeightedSessionSelector(func(n int) int {
+			if n != 4 {
+				t.Fatalf("expected total weight 4, got %d", n)
+			}
+			return value
+		})
+		result := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now, Selector: selector})
+		if !result.OK || result.Lease.Index != expected[i] {
+			t.Fatalf("pick %d: expected session %d, got ok=%v index=%d", pick, expected[i], result.OK, result.Lease.Index)
+		}
+		result.Lease.Release()
+	}
+	if got := cfg.GetGlobalInFlight(); got != 0 {
+		t.Fatalf("expected all weighted leases released, got %d in flight", got)
+	}
+}
+
+func TestRandomStrategyOnlyPicksAvailableSessions(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+			{SessionKey: "sk-c"},
+		},
+		MaxConcurrentPerKey:  1,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 1, 10, 0, 0, 0, time.Local)
+	cfg.CooldownSessionUntil("sk-b", now.Add(time.Hour))
+
+	var offered int
+	selector := NewRandomSessionSelector(func(n int) int {
+		offered = n
+		return n - 1
+	})
+	result := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now, Selector: selector})
+	if !result.OK || result.Lease.Index != 2 {
+		t.Fatalf("expected last available session 2, got ok=%v index=%d", result.OK, result.Lease.Index)
+	}
+	if offered != 2 {
+		t.Fatalf("expected cooling session to be filtered out, got %d candidates", offered)
+	}
+	if result.CoolingCount != 1 {
+		t.Fatalf("expected cooling count 1, got %d", result.CoolingCount)
+	}
+	result.Lease.Release()
+}
+
+func TestLeastRateLimitedStrategyUsesLearnedBudget(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+			{SessionKey: "sk-c"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return map[int]logger.SessionStats{
+				0: {RateLimitRequests: 2, AvgSuccessesBeforeRateLimit: 3},
+				1: {RateLimitRequests: 1, AvgSuccessesBeforeRateLimit: 12},
+				2: {RateLimitRequests: 4, AvgSuccessesBeforeRateLimit: 1},
+			}
+		},
+	}
+	now := time.Date(2026, 7, 1, 10, 0, 0, 0, time.Local)
+
+	result := cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now, Strategy: SessionStrategyLeastRateLimited})
+	if !result.OK || result.Lease.Index != 1 {
+		t.Fatalf("expected session with largest learned budget, got index=%d", result.Lease.Index)
+	}
+	result.Lease.Release()
+
+	cfg.SessionStatsSource = func() map[int]logger.SessionStats {
+		return map[int]logger.SessionStats{
+			0: {RateLimitRequests: 1, AvgSuccessesBeforeRateLimit: 50},
+			1: {RateLimitRequests: 1, AvgSuccessesBeforeRateLimit: 12},
+		}
+	}
+	result = cfg.AcquireSessionLeaseWith(SessionAcquireRequest{StartIndex: 0, Now: now, Strategy: SessionStrategyLeastRateLimited})
+	if !result.OK || result.Lease.Index != 2 {
+		t.Fatalf("expected never rate limited session 2, got index=%d", result.Lease.Index)
+	}
+	result.Lease.Release()
+}
+
+func TestAcquireSessionLeaseUsesConfiguredStrategy(t *testing.T) {
+	cfg := &Config{
+		Sessions: []SessionInfo{
+			{SessionKey: "sk-a"},
+			{SessionKey: "sk-b"},
+		},
+		MaxConcurrentPerKey:  2,
+		MaxGlobalConcurrency: 10,
+		SessionStrategy:      SessionStrategyRoundRobin,
+		SessionStatsSource: func() map[int]logger.SessionStats {
+			return nil
+		},
+	}
+	now := time.Date(2026, 7, 1, 10, 0, 0, 0, time.Local)
+
+	first := cfg.AcquireSessionLease(1, nil, now)
+	if !first.OK || first.Lease.Index != 1 {
+		t.Fatalf("expected configured round robin to honor start index, got index=%d", first.Lease.Index)
+	}
+	defer first.Lease.Release()
+
+	second := cfg.AcquireSessionLease(1, nil, now.Add(time.Second))
+	if !second.OK || second.Lease.Index != 1 {
+		t.Fatalf("expected round robin to reuse session 1 while it has capacity, got index=%d", second.Lease.Index)
+	}
+	second.Lease.Release()
+}
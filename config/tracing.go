@@ -0,0 +1,47 @@
+package config
+
+import "strings"
+
+const (
+	TracingExporterStdout = "stdout"
+	TracingExporterFile   = "file"
+	TracingExporterOTLP   = "otlp"
+
+	DefaultTracingFilePath    = "traces.jsonl"
+	DefaultTracingEndpoint    = "http://localhost:4318/v1/traces"
+	DefaultTracingServiceName = "claude2api"
+)
+
+// TracingConfig enables request tracing. The stdout and file exporters write one JSON
+// span per line and need no collector; otlp posts OTLP/HTTP JSON to Endpoint.
+type TracingConfig struct {
+	Enabled     bool   `yaml:"enabled" json:"enabled"`
+	Exporter    string `yaml:"exporter,omitempty" json:"exporter,omitempty"`
+	FilePath    string `yaml:"filePath,omitempty" json:"file_path,omitempty"`
+	Endpoint    string `yaml:"endpoint,omitempty" json:"endpoint,omitempty"`
+	ServiceName string `yaml:"serviceName,omitempty" json:"service_name,omitempty"`
+}
+
+func NormalizeTracing(settings TracingConfig) TracingConfig {
+	switch strings.ToLower(strings.TrimSpace(settings.Exporter)) {
+	case TracingExporterFile:
+		settings.Exporter = TracingExporterFile
+	case TracingExporterOTLP:
+		settings.Exporter = TracingExporterOTLP
+	default:
+		settings.Exporter = TracingExporterStdout
+	}
+	settings.FilePath = strings.TrimSpace(settings.FilePath)
+	if settings.FilePath == "" {
+		settings.FilePath = DefaultTracingFilePath
+	}
+	settings.Endpoint = strings.TrimSpace(settings.Endpoint)
+	if settings.Endpoint == "" {
+		settings.Endpoint = DefaultTracingEndpoint
+	}
+	settings.ServiceName = strings.TrimSpace(settings.ServiceName)
+	if settings.ServiceName == "" {
+		settings.ServiceName = DefaultTracingServiceName
+	}
+	return settings
+}
@@ -0,0 +1,21 @@
+package config
+
+import "strings"
+
+const DefaultTranscriptDir = "transcripts"
+
+// TranscriptConfig saves the raw completion stream of every request to Dir, with
+// secrets redacted, for replay in core's golden-file tests. Transcripts contain the
+// full conversation text, so this is meant for debugging format drift, not production.
+type TranscriptConfig struct {
+	Enabled bool   `yaml:"enabled" json:"enabled"`
+	Dir     string `yaml:"dir,omitempty" json:"dir,omitempty"`
+}
+
+func NormalizeTranscripts(settings TranscriptConfig) TranscriptConfig {
+	settings.Dir = strings.TrimSpace(settings.Dir)
+	if settings.Dir == "" {
+		settings.Dir = DefaultTranscriptDir
+	}
+	return settings
+}
@@ -0,0 +1,82 @@
+package config
+
+import "strings"
+
+const (
+	DefaultUpstreamBaseURL                      = "https://claude.ai"
+	DefaultUpstreamTimeoutSeconds               = 300
+	DefaultUpstreamResponseHeaderTimeoutSeconds = 10
+)
+
+// UpstreamConfig sets where and how long the client talks to Claude. BaseURL replaces
+// https://claude.ai for the organizations, conversation, completion, upload and account
+// endpoints together, e.g. to point at a local stand-in server for testing.
+// TimeoutSeconds bounds a whole request including the streamed body;
+// ResponseHeaderTimeoutSeconds bounds the wait for the first response headers.
+type UpstreamConfig struct {
+	BaseURL                      string `yaml:"baseURL,omitempty" json:"base_url,omitempty"`
+	TimeoutSeconds               int    `yaml:"timeoutSeconds,omitempty" json:"timeout_seconds,omitempty"`
+	ResponseHeaderTimeoutSeconds int    `yaml:"responseHeaderTimeoutSeconds,omitempty" json:"response_header_timeout_seconds,omitempty"`
+}
+
+func NormalizeUpstream(settings UpstreamConfig) UpstreamConfig {
+	settings = normalizeUpstreamOverride(settings)
+	if settings.BaseURL == "" {
+		settings.BaseURL = DefaultUpstreamBaseURL
+	}
+	if settings.TimeoutSeconds == 0 {
+		settings.TimeoutSeconds = DefaultUpstreamTimeoutSeconds
+	}
+	if settings.ResponseHeaderTimeoutSeconds == 0 {
+		settings.ResponseHeaderTimeoutSeconds = DefaultUpstreamResponseHeaderTimeoutSeconds
+	}
+	return settings
+}
+
+// NormalizeUpstreamOverride cleans a per-model override, leaving unset fields empty so
+// they inherit the global settings.
+func NormalizeUpstreamOverride(settings *UpstreamConfig) *UpstreamConfig {
+	if settings == nil {
+		return nil
+	}
+	normalized := normalizeUpstreamOverride(*settings)
+	if normalized == (UpstreamConfig{}) {
+		return nil
+	}
+	return &normalized
+}
+
+func normalizeUpstreamOverride(settings UpstreamConfig) UpstreamConfig {
+	settings.BaseURL = strings.TrimRight(strings.TrimSpace(settings.BaseURL), "/")
+	if settings.TimeoutSeconds < 0 {
+		settings.TimeoutSeconds = 0
+	}
+	if settings.TimeoutSeconds > 3600 {
+		settings.TimeoutSeconds = 3600
+	}
+	if settings.ResponseHeaderTimeoutSeconds < 0 {
+		settings.ResponseHeaderTimeoutSeconds = 0
+	}
+	if settings.ResponseHeaderTimeoutSeconds > 600 {
+		settings.ResponseHeaderTimeoutSeconds = 600
+	}
+	return settings
+}
+
+// MergeUpstream applies the fields set in a per-model override on top of the global settings.
+func MergeUpstream(global UpstreamConfig, override *UpstreamConfig) UpstreamConfig {
+	merged := NormalizeUpstream(global)
+	if override == nil {
+		return merged
+	}
+	if override.BaseURL != "" {
+		merged.BaseURL = override.BaseURL
+	}
+	if override.TimeoutSeconds > 0 {
+		merged.TimeoutSeconds = override.TimeoutSeconds
+	}
+	if override.ResponseHeaderTimeoutSeconds > 0 {
+		merged.ResponseHeaderTimeoutSeconds = override.ResponseHeaderTimeoutSeconds
+	}
+	return NormalizeUpstream(merged)
+}
@@ -0,0 +1,21 @@
+package config
+
+import "testing"
+
+func TestMergeUpstreamAppliesModelOverride(t *testing.T) {
+	global := UpstreamConfig{BaseURL: "http://127.0.0.1:9000/", ResponseHeaderTimeoutSeconds: 20}
+	override := NormalizeUpstreamOverride(&UpstreamConfig{TimeoutSeconds: 900})
+
+	merged := MergeUpstream(global, override)
+	if merged.BaseURL != "http://127.0.0.1:9000" || merged.TimeoutSeconds != 900 || merged.ResponseHeaderTimeoutSeconds != 20 {
+		t.Fatalf("unexpected merged settings: %+v", merged)
+	}
+	if defaults := MergeUpstream(UpstreamConfig{}, nil); defaults.BaseURL != DefaultUpstreamBaseURL ||
+		defaults.TimeoutSeconds != DefaultUpstreamTimeoutSeconds ||
+		defaults.ResponseHeaderTimeoutSeconds != DefaultUpstreamResponseHeaderTimeoutSeconds {
+		t.Fatalf("unexpected default settings: %+v", defaults)
+	}
+	if NormalizeUpstreamOverride(&UpstreamConfig{BaseURL: "  "}) != nil {
+		t.Fatal("expected an empty override to be dropped")
+	}
+}
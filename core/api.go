@@ -1,10 +1,10 @@
 package core
 
 import (
-	"bufio"
 	"claude2api/config"
 	"claude2api/logger"
-	"claude2api/model"
+	"claude2api/tracing"
+	"context"
 	"encoding/base64"
 	"encoding/json"
 	"errors"
@@ -30,6 +30,33 @@ type Client struct {
 	thinkingMode string
 	effortLevel  string
 	defaultAttrs map[string]interface{}
+	// onMessageLimit receives quota updates parsed from the completion stream.
+	onMessageLimit func(MessageLimit)
+	// onFirstToken fires once, when the first content delta arrives.
+	onFirstToken func()
+	// onUpstreamStatus receives the status code of every response from claude.ai.
+	onUpstreamStatus func(int)
+	// ctx carries the caller's trace span; upstream calls are traced as its children.
+	ctx context.Context
+	// onStage receives the duration of each pipeline stage, named by the logger.Stage* constants.
+	onStage func(stage string, elapsed time.Duration)
+	// sendStartedAt and firstByteAt time the completion call for the first token and stream stages.
+	sendStartedAt time.Time
+	firstByteAt   time.Time
+	// log carries request fields such as request_id into the client's log lines.
+	log *logger.Entry
+	// heartbeatInterval and heartbeatNonStream configure keepalives, see WithHeartbeat.
+	heartbeatInterval  time.Duration
+	heartbeatNonStream bool
+	// baseURL replaces https://claude.ai in every upstream URL, see WithUpstream.
+	baseURL string
+	// transcriptDir receives a redacted copy of every completion stream, see WithTranscriptRecording.
+	transcriptDir string
+	// timeout and responseHeaderTimeout configure the transport, see WithUpstream.
+	timeout               time.Duration
+	responseHeaderTimeout time.Duration
+	// pool shares transports between clients of the same session, see WithClientPool.
+	pool *ClientPool
 }
 
 type ResponseEvent struct {
@@ -44,14 +71,23 @@ type ResponseEvent struct {
 		THINKING string `json:"thinking"`
 		// partial_json
 		PartialJSON string `json:"partial_json"`
+		// stop_reason arrives on message_delta
+		StopReason string `json:"stop_reason"`
 	} `json:"delta"`
 	Error struct {
+		Type    string `json:"type"`
 		Message string `json:"message"`
 	} `json:"error"`
 }
 
 const maxCitationSources = 10
 
+const (
+	defaultBaseURL               = "https://claude.ai"
+	defaultTimeout               = 5 * time.Minute
+	defaultResponseHeaderTimeout = 10 * time.Second
+)
+
 type citationSource struct {
 	Title string
 	URL   string
@@ -206,6 +242,11 @@ type APIError struct {
 	Message          string
 	Retryable        bool
 	RateLimitResetAt time.Time
+	// AuthFailed marks 401/403 responses, which usually mean the session key is dead.
+	AuthFailed bool
+	// StreamErrorType is the type of an error event Claude sent inside a completion
+	// stream, such as "overloaded_error"; it is empty for every other error.
+	StreamErrorType string
 }
 
 func (e *APIError) Error() string {
@@ -227,6 +268,32 @@ func NewRateLimitAPIError(message string, resetAt time.Time) error {
 	}
 }
 
+func NewAuthAPIError(message string) error {
+	return &APIError{
+		Message:    message,
+		AuthFailed: true,
+	}
+}
+
+// NewStreamAPIError reports an error event Claude sent after answering 200. Only invalid
+// requests are final; overloads and other upstream errors may succeed on another session.
+func NewStreamAPIError(errorType string, message string) error {
+	if errorType == "" {
+		errorType = "error"
+	}
+	return &APIError{
+		Message:         fmt.Sprintf("claude stream error (%s): %s", errorType, message),
+		Retryable:       errorType != "invalid_request_error",
+		StreamErrorType: errorType,
+	}
+}
+
+// IsStreamError reports whether err came from an error event inside a completion stream.
+func IsStreamError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.StreamErrorType != ""
+}
+
 func GetRateLimitResetAt(err error) (time.Time, bool) {
 	var apiErr *APIError
 	if !errors.As(err, &apiErr) || apiErr.RateLimitResetAt.IsZero() {
@@ -256,6 +323,19 @@ func IsRetryableError(err error) bool {
 		strings.Contains(lowerErr, "unexpected eof")
 }
 
+// ErrClientCancelled is returned when the client disconnected before the response finished.
+var ErrClientCancelled = errors.New("client cancelled request")
+
+func IsClientCancelledError(err error) bool {
+	return errors.Is(err, ErrClientCancelled)
+}
+
+// IsAuthError reports whether Claude rejected the session's credentials.
+func IsAuthError(err error) bool {
+	var apiErr *APIError
+	return errors.As(err, &apiErr) && apiErr.AuthFailed
+}
+
 func IsRateLimitError(err error) bool {
 	if err == nil {
 		return false
@@ -294,65 +374,150 @@ func WithThinkingOptions(thinkingMode string, effortLevel string) ClientOption {
 	}
 }
 
+// WithFirstTokenHandler registers a callback for the first text, thinking or tool delta.
+func WithFirstTokenHandler(handler func()) ClientOption {
+	return func(c *Client) {
+		c.onFirstToken = handler
+	}
+}
+
+// WithUpstreamStatusHandler registers a callback for the status code of every upstream response.
+func WithUpstreamStatusHandler(handler func(statusCode int)) ClientOption {
+	return func(c *Client) {
+		c.onUpstreamStatus = handler
+	}
+}
+
+// WithContext ties the client's upstream calls to ctx, e.g. for tracing.
+func WithContext(ctx context.Context) ClientOption {
+	return func(c *Client) {
+		c.ctx = ctx
+	}
+}
+
+// WithStageHandler registers a callback for per-stage timings of a chat request.
+func WithStageHandler(handler func(stage string, elapsed time.Duration)) ClientOption {
+	return func(c *Client) {
+		c.onStage = handler
+	}
+}
+
+// WithLogEntry makes the client log through entry, so its lines carry the request's fields.
+func WithLogEntry(entry *logger.Entry) ClientOption {
+	return func(c *Client) {
+		c.log = entry
+	}
+}
+
+func (c *Client) logEntry() *logger.Entry {
+	if c.log == nil {
+		return logger.WithFields(nil)
+	}
+	return c.log
+}
+
+// recordStage reports the time since start for a stage. It is meant to be deferred with
+// time.Now() as start.
+func (c *Client) recordStage(stage string, start time.Time) {
+	if c.onStage != nil {
+		c.onStage(stage, time.Since(start))
+	}
+}
+
+// startSpan starts a child span of the client's context for one upstream call.
+func (c *Client) startSpan(name string) *tracing.Span {
+	ctx := c.ctx
+	if ctx == nil {
+		ctx = context.Background()
+	}
+	_, span := tracing.Start(ctx, name)
+	span.SetAttribute("model", c.model)
+	return span
+}
+
+func endSpan(span *tracing.Span, err *error) {
+	span.RecordError(*err)
+	span.End()
+}
+
+// WithUpstream points the client at baseURL instead of https://claude.ai and sets its
+// total and response header timeouts. Zero values keep the defaults.
+func WithUpstream(baseURL string, timeout time.Duration, responseHeaderTimeout time.Duration) ClientOption {
+	return func(c *Client) {
+		if baseURL = strings.TrimRight(baseURL, "/"); baseURL != "" {
+			c.baseURL = baseURL
+		}
+		if timeout > 0 {
+			c.timeout = timeout
+		}
+		if responseHeaderTimeout > 0 {
+			c.responseHeaderTimeout = responseHeaderTimeout
+		}
+	}
+}
+
+// NewClientFromSession creates a client for one chat request. Its transport, with the
+// session's cookies and the browser fingerprint, is new unless WithClientPool is given.
 func NewClientFromSession(session config.SessionInfo, proxy string, model string, opts ...ClientOption) *Client {
-	client := req.C().ImpersonateChrome().SetTimeout(time.Minute * 5)
-	client.Transport.SetResponseHeaderTimeout(time.Second * 10)
-	if proxy != "" {
-		client.SetProxyURL(proxy)
-	}
-	// Set common headers
-	headers := map[string]string{
-		"accept":                    "text/event-stream, text/event-stream",
-		"accept-language":           "zh-CN,zh;q=0.9",
-		"anthropic-client-platform": "web_claude_ai",
-		"content-type":              "application/json",
-		"origin":                    "https://claude.ai",
-		"priority":                  "u=1, i",
-	}
-	for key, value := range headers {
-		client.SetCommonHeader(key, value)
-	}
-	applySessionCookies(client, session)
-	// Create default client with session key
 	c := &Client{
-		SessionKey: session.SessionKey,
-		client:     client,
-		model:      model,
-		defaultAttrs: map[string]interface{}{
-			"personalized_styles": []map[string]interface{}{
-				{
-					"type":       "default",
-					"key":        "Default",
-					"name":       "Normal",
-					"nameKey":    "normal_style_name",
-					"prompt":     "Normal",
-					"summary":    "Default responses from Claude",
-					"summaryKey": "normal_style_summary",
-					"isDefault":  true,
-				},
-			},
-			"tools": []map[string]interface{}{
-				{
-					"type": "web_search_v0",
-					"name": "web_search",
-				},
-				{"type": "artifacts_v0", "name": "artifacts"},
-				{"type": "repl_v0", "name": "repl"},
-			},
-			"parent_message_uuid": "00000000-0000-4000-8000-000000000000",
-			"attachments":         []interface{}{},
-			"files":               []interface{}{},
-			"sync_sources":        []interface{}{},
-			"rendering_mode":      "messages",
-			"timezone":            "America/Los_Angeles",
-		},
+		SessionKey:            session.SessionKey,
+		model:                 model,
+		baseURL:               defaultBaseURL,
+		timeout:               defaultTimeout,
+		responseHeaderTimeout: defaultResponseHeaderTimeout,
+		defaultAttrs:          newCompletionAttrs(),
 	}
 	for _, opt := range opts {
 		opt(c)
 	}
+	settings := transportSettings{
+		session:               session,
+		proxy:                 proxy,
+		baseURL:               c.baseURL,
+		timeout:               c.timeout,
+		responseHeaderTimeout: c.responseHeaderTimeout,
+	}
+	if c.pool != nil {
+		c.client = c.pool.transport(settings, c.logEntry())
+	} else {
+		c.client = newTransport(settings, c.logEntry())
+	}
 	return c
 }
 
+// newCompletionAttrs returns the completion request fields sent with every prompt. They
+// are per request, since uploads and large contexts add to them.
+func newCompletionAttrs() map[string]interface{} {
+	return map[string]interface{}{
+		"personalized_styles": []map[string]interface{}{
+			{
+				"type":       "default",
+				"key":        "Default",
+				"name":       "Normal",
+				"nameKey":    "normal_style_name",
+				"prompt":     "Normal",
+				"summary":    "Default responses from Claude",
+				"summaryKey": "normal_style_summary",
+				"isDefault":  true,
+			},
+		},
+		"tools": []map[string]interface{}{
+			{
+				"type": "web_search_v0",
+				"name": "web_search",
+			},
+			{"type": "artifacts_v0", "name": "artifacts"},
+			{"type": "repl_v0", "name": "repl"},
+		},
+		"parent_message_uuid": "00000000-0000-4000-8000-000000000000",
+		"attachments":         []interface{}{},
+		"files":               []interface{}{},
+		"sync_sources":        []interface{}{},
+		"rendering_mode":      "messages",
+		"timezone":            "America/Los_Angeles",
+	}
+}
+
 func normalizeWebThinkingMode(mode string) string {
 	switch strings.ToLower(strings.TrimSpace(mode)) {
 	case "enabled", "on", "extended", "thinking":
@@ -379,7 +544,7 @@ func isUnsupportedRequestShapeStatus(statusCode int) bool {
 	return statusCode == http.StatusBadRequest || statusCode == http.StatusUnprocessableEntity
 }
 
-func applySessionCookies(client *req.Client, session config.SessionInfo) {
+func applySessionCookies(client *req.Client, session config.SessionInfo, log *logger.Entry) {
 	cookies := []*http.Cookie{
 		{
 			Name:  "sessionKey",
@@ -392,7 +557,7 @@ func applySessionCookies(client *req.Client, session config.SessionInfo) {
 			Name:  "cf_clearance",
 			Value: session.CFClearance,
 		})
-		logger.Info("Applied cf_clearance cookie for Claude session")
+		log.Info("Applied cf_clearance cookie for Claude session")
 	}
 
 	for _, cookie := range parseCookieString(session.CookieString) {
@@ -443,31 +608,51 @@ func parseCookieString(raw string) []*http.Cookie {
 func (c *Client) SetOrgID(orgID string) {
 	c.orgID = orgID
 }
-func (c *Client) GetOrgID() (string, error) {
-	url := "https://claude.ai/api/organizations"
-	resp, err := c.client.R().
-		SetHeader("referer", "https://claude.ai/new").
+
+// Organization is one claude.ai organization the session belongs to.
+type Organization struct {
+	ID            int    `json:"id"`
+	UUID          string `json:"uuid"`
+	Name          string `json:"name"`
+	RateLimitTier string `json:"rate_limit_tier"`
+}
+
+// GetOrganizations lists the session's organizations. It is a cheap authenticated call
+// that does not use message quota, so it doubles as a liveness check.
+func (c *Client) GetOrganizations() (orgs []Organization, err error) {
+	span := c.startSpan("claude.get_organizations")
+	defer endSpan(span, &err)
+	defer c.recordStage(logger.StageOrgLookup, time.Now())
+	url := c.baseURL + "/api/organizations"
+	resp, err := c.newRequest(context.Background()).
+		SetHeader("referer", c.baseURL+"/new").
 		Get(url)
 	if err != nil {
-		return "", NewAPIError(fmt.Sprintf("request failed: %v", err), true)
+		return nil, NewAPIError(fmt.Sprintf("request failed: %v", err), true)
 	}
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return "", NewAPIError(fmt.Sprintf("failed to get organizations: unauthorized status code %d", resp.StatusCode), false)
+		return nil, NewAuthAPIError(fmt.Sprintf("failed to get organizations: unauthorized status code %d", resp.StatusCode))
 	}
 	if resp.StatusCode != http.StatusOK {
-		return "", NewAPIError(fmt.Sprintf("failed to get organizations: unexpected status code %d", resp.StatusCode), resp.StatusCode >= http.StatusInternalServerError)
-	}
-	type OrgResponse []struct {
-		ID            int    `json:"id"`
-		UUID          string `json:"uuid"`
-		Name          string `json:"name"`
-		RateLimitTier string `json:"rate_limit_tier"`
+		return nil, NewAPIError(fmt.Sprintf("failed to get organizations: unexpected status code %d", resp.StatusCode), resp.StatusCode >= http.StatusInternalServerError)
 	}
 
-	var orgs OrgResponse
 	if err := json.Unmarshal(resp.Bytes(), &orgs); err != nil {
-		return "", fmt.Errorf("failed to parse response: %w", err)
+		return nil, fmt.Errorf("failed to parse response: %w", err)
+	}
+	return orgs, nil
+}
+
+func (c *Client) GetOrgID() (string, error) {
+	orgs, err := c.GetOrganizations()
+	if err != nil {
+		return "", err
 	}
+	return SelectOrgID(orgs)
+}
+
+// SelectOrgID picks the organization used for chats: the only one, or the default personal tier.
+func SelectOrgID(orgs []Organization) (string, error) {
 	if len(orgs) == 0 {
 		return "", errors.New("no organizations found")
 	}
@@ -480,15 +665,16 @@ func (c *Client) GetOrgID() (string, error) {
 		}
 	}
 	return "", errors.New("no default organization found")
-
 }
 
 // CreateConversation creates a new conversation and returns its UUID
-func (c *Client) CreateConversation() (string, error) {
+func (c *Client) CreateConversation() (conversationID string, err error) {
+	span := c.startSpan("claude.create_conversation")
+	defer endSpan(span, &err)
 	if c.orgID == "" {
 		return "", errors.New("organization ID not set")
 	}
-	url := fmt.Sprintf("https://claude.ai/api/organizations/%s/chat_conversations", c.orgID)
+	url := c.baseURL + fmt.Sprintf("/api/organizations/%s/chat_conversations", c.orgID)
 	thinkingMode := c.thinkingMode
 	hasThinkingSuffix := strings.HasSuffix(c.model, "-think")
 	// 如果以-think结尾
@@ -501,22 +687,23 @@ func (c *Client) CreateConversation() (string, error) {
 		}
 		c.thinkingMode = thinkingMode
 		if err := c.UpdateUserSetting("paprika_mode", thinkingMode); err != nil {
-			logger.Error(fmt.Sprintf("Failed to update paprika_mode: %v", err))
+			c.logEntry().Error(fmt.Sprintf("Failed to update paprika_mode: %v", err))
 		}
 	} else {
 		if err := c.UpdateUserSetting("paprika_mode", nil); err != nil {
-			logger.Error(fmt.Sprintf("Failed to update paprika_mode: %v", err))
+			c.logEntry().Error(fmt.Sprintf("Failed to update paprika_mode: %v", err))
 		}
 	}
 	if c.effortLevel != "" {
 		if err := c.UpdateUserSetting("effort_level", c.effortLevel); err != nil {
-			logger.Error(fmt.Sprintf("Failed to update effort_level: %v", err))
+			c.logEntry().Error(fmt.Sprintf("Failed to update effort_level: %v", err))
 		}
 	} else {
 		if err := c.UpdateUserSetting("effort_level", nil); err != nil {
-			logger.Error(fmt.Sprintf("Failed to clear effort_level: %v", err))
+			c.logEntry().Error(fmt.Sprintf("Failed to clear effort_level: %v", err))
 		}
 	}
+	defer c.recordStage(logger.StageConversation, time.Now())
 	requestBody := map[string]interface{}{
 		"model":                            c.model,
 		"uuid":                             uuid.New().String(),
@@ -534,28 +721,28 @@ func (c *Client) CreateConversation() (string, error) {
 		delete(requestBody, "model")
 	}
 
-	resp, err := c.client.R().
-		SetHeader("referer", "https://claude.ai/new").
+	resp, err := c.newRequest(context.Background()).
+		SetHeader("referer", c.baseURL+"/new").
 		SetBody(requestBody).
 		Post(url)
 	if err != nil {
 		return "", NewAPIError(fmt.Sprintf("request failed: %v", err), true)
 	}
 	if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-		return "", NewAPIError(fmt.Sprintf("failed to create conversation: unauthorized status code %d", resp.StatusCode), false)
+		return "", NewAuthAPIError(fmt.Sprintf("failed to create conversation: unauthorized status code %d", resp.StatusCode))
 	}
 	if isUnsupportedRequestShapeStatus(resp.StatusCode) && (thinkingMode != "" || c.effortLevel != "") {
 		delete(requestBody, "thinking_mode")
 		delete(requestBody, "effort_level")
-		resp, err = c.client.R().
-			SetHeader("referer", "https://claude.ai/new").
+		resp, err = c.newRequest(context.Background()).
+			SetHeader("referer", c.baseURL+"/new").
 			SetBody(requestBody).
 			Post(url)
 		if err != nil {
 			return "", NewAPIError(fmt.Sprintf("request failed: %v", err), true)
 		}
 		if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
-			return "", NewAPIError(fmt.Sprintf("failed to create conversation: unauthorized status code %d", resp.StatusCode), false)
+			return "", NewAuthAPIError(fmt.Sprintf("failed to create conversation: unauthorized status code %d", resp.StatusCode))
 		}
 	}
 	if resp.StatusCode != http.StatusCreated {
@@ -570,16 +757,36 @@ func (c *Client) CreateConversation() (string, error) {
 	if !ok {
 		return "", errors.New("conversation UUID not found in response")
 	}
-	logger.Info(fmt.Sprintf("Created Claude conversation: %s", uuid))
+	c.logEntry().Info(fmt.Sprintf("Created Claude conversation: %s", uuid))
 	return uuid, nil
 }
 
-// SendMessage sends a message to a conversation and returns token info and error
+// SendMessage sends a message to a conversation and writes the answer to gc in OpenAI format
 func (c *Client) SendMessage(conversationID string, message string, stream bool, gc *gin.Context) (*TokenInfo, error) {
+	return c.sendMessage(gc.Request.Context(), conversationID, message, stream, func(body io.ReadCloser) (*TokenInfo, error) {
+		return c.HandleResponse(body, stream, gc)
+	})
+}
+
+// Complete sends a message to a conversation and passes the answer to emit as typed
+// events, without an HTTP response to write to. Cancelling ctx stops the generation.
+func (c *Client) Complete(ctx context.Context, conversationID string, message string, emit func(Event)) (*TokenInfo, error) {
+	return c.sendMessage(ctx, conversationID, message, true, func(body io.ReadCloser) (*TokenInfo, error) {
+		return c.StreamEvents(ctx, body, emit)
+	})
+}
+
+// sendMessage posts a completion request and hands the stream to consume once Claude
+// has answered 200.
+func (c *Client) sendMessage(ctx context.Context, conversationID string, message string, stream bool, consume func(body io.ReadCloser) (*TokenInfo, error)) (tokenInfo *TokenInfo, err error) {
+	span := c.startSpan("claude.send_message")
+	span.SetAttribute("claude.conversation_id", conversationID)
+	span.SetAttribute("stream", stream)
+	defer endSpan(span, &err)
 	if c.orgID == "" {
 		return nil, errors.New("organization ID not set")
 	}
-	url := fmt.Sprintf("https://claude.ai/api/organizations/%s/chat_conversations/%s/completion",
+	url := c.baseURL + fmt.Sprintf("/api/organizations/%s/chat_conversations/%s/completion",
 		c.orgID, conversationID)
 	// Create request body with default attributes
 	requestBody := c.defaultAttrs
@@ -593,16 +800,18 @@ func (c *Client) SendMessage(conversationID string, message string, stream bool,
 	if c.model != "claude-sonnet-4-20250514" && c.model != "claude-sonnet-4-6-20260217" {
 		requestBody["model"] = c.model
 	}
+	c.sendStartedAt = time.Now()
+	c.firstByteAt = time.Time{}
 	// Set up streaming response
-	resp, err := c.client.R().DisableAutoReadResponse().
-		SetHeader("referer", fmt.Sprintf("https://claude.ai/chat/%s", conversationID)).
+	resp, err := c.newRequest(ctx).DisableAutoReadResponse().
+		SetHeader("referer", c.baseURL+"/chat/"+conversationID).
 		SetHeader("accept", "text/event-stream, text/event-stream").
 		SetHeader("anthropic-client-platform", "web_claude_ai").
 		SetHeader("cache-control", "no-cache").
 		SetBody(requestBody).
 		Post(url)
 	if err != nil {
-		return nil, NewAPIError(fmt.Sprintf("request failed: %v", err), true)
+		return nil, c.completionFailed(ctx, conversationID, err)
 	}
 	if isUnsupportedRequestShapeStatus(resp.StatusCode) && (c.thinkingMode != "" || c.effortLevel != "") {
 		if resp.Body != nil {
@@ -610,21 +819,23 @@ func (c *Client) SendMessage(conversationID string, message string, stream bool,
 		}
 		delete(requestBody, "thinking_mode")
 		delete(requestBody, "effort_level")
-		resp, err = c.client.R().DisableAutoReadResponse().
-			SetHeader("referer", fmt.Sprintf("https://claude.ai/chat/%s", conversationID)).
+		resp, err = c.newRequest(ctx).DisableAutoReadResponse().
+			SetHeader("referer", c.baseURL+"/chat/"+conversationID).
 			SetHeader("accept", "text/event-stream, text/event-stream").
 			SetHeader("anthropic-client-platform", "web_claude_ai").
 			SetHeader("cache-control", "no-cache").
 			SetBody(requestBody).
 			Post(url)
 		if err != nil {
-			return nil, NewAPIError(fmt.Sprintf("request failed: %v", err), true)
+			return nil, c.completionFailed(ctx, conversationID, err)
 		}
 	}
-	logger.Info(fmt.Sprintf("Claude response status code: %d", resp.StatusCode))
+	c.firstByteAt = time.Now()
+	c.recordStage(logger.StageFirstByte, c.sendStartedAt)
+	c.logEntry().Info(fmt.Sprintf("Claude response status code: %d", resp.StatusCode))
 	if resp.StatusCode == http.StatusTooManyRequests {
 		// Try to parse rate limit reset time from headers or response body
-		resetAt, resetInfo := parseRateLimitReset(resp)
+		resetAt, resetInfo := parseRateLimitReset(resp, c.logEntry())
 		if resetInfo != "" {
 			return nil, NewRateLimitAPIError(fmt.Sprintf("rate limit exceeded - reset at: %s", resetInfo), resetAt)
 		}
@@ -634,9 +845,9 @@ func (c *Client) SendMessage(conversationID string, message string, stream bool,
 		bodyBytes, _ := io.ReadAll(resp.Body)
 		resp.Body.Close()
 		if len(bodyBytes) > 0 {
-			return nil, NewAPIError(fmt.Sprintf("authentication failed: %s", string(bodyBytes)), false)
+			return nil, NewAuthAPIError(fmt.Sprintf("authentication failed: %s", string(bodyBytes)))
 		}
-		return nil, NewAPIError(fmt.Sprintf("authentication failed with status code %d", resp.StatusCode), false)
+		return nil, NewAuthAPIError(fmt.Sprintf("authentication failed with status code %d", resp.StatusCode))
 	}
 	if resp.StatusCode != http.StatusOK {
 		// Try to read error body for more details
@@ -647,11 +858,49 @@ func (c *Client) SendMessage(conversationID string, message string, stream bool,
 		}
 		return nil, NewAPIError(fmt.Sprintf("unexpected status code: %d", resp.StatusCode), resp.StatusCode >= http.StatusInternalServerError)
 	}
-	return c.HandleResponse(resp.Body, stream, gc)
+	tokenInfo, err = consume(c.recordTranscript(resp.Body, conversationID, stream))
+	if IsClientCancelledError(err) {
+		c.StopResponse(conversationID)
+	}
+	return tokenInfo, err
+}
+
+// completionFailed maps a failed completion request to ErrClientCancelled, stopping the
+// generation, when the failure came from the client going away.
+func (c *Client) completionFailed(ctx context.Context, conversationID string, err error) error {
+	if ctx.Err() != nil {
+		c.StopResponse(conversationID)
+		return ErrClientCancelled
+	}
+	return NewAPIError(fmt.Sprintf("request failed: %v", err), true)
+}
+
+// StopResponse asks Claude to stop generating in a conversation, so an abandoned
+// request does not keep consuming quota. Failures are only logged.
+func (c *Client) StopResponse(conversationID string) {
+	span := c.startSpan("claude.stop_response")
+	defer span.End()
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	url := c.baseURL + fmt.Sprintf("/api/organizations/%s/chat_conversations/%s/stop_response",
+		c.orgID, conversationID)
+	resp, err := c.newRequest(ctx).
+		SetHeader("referer", c.baseURL+"/chat/"+conversationID).
+		Post(url)
+	if err != nil {
+		span.RecordError(err)
+		c.logEntry().Error(fmt.Sprintf("Failed to stop Claude response: %v", err))
+		return
+	}
+	if resp.StatusCode != http.StatusOK && resp.StatusCode != http.StatusNoContent {
+		c.logEntry().Error(fmt.Sprintf("Failed to stop Claude response: unexpected status code %d", resp.StatusCode))
+		return
+	}
+	c.logEntry().Info(fmt.Sprintf("Stopped Claude response for conversation %s", conversationID))
 }
 
 // parseRateLimitReset attempts to extract rate limit reset time from response.
-func parseRateLimitReset(resp *req.Response) (time.Time, string) {
+func parseRateLimitReset(resp *req.Response, log *logger.Entry) (time.Time, string) {
 	now := time.Now()
 
 	// Try standard Retry-After header (seconds or date)
@@ -692,7 +941,7 @@ func parseRateLimitReset(resp *req.Response) (time.Time, string) {
 					if isUsableRateLimitReset(resetAt, now) {
 						return resetAt, formatRateLimitResetAt(resetAt)
 					}
-					logger.Info("Ignoring unusable rate limit reset candidate from response JSON")
+					log.Info("Ignoring unusable rate limit reset candidate from response JSON")
 				}
 			}
 			bodyText := string(bodyBytes)
@@ -700,7 +949,7 @@ func parseRateLimitReset(resp *req.Response) (time.Time, string) {
 				if isUsableRateLimitReset(resetAt, now) {
 					return resetAt, formatRateLimitResetAt(resetAt)
 				}
-				logger.Info("Ignoring unusable rate limit reset candidate from response text")
+				log.Info("Ignoring unusable rate limit reset candidate from response text")
 			}
 		}
 	}
@@ -859,197 +1108,10 @@ func parseClockResetTime(raw string, now time.Time) (time.Time, bool) {
 	return time.Time{}, false
 }
 
-// HandleResponse converts Claude's SSE format to OpenAI format and writes to the response writer
-func (c *Client) HandleResponse(body io.ReadCloser, stream bool, gc *gin.Context) (*TokenInfo, error) {
-	defer body.Close()
-	// Set headers for streaming
-	if stream {
-		gc.Writer.Header().Set("Content-Type", "text/event-stream")
-		gc.Writer.Header().Set("Cache-Control", "no-cache")
-		gc.Writer.Header().Set("Connection", "keep-alive")
-		// 发送200状态码
-		gc.Writer.WriteHeader(http.StatusOK)
-		gc.Writer.Flush()
-	}
-	scanner := bufio.NewScanner(body)
-	clientDone := gc.Request.Context().Done()
-	// Keep track of the full response for the final message
-	thinkingShown := false
-	res_all_text := ""
-	partial_json_shown := false
-	useTool := false
-	useToolEnd := false
-	nextLanguage := false
-	languageStr := "md"
-	citations := newCitationCollector()
-	// Token tracking
-	inputTokens := 0
-	outputTokens := 0
-	for scanner.Scan() {
-		select {
-		case <-clientDone:
-			// 客户端已断开连接，清理资源并退出
-			logger.Info("Client closed connection")
-			return &TokenInfo{InputTokens: inputTokens, OutputTokens: outputTokens}, nil
-		default:
-			// 继续处理响应
-		}
-		line := scanner.Text()
-		// logger.Info(fmt.Sprintf("Claude SSE line: %s", line))
-		if !strings.HasPrefix(line, "data: ") {
-			continue
-		}
-		data := line[6:]
-		if data == "[DONE]" {
-			break
-		}
-		var rawEvent map[string]interface{}
-		if err := json.Unmarshal([]byte(data), &rawEvent); err == nil {
-			citations.AddFrom(rawEvent)
-		}
-		var event ResponseEvent
-		if err := json.Unmarshal([]byte(data), &event); err == nil {
-			if event.Type == "error" && event.Error.Message != "" {
-				model.ReturnOpenAIResponse(event.Error.Message, stream, gc)
-				return &TokenInfo{InputTokens: inputTokens, OutputTokens: outputTokens}, nil
-			}
-			if event.ContentBlock.Type == "tool_use" {
-				useTool = true
-			}
-			if event.ContentBlock.Type == "tool_result" {
-				useToolEnd = true
-			}
-			if event.Type == "content_block_stop" {
-				res_text := ""
-				if thinkingShown {
-					res_text = "</think>\n"
-					thinkingShown = false
-				}
-				if partial_json_shown {
-					res_text = "\n```\n"
-					partial_json_shown = false
-				}
-				res_all_text += res_text
-				if !stream {
-					continue
-				}
-				model.ReturnOpenAIResponse(res_text, stream, gc)
-				continue
-			}
-			if event.Delta.Type == "text_delta" && event.Delta.Text != "" {
-				res_text := event.Delta.Text
-				res_all_text += res_text
-				if !stream {
-					continue
-				}
-				model.ReturnOpenAIResponse(res_text, stream, gc)
-				continue
-			}
-			if event.Delta.Type == "thinking_delta" {
-				res_text := event.Delta.THINKING
-				if !thinkingShown {
-					res_text = "<think> " + res_text
-					thinkingShown = true
-				}
-				res_all_text += res_text
-				if !stream {
-					continue
-				}
-				model.ReturnOpenAIResponse(res_text, stream, gc)
-				continue
-			}
-			if event.Delta.Type == "input_json_delta" {
-				res_text := event.Delta.PartialJSON
-				//结束使用工具了
-				if useTool && res_text == ",\"content\":" {
-					useTool = false
-					partial_json_shown = false
-					continue
-				}
-				//获取语言,下一次就是了
-				if res_text == ",\"language\":" || res_text == ",\"type\":" {
-					nextLanguage = true
-					continue
-				}
-				//获取语言注入
-				if nextLanguage {
-					languageStr = res_text[1:]
-					logger.Info(fmt.Sprintf("获取的语言为:%s", languageStr))
-					if languageStr == "text/html" {
-						languageStr = "html"
-					}
-					nextLanguage = false
-				}
-				//使用工具
-				if useTool {
-					logger.Info(fmt.Sprintf("useTool res_text:%s", res_text))
-					continue
-				}
-				//使用了工具结束拉
-				if useToolEnd {
-					useToolEnd = false
-					continue
-				}
-				//存在代码首字母为"的情况,特殊处理
-				if strings.HasPrefix(res_text, "\"") {
-					res_text = res_text[1:]
-				}
-				//可能会存在多出一个}的情况
-				if res_text == "\"}" || res_text == "}" {
-					res_text = ""
-				}
-				//转义
-				unquote, err := strconv.Unquote(fmt.Sprintf("\"%s\"", res_text))
-				if err == nil {
-					res_text = unquote
-				} else {
-					logger.Error(fmt.Sprintf("转化出错:%s", err.Error()))
-					res_text = strings.ReplaceAll(res_text, "\\\\n", "")
-					res_text = strings.ReplaceAll(res_text, "\\\\u", "\\u")
-					res_text = strings.ReplaceAll(res_text, "\\\"", "\"")
-					res_text = strings.ReplaceAll(res_text, "\\\\'", "'")
-					res_text = strings.ReplaceAll(res_text, "\\n", "\n")
-					res_text = strings.ReplaceAll(res_text, "\\t", "\t")
-					res_text = decodeUnicodeEscape(res_text)
-				}
-
-				if !partial_json_shown {
-					res_text = "\n```" + languageStr + "\n" + res_text
-					partial_json_shown = true
-				}
-				res_all_text += res_text
-				if !stream {
-					continue
-				}
-				model.ReturnOpenAIResponse(res_text, stream, gc)
-				continue
-			}
-		}
-	}
-	if err := scanner.Err(); err != nil {
-		return nil, fmt.Errorf("error reading response: %w", err)
-	}
-	sourceMarkdown := citations.Markdown()
-	if sourceMarkdown != "" {
-		res_all_text += sourceMarkdown
-		if stream {
-			model.ReturnOpenAIResponse(sourceMarkdown, stream, gc)
-		}
-	}
-	if !stream {
-		model.ReturnOpenAIResponseWithAnnotations(res_all_text, stream, citations.Annotations(), gc)
-	} else {
-		// 发送结束标志
-		gc.Writer.Write([]byte("data: [DONE]\n\n"))
-		gc.Writer.Flush()
-	}
-
-	// Estimate tokens: roughly 4 characters per token for most languages
-	inputTokens = len(res_all_text) / 4
-	outputTokens = len(res_all_text) / 4
-
-	return &TokenInfo{InputTokens: inputTokens, OutputTokens: outputTokens}, nil
+func isContentDelta(deltaType string) bool {
+	return deltaType == "text_delta" || deltaType == "thinking_delta" || deltaType == "input_json_delta"
 }
+
 func decodeUnicodeEscape(s string) string {
 	var result []rune
 	for i := 0; i < len(s); i++ {
@@ -1074,17 +1136,19 @@ func decodeUnicodeEscape(s string) string {
 }
 
 // DeleteConversation deletes a conversation by ID
-func (c *Client) DeleteConversation(conversationID string) error {
+func (c *Client) DeleteConversation(conversationID string) (err error) {
+	span := c.startSpan("claude.delete_conversation")
+	defer endSpan(span, &err)
 	if c.orgID == "" {
 		return errors.New("organization ID not set")
 	}
-	url := fmt.Sprintf("https://claude.ai/api/organizations/%s/chat_conversations/%s",
+	url := c.baseURL + fmt.Sprintf("/api/organizations/%s/chat_conversations/%s",
 		c.orgID, conversationID)
 	requestBody := map[string]string{
 		"uuid": conversationID,
 	}
-	resp, err := c.client.R().
-		SetHeader("referer", fmt.Sprintf("https://claude.ai/chat/%s", conversationID)).
+	resp, err := c.newRequest(context.Background()).
+		SetHeader("referer", c.baseURL+"/chat/"+conversationID).
 		SetBody(requestBody).
 		Delete(url)
 	if err != nil {
@@ -1098,7 +1162,11 @@ func (c *Client) DeleteConversation(conversationID string) error {
 
 // UploadFile uploads files to Claude and adds them to the client's default attributes
 // fileData should be in the format: data:image/jpeg;base64,/9j/4AA...
-func (c *Client) UploadFile(fileData []string) error {
+func (c *Client) UploadFile(fileData []string) (err error) {
+	span := c.startSpan("claude.upload_file")
+	span.SetAttribute("files", len(fileData))
+	defer endSpan(span, &err)
+	defer c.recordStage(logger.StageUpload, time.Now())
 	if c.orgID == "" {
 		return errors.New("organization ID not set")
 	}
@@ -1156,11 +1224,11 @@ func (c *Client) UploadFile(fileData []string) error {
 		}
 
 		// Create the upload URL
-		url := fmt.Sprintf("https://claude.ai/api/%s/upload", c.orgID)
+		url := c.baseURL + fmt.Sprintf("/api/%s/upload", c.orgID)
 
 		// Create a multipart form request
-		resp, err := c.client.R().
-			SetHeader("referer", "https://claude.ai/new").
+		resp, err := c.newRequest(context.Background()).
+			SetHeader("referer", c.baseURL+"/new").
 			SetHeader("anthropic-client-platform", "web_claude_ai").
 			SetFileBytes("file", filename, fileBytes).
 			SetContentType("multipart/form-data").
@@ -1207,8 +1275,12 @@ func (c *Client) SetBigContext(context string) {
 }
 
 // / UpdateUserSetting updates a single user setting on Claude.ai while preserving all other settings
-func (c *Client) UpdateUserSetting(key string, value interface{}) error {
-	url := "https://claude.ai/api/account?statsig_hashing_algorithm=djb2"
+func (c *Client) UpdateUserSetting(key string, value interface{}) (err error) {
+	span := c.startSpan("claude.update_user_setting")
+	span.SetAttribute("setting", key)
+	defer endSpan(span, &err)
+	defer c.recordStage(logger.StageSettings, time.Now())
+	url := c.baseURL + "/api/account?statsig_hashing_algorithm=djb2"
 
 	// Default settings structure with all possible fields
 	settings := map[string]interface{}{
@@ -1247,7 +1319,7 @@ func (c *Client) UpdateUserSetting(key string, value interface{}) error {
 	// Update the specified setting
 	if _, exists := settings[key]; exists {
 		settings[key] = value
-		logger.Info(fmt.Sprintf("Updating setting %s to %v", key, value))
+		c.logEntry().Info(fmt.Sprintf("Updating setting %s to %v", key, value))
 	} else {
 		return fmt.Errorf("unknown setting key: %s", key)
 	}
@@ -1258,9 +1330,9 @@ func (c *Client) UpdateUserSetting(key string, value interface{}) error {
 	}
 
 	// Make the request
-	resp, err := c.client.R().
-		SetHeader("referer", "https://claude.ai/new").
-		SetHeader("origin", "https://claude.ai").
+	resp, err := c.newRequest(context.Background()).
+		SetHeader("referer", c.baseURL+"/new").
+		SetHeader("origin", c.baseURL).
 		SetHeader("anthropic-client-platform", "web_claude_ai").
 		SetHeader("cache-control", "no-cache").
 		SetHeader("pragma", "no-cache").
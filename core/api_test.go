@@ -2,9 +2,20 @@ package core
 
 import (
 	"claude2api/config"
+	"claude2api/logger"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
 	"strings"
 	"testing"
+	"testing/iotest"
 	"time"
+
+	"github.com/gin-gonic/gin"
 )
 
 func TestCitationCollectorExtractsDeduplicatedSources(t *testing.T) {
@@ -92,3 +103,183 @@ func TestIsUsableRateLimitResetRejectsCurrentOrTooCloseTime(t *testing.T) {
 		t.Fatal("expected future reset beyond minimum window to be usable")
 	}
 }
+
+func TestIsAuthErrorSurvivesWrapping(t *testing.T) {
+	err := fmt.Errorf("failed to get org ID: %w", NewAuthAPIError("failed to get organizations: unauthorized status code 401"))
+	if !IsAuthError(err) {
+		t.Fatal("expected wrapped auth error to be detected")
+	}
+	if IsRetryableError(err) {
+		t.Fatal("expected auth error not to be retryable on the same session")
+	}
+	if IsAuthError(NewAPIError("unexpected status code: 500", true)) {
+		t.Fatal("expected server error not to be an auth error")
+	}
+}
+
+func TestSelectOrgIDPrefersDefaultTier(t *testing.T) {
+	orgs := []Organization{
+		{UUID: "org-team", RateLimitTier: "team"},
+		{UUID: "org-personal", RateLimitTier: "default_claude_ai"},
+	}
+	got, err := SelectOrgID(orgs)
+	if err != nil || got != "org-personal" {
+		t.Fatalf("expected default tier org, got %q err=%v", got, err)
+	}
+	if _, err := SelectOrgID(nil); err == nil {
+		t.Fatal("expected error without organizations")
+	}
+}
+
+func TestHandleResponseReportsFirstTokenOnce(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gc, _ := gin.CreateTestContext(httptest.NewRecorder())
+	gc.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	firstTokens := 0
+	client := &Client{}
+	WithFirstTokenHandler(func() { firstTokens++ })(client)
+	body := strings.Join([]string{
+		`data: {"type":"message_start"}`,
+		`data: {"type":"content_block_delta","delta":{"type":"thinking_delta","thinking":"hmm"}}`,
+		`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}`,
+		"",
+	}, "\n")
+
+	if _, err := client.HandleResponse(io.NopCloser(strings.NewReader(body)), true, gc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if firstTokens != 1 {
+		t.Fatalf("expected first token callback once, got %d", firstTokens)
+	}
+}
+
+func TestHandleResponseReportsTokenAndStreamStages(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gc, _ := gin.CreateTestContext(httptest.NewRecorder())
+	gc.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	stages := make(map[string]int)
+	client := &Client{
+		sendStartedAt: time.Now().Add(-time.Second),
+		firstByteAt:   time.Now().Add(-500 * time.Millisecond),
+	}
+	WithStageHandler(func(stage string, elapsed time.Duration) {
+		stages[stage]++
+		if elapsed < 500*time.Millisecond {
+			t.Fatalf("stage %s measured from the wrong start: %s", stage, elapsed)
+		}
+	})(client)
+	body := strings.Join([]string{
+		`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}`,
+		`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":" there"}}`,
+		"",
+	}, "\n")
+
+	if _, err := client.HandleResponse(io.NopCloser(strings.NewReader(body)), true, gc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if stages[logger.StageFirstToken] != 1 || stages[logger.StageStream] != 1 {
+		t.Fatalf("expected one first token and one stream stage, got %v", stages)
+	}
+}
+
+func TestHandleResponseReportsClientCancellation(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	gc, _ := gin.CreateTestContext(httptest.NewRecorder())
+	ctx, cancel := context.WithCancel(context.Background())
+	gc.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil).WithContext(ctx)
+	cancel()
+
+	body := io.MultiReader(
+		strings.NewReader(`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}`+"\n"),
+		iotest.ErrReader(context.Canceled),
+	)
+	client := &Client{}
+	_, err := client.HandleResponse(io.NopCloser(body), true, gc)
+	if !IsClientCancelledError(err) {
+		t.Fatalf("expected client cancellation, got %v", err)
+	}
+	if IsRetryableError(err) {
+		t.Fatal("client cancellation must not be retried on another session")
+	}
+	if IsClientCancelledError(errors.New("error reading response: unexpected EOF")) {
+		t.Fatal("plain read errors are not cancellations")
+	}
+}
+
+func TestHandleResponseSendsHeartbeatsUntilContent(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	gc, _ := gin.CreateTestContext(recorder)
+	gc.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	client := &Client{}
+	WithHeartbeat(5*time.Millisecond, false)(client)
+	reader, writer := io.Pipe()
+	go func() {
+		time.Sleep(40 * time.Millisecond)
+		writer.Write([]byte(`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}` + "\n"))
+		time.Sleep(40 * time.Millisecond)
+		writer.Close()
+	}()
+
+	if _, err := client.HandleResponse(reader, true, gc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body := recorder.Body.String()
+	contentAt := strings.Index(body, "data: ")
+	if !strings.HasPrefix(body, sseHeartbeat) || contentAt < 0 {
+		t.Fatalf("expected heartbeats before content, got %q", body)
+	}
+	if strings.Contains(body[contentAt:], sseHeartbeat) {
+		t.Fatalf("heartbeats must stop once content flows, got %q", body)
+	}
+}
+
+func TestHandleResponseNonStreamHeartbeatKeepsJSONValid(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	gc, _ := gin.CreateTestContext(recorder)
+	gc.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	client := &Client{}
+	WithHeartbeat(5*time.Millisecond, true)(client)
+	reader, writer := io.Pipe()
+	go func() {
+		time.Sleep(40 * time.Millisecond)
+		writer.Write([]byte(`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}` + "\n"))
+		writer.Close()
+	}()
+
+	if _, err := client.HandleResponse(reader, false, gc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	body := recorder.Body.String()
+	if !strings.HasPrefix(body, "\n") {
+		t.Fatalf("expected whitespace keepalive before the JSON body, got %q", body)
+	}
+	var response map[string]interface{}
+	if err := json.Unmarshal([]byte(body), &response); err != nil {
+		t.Fatalf("response with keepalive whitespace is not valid JSON: %v", err)
+	}
+}
+
+func TestWithUpstreamPointsClientAtBaseURL(t *testing.T) {
+	var requested string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requested = r.URL.Path
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`[{"uuid":"org-1","rate_limit_tier":"default_claude_ai"}]`))
+	}))
+	defer server.Close()
+
+	client := NewClientFromSession(config.SessionInfo{SessionKey: "sk-test"}, "", "", WithUpstream(server.URL+"/", time.Second, time.Second))
+	orgs, err := client.GetOrganizations()
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if requested != "/api/organizations" || len(orgs) != 1 || orgs[0].UUID != "org-1" {
+		t.Fatalf("unexpected request %q or organizations %+v", requested, orgs)
+	}
+}
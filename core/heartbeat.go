@@ -0,0 +1,90 @@
+package core
+
+import (
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// sseHeartbeat is an SSE comment line; clients ignore it, proxies see traffic.
+const sseHeartbeat = ": keepalive\n\n"
+
+// heartbeat writes keepalive bytes to a response that has nothing to send yet. It must
+// be stopped before anything else is written to the response, since the writes would race.
+type heartbeat struct {
+	mu      sync.Mutex
+	stopped bool
+	done    chan struct{}
+}
+
+// WithHeartbeat makes HandleResponse write a keepalive every interval until content
+// flows: SSE comment lines for streams and, with nonStream, whitespace ahead of the
+// JSON body of non-stream responses. A zero interval disables heartbeats. The first
+// non-stream beat commits a 200 status, so callers that may still retry the request
+// elsewhere should leave nonStream off.
+func WithHeartbeat(interval time.Duration, nonStream bool) ClientOption {
+	return func(c *Client) {
+		c.heartbeatInterval = interval
+		c.heartbeatNonStream = nonStream
+	}
+}
+
+func (c *Client) startHeartbeat(gc *gin.Context, stream bool) *heartbeat {
+	h := &heartbeat{done: make(chan struct{})}
+	if c.heartbeatInterval <= 0 || (!stream && !c.heartbeatNonStream) {
+		h.stopped = true
+		return h
+	}
+	go h.run(gc, stream, c.heartbeatInterval)
+	return h
+}
+
+func (h *heartbeat) run(gc *gin.Context, stream bool, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	clientDone := gc.Request.Context().Done()
+	for {
+		select {
+		case <-h.done:
+			return
+		case <-clientDone:
+			return
+		case <-ticker.C:
+		}
+		if !h.beat(gc, stream) {
+			return
+		}
+	}
+}
+
+func (h *heartbeat) beat(gc *gin.Context, stream bool) bool {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.stopped {
+		return false
+	}
+	if stream {
+		gc.Writer.Write([]byte(sseHeartbeat))
+	} else {
+		// Leading whitespace is valid JSON, but the status is committed with the first beat.
+		if !gc.Writer.Written() {
+			gc.Writer.Header().Set("Content-Type", "application/json; charset=utf-8")
+			gc.Writer.WriteHeader(http.StatusOK)
+		}
+		gc.Writer.Write([]byte("\n"))
+	}
+	gc.Writer.Flush()
+	return true
+}
+
+// Stop ends the heartbeat and waits for a beat in progress; it is safe to call repeatedly.
+func (h *heartbeat) Stop() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if !h.stopped {
+		h.stopped = true
+		close(h.done)
+	}
+}
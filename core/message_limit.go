@@ -0,0 +1,109 @@
+package core
+
+import (
+	"claude2api/config"
+	"strings"
+	"time"
+)
+
+// MessageLimitWindow is one usage window (for example "5h" or "7d") reported by Claude.
+type MessageLimitWindow struct {
+	Status      string
+	ResetsAt    time.Time
+	Utilization float64
+}
+
+// MessageLimit is the quota state claude.ai reports in a message_limit stream event.
+type MessageLimit struct {
+	Type string
+	// Remaining is -1 when Claude does not report a count.
+	Remaining int
+	ResetsAt  time.Time
+	Windows   map[string]MessageLimitWindow
+}
+
+// MaxUtilization returns the highest utilization across the reported windows.
+func (l MessageLimit) MaxUtilization() float64 {
+	max := 0.0
+	for _, window := range l.Windows {
+		if window.Utilization > max {
+			max = window.Utilization
+		}
+	}
+	return max
+}
+
+// WithMessageLimitHandler registers a callback for message_limit events seen in the stream.
+func WithMessageLimitHandler(handler func(MessageLimit)) ClientOption {
+	return func(c *Client) {
+		c.onMessageLimit = handler
+	}
+}
+
+// parseMessageLimitEvent reads a decoded SSE event of type "message_limit". The limit
+// may sit under "message_limit" or directly on the event.
+func parseMessageLimitEvent(rawEvent map[string]interface{}, now time.Time) (MessageLimit, bool) {
+	if eventType, _ := rawEvent["type"].(string); eventType != "message_limit" {
+		return MessageLimit{}, false
+	}
+	payload, ok := rawEvent["message_limit"].(map[string]interface{})
+	if !ok {
+		payload = rawEvent
+	}
+
+	limit := MessageLimit{Remaining: -1}
+	if limitType, ok := payload["type"].(string); ok && limitType != "message_limit" {
+		limit.Type = strings.ToLower(strings.TrimSpace(limitType))
+	}
+	if remaining, ok := payload["remaining"].(float64); ok && remaining >= 0 {
+		limit.Remaining = int(remaining)
+	}
+	for _, key := range []string{"resetsAt", "resets_at", "resetAt"} {
+		if resetAt, _, ok := parseRateLimitResetJSONValue(payload[key], now); ok && !resetAt.IsZero() {
+			limit.ResetsAt = resetAt
+			break
+		}
+	}
+
+	if windows, ok := payload["windows"].(map[string]interface{}); ok {
+		limit.Windows = make(map[string]MessageLimitWindow, len(windows))
+		for name, rawWindow := range windows {
+			values, ok := rawWindow.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			window := MessageLimitWindow{}
+			window.Status, _ = values["status"].(string)
+			window.Utilization, _ = values["utilization"].(float64)
+			for _, key := range []string{"resets_at", "resetsAt"} {
+				if resetAt, _, ok := parseRateLimitResetJSONValue(values[key], now); ok && !resetAt.IsZero() {
+					window.ResetsAt = resetAt
+					break
+				}
+			}
+			limit.Windows[name] = window
+		}
+	}
+
+	// Without a top-level reset, use the window that is exceeded, else the busiest one.
+	if limit.ResetsAt.IsZero() {
+		best := MessageLimitWindow{Utilization: -1}
+		for _, window := range limit.Windows {
+			if window.ResetsAt.IsZero() {
+				continue
+			}
+			if window.Status == config.SessionQuotaExceeded {
+				best = window
+				break
+			}
+			if window.Utilization > best.Utilization {
+				best = window
+			}
+		}
+		limit.ResetsAt = best.ResetsAt
+	}
+	if limit.Type == "" {
+		limit.Type = config.SessionQuotaWithin
+	}
+	return limit, true
+}
@@ -0,0 +1,78 @@
+package core
+
+import (
+	"claude2api/config"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseMessageLimitEventReadsWindows(t *testing.T) {
+	now := time.Date(2026, 7, 4, 10, 0, 0, 0, time.UTC)
+	reset := now.Add(3 * time.Hour)
+	event := map[string]interface{}{
+		"type": "message_limit",
+		"message_limit": map[string]interface{}{
+			"type":      "approaching_limit",
+			"resetsAt":  nil,
+			"remaining": float64(4),
+			"windows": map[string]interface{}{
+				"5h": map[string]interface{}{"status": "approaching_limit", "resets_at": float64(reset.Unix()), "utilization": 0.9},
+				"7d": map[string]interface{}{"status": "within_limit", "resets_at": float64(now.Add(72 * time.Hour).Unix()), "utilization": 0.3},
+			},
+		},
+	}
+
+	limit, ok := parseMessageLimitEvent(event, now)
+	if !ok {
+		t.Fatal("expected message_limit event to parse")
+	}
+	if limit.Type != config.SessionQuotaApproaching || limit.Remaining != 4 {
+		t.Fatalf("unexpected limit: %+v", limit)
+	}
+	if !limit.ResetsAt.Equal(reset) {
+		t.Fatalf("expected reset from busiest window %s, got %s", reset, limit.ResetsAt)
+	}
+	if limit.MaxUtilization() != 0.9 {
+		t.Fatalf("expected max utilization 0.9, got %v", limit.MaxUtilization())
+	}
+
+	if _, ok := parseMessageLimitEvent(map[string]interface{}{"type": "content_block_delta"}, now); ok {
+		t.Fatal("expected other events to be ignored")
+	}
+}
+
+func TestHandleResponseReportsMessageLimit(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	gc, _ := gin.CreateTestContext(recorder)
+	gc.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+	var reported []MessageLimit
+	client := &Client{onMessageLimit: func(limit MessageLimit) {
+		reported = append(reported, limit)
+	}}
+	body := strings.Join([]string{
+		`data: {"type":"content_block_delta","delta":{"type":"text_delta","text":"hi"}}`,
+		`data: {"type":"message_limit","message_limit":{"type":"exceeded_limit","resetsAt":1893456000,"remaining":0}}`,
+		"",
+	}, "\n")
+
+	if _, err := client.HandleResponse(io.NopCloser(strings.NewReader(body)), false, gc); err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+	if len(reported) != 1 || reported[0].Type != config.SessionQuotaExceeded || reported[0].Remaining != 0 {
+		t.Fatalf("unexpected reported limits: %+v", reported)
+	}
+	if !reported[0].ResetsAt.Equal(time.Unix(1893456000, 0)) {
+		t.Fatalf("unexpected reset time: %s", reported[0].ResetsAt)
+	}
+	if !strings.Contains(recorder.Body.String(), "hi") {
+		t.Fatalf("expected text to still be returned, got %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,105 @@
+package core
+
+import (
+	"claude2api/model"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// openAIEncoder renders events as OpenAI chat completion content: thinking is wrapped in
+// <think> tags, tool input in a fenced code block and citations in a trailing source list.
+type openAIEncoder struct {
+	stream        bool
+	write         func(text string)
+	text          strings.Builder
+	citations     *citationCollector
+	thinkingShown bool
+	toolShown     bool
+}
+
+func (e *openAIEncoder) handle(event Event) {
+	switch event.Type {
+	case EventText:
+		e.content(event.Text)
+	case EventThinking:
+		text := event.Text
+		if !e.thinkingShown {
+			text = "<think> " + text
+			e.thinkingShown = true
+		}
+		e.content(text)
+	case EventToolInput:
+		text := event.Text
+		if !e.toolShown {
+			text = "\n```" + event.Language + "\n" + text
+			e.toolShown = true
+		}
+		e.content(text)
+	case EventBlockStop:
+		text := ""
+		if e.thinkingShown {
+			text = "</think>\n"
+			e.thinkingShown = false
+		}
+		if e.toolShown {
+			text = "\n```\n"
+			e.toolShown = false
+		}
+		e.content(text)
+	case EventCitation:
+		e.citations.add(event.Citation.Title, event.Citation.URL)
+	}
+}
+
+// content adds text to the final message, streaming it right away in stream mode.
+func (e *openAIEncoder) content(text string) {
+	e.text.WriteString(text)
+	if e.stream {
+		e.write(text)
+	}
+}
+
+// HandleResponse converts Claude's SSE format to OpenAI format and writes to the response writer
+func (c *Client) HandleResponse(body io.ReadCloser, stream bool, gc *gin.Context) (*TokenInfo, error) {
+	// Set headers for streaming
+	if stream {
+		gc.Writer.Header().Set("Content-Type", "text/event-stream")
+		gc.Writer.Header().Set("Cache-Control", "no-cache")
+		gc.Writer.Header().Set("Connection", "keep-alive")
+		// 发送200状态码
+		gc.Writer.WriteHeader(http.StatusOK)
+		gc.Writer.Flush()
+	}
+	hb := c.startHeartbeat(gc, stream)
+	defer hb.Stop()
+	encoder := &openAIEncoder{
+		stream:    stream,
+		citations: newCitationCollector(),
+		// Heartbeats stop before the first real write, so they never interleave with content.
+		write: func(text string) {
+			hb.Stop()
+			model.ReturnOpenAIResponse(text, stream, gc)
+		},
+	}
+	// Errors, including those Claude sends inside the stream, are left to the caller,
+	// which may still retry on another session as long as nothing has been streamed.
+	tokenInfo, err := c.StreamEvents(gc.Request.Context(), body, encoder.handle)
+	if err != nil {
+		return tokenInfo, err
+	}
+	if sourceMarkdown := encoder.citations.Markdown(); sourceMarkdown != "" {
+		encoder.content(sourceMarkdown)
+	}
+	hb.Stop()
+	if !stream {
+		model.ReturnOpenAIResponseWithAnnotations(encoder.text.String(), stream, encoder.citations.Annotations(), gc)
+	} else {
+		// 发送结束标志
+		gc.Writer.Write([]byte("data: [DONE]\n\n"))
+		gc.Writer.Flush()
+	}
+	return tokenInfo, nil
+}
@@ -0,0 +1,219 @@
+package core
+
+import (
+	"claude2api/config"
+	"claude2api/logger"
+	"context"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/imroc/req/v3"
+)
+
+// impersonation names the browser TLS and HTTP/2 fingerprint of every transport.
+const impersonation = "chrome"
+
+// upstreamStatusKey carries a client's status handler on each of its requests, because
+// the after-response hook belongs to a transport that many clients may share.
+type upstreamStatusKey struct{}
+
+// transportSettings are everything a req.Client is built from.
+type transportSettings struct {
+	session               config.SessionInfo
+	proxy                 string
+	baseURL               string
+	timeout               time.Duration
+	responseHeaderTimeout time.Duration
+}
+
+// fingerprint changes whenever a transport built from the settings would behave differently
+// towards claude.ai for the same session and upstream.
+func (s transportSettings) fingerprint() string {
+	return strings.Join([]string{s.session.CFClearance, s.session.CookieString, s.proxy, impersonation}, "\x00")
+}
+
+// newTransport builds an impersonating req.Client. It is never changed afterwards, so it
+// is safe to share between concurrent requests. Its setup is logged through log.
+func newTransport(settings transportSettings, log *logger.Entry) *req.Client {
+	client := req.C().ImpersonateChrome().SetTimeout(settings.timeout)
+	client.Transport.SetResponseHeaderTimeout(settings.responseHeaderTimeout)
+	if settings.proxy != "" {
+		client.SetProxyURL(settings.proxy)
+	}
+	// Set common headers
+	headers := map[string]string{
+		"accept":                    "text/event-stream, text/event-stream",
+		"accept-language":           "zh-CN,zh;q=0.9",
+		"anthropic-client-platform": "web_claude_ai",
+		"content-type":              "application/json",
+		"origin":                    settings.baseURL,
+		"priority":                  "u=1, i",
+	}
+	for key, value := range headers {
+		client.SetCommonHeader(key, value)
+	}
+	applySessionCookies(client, settings.session, log)
+	client.OnAfterResponse(func(_ *req.Client, resp *req.Response) error {
+		if resp.Response == nil || resp.Request == nil {
+			return nil
+		}
+		if handler, ok := resp.Request.Context().Value(upstreamStatusKey{}).(func(int)); ok {
+			handler(resp.StatusCode)
+		}
+		return nil
+	})
+	return client
+}
+
+// newRequest starts a request on the client's transport with the client's own hooks.
+func (c *Client) newRequest(ctx context.Context) *req.Request {
+	if c.onUpstreamStatus != nil {
+		ctx = context.WithValue(ctx, upstreamStatusKey{}, c.onUpstreamStatus)
+	}
+	return c.client.R().SetContext(ctx)
+}
+
+// ClientPool keeps one transport per session and upstream, so requests on the same session
+// reuse its TLS and HTTP/2 connections instead of dialing claude.ai each time. A pooled
+// transport is replaced when the session's cookies, the proxy or the fingerprint change.
+// Transports unused for longer than the idle timeout are dropped, and the least recently
+// used one is dropped when the pool is full. It is safe for concurrent use.
+type ClientPool struct {
+	mu          sync.Mutex
+	transports  map[poolKey]*pooledTransport
+	idleTimeout time.Duration
+	maxSize     int
+	now         func() time.Time
+}
+
+const (
+	defaultPoolIdleTimeout = 10 * time.Minute
+	defaultPoolMaxSize     = 256
+)
+
+type poolKey struct {
+	sessionKey            string
+	baseURL               string
+	timeout               time.Duration
+	responseHeaderTimeout time.Duration
+}
+
+type pooledTransport struct {
+	fingerprint string
+	client      *req.Client
+	lastUsed    time.Time
+}
+
+// NewClientPool creates an empty pool.
+func NewClientPool() *ClientPool {
+	return &ClientPool{
+		transports:  make(map[poolKey]*pooledTransport),
+		idleTimeout: defaultPoolIdleTimeout,
+		maxSize:     defaultPoolMaxSize,
+		now:         time.Now,
+	}
+}
+
+// WithClientPool takes the client's transport from pool instead of building a new one.
+func WithClientPool(pool *ClientPool) ClientOption {
+	return func(c *Client) {
+		c.pool = pool
+	}
+}
+
+func (p *ClientPool) transport(settings transportSettings, log *logger.Entry) *req.Client {
+	key := poolKey{
+		sessionKey:            settings.session.SessionKey,
+		baseURL:               settings.baseURL,
+		timeout:               settings.timeout,
+		responseHeaderTimeout: settings.responseHeaderTimeout,
+	}
+	fingerprint := settings.fingerprint()
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	now := p.now()
+	p.evictIdle(now)
+	if pooled, ok := p.transports[key]; ok {
+		if pooled.fingerprint == fingerprint {
+			pooled.lastUsed = now
+			return pooled.client
+		}
+		// Requests still running on the old transport finish normally.
+		p.drop(key)
+	}
+	if p.maxSize > 0 && len(p.transports) >= p.maxSize {
+		p.evictOldest()
+	}
+	client := newTransport(settings, log)
+	p.transports[key] = &pooledTransport{fingerprint: fingerprint, client: client, lastUsed: now}
+	return client
+}
+
+// evictIdle drops transports that were not used within the idle timeout.
+func (p *ClientPool) evictIdle(now time.Time) {
+	if p.idleTimeout <= 0 {
+		return
+	}
+	for key, pooled := range p.transports {
+		if now.Sub(pooled.lastUsed) > p.idleTimeout {
+			p.drop(key)
+		}
+	}
+}
+
+// evictOldest drops the least recently used transport.
+func (p *ClientPool) evictOldest() {
+	var oldest poolKey
+	var oldestUsed time.Time
+	found := false
+	for key, pooled := range p.transports {
+		if !found || pooled.lastUsed.Before(oldestUsed) {
+			oldest, oldestUsed, found = key, pooled.lastUsed, true
+		}
+	}
+	if found {
+		p.drop(oldest)
+	}
+}
+
+func (p *ClientPool) drop(key poolKey) {
+	if pooled, ok := p.transports[key]; ok {
+		pooled.client.Transport.CloseIdleConnections()
+		delete(p.transports, key)
+	}
+}
+
+// Invalidate drops the transports of a session, for example after it was removed.
+func (p *ClientPool) Invalidate(sessionKey string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key := range p.transports {
+		if key.sessionKey == sessionKey {
+			p.drop(key)
+		}
+	}
+}
+
+// Retain drops the transports of every session not in sessionKeys, for example after the
+// configured sessions were replaced.
+func (p *ClientPool) Retain(sessionKeys []string) {
+	keep := make(map[string]bool, len(sessionKeys))
+	for _, sessionKey := range sessionKeys {
+		keep[sessionKey] = true
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for key := range p.transports {
+		if !keep[key.sessionKey] {
+			p.drop(key)
+		}
+	}
+}
+
+// Len returns the number of pooled transports.
+func (p *ClientPool) Len() int {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return len(p.transports)
+}
@@ -0,0 +1,132 @@
+package core
+
+import (
+	"claude2api/config"
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestClientPoolReusesTransportUntilSessionChanges(t *testing.T) {
+	pool := NewClientPool()
+	session := config.SessionInfo{SessionKey: "sk-a", CFClearance: "cf-1"}
+	first := NewClientFromSession(session, "", "claude-sonnet-4-6", WithClientPool(pool))
+	second := NewClientFromSession(session, "", "claude-opus-4-6", WithClientPool(pool), WithThinkingOptions("extended", ""))
+	if first.client != second.client {
+		t.Fatal("expected clients of the same session to share a transport")
+	}
+	first.defaultAttrs["prompt"] = "only for the first request"
+	if _, shared := second.defaultAttrs["prompt"]; shared {
+		t.Fatal("expected completion fields to stay per request")
+	}
+
+	session.CFClearance = "cf-2"
+	if NewClientFromSession(session, "", "", WithClientPool(pool)).client == first.client {
+		t.Fatal("expected a new transport after the cookies changed")
+	}
+	if NewClientFromSession(session, "http://127.0.0.1:3128", "", WithClientPool(pool)).client == first.client {
+		t.Fatal("expected a new transport after the proxy changed")
+	}
+	if NewClientFromSession(config.SessionInfo{SessionKey: "sk-b"}, "", "", WithClientPool(pool)).client == first.client {
+		t.Fatal("expected another session to get its own transport")
+	}
+	if pool.Len() != 2 {
+		t.Fatalf("expected replaced transports to be dropped, got %d", pool.Len())
+	}
+	pool.Invalidate("sk-a")
+	if pool.Len() != 1 {
+		t.Fatalf("expected one transport after invalidating sk-a, got %d", pool.Len())
+	}
+}
+
+func TestClientPoolEvictsIdleAndLeastRecentlyUsedTransports(t *testing.T) {
+	now := time.Unix(1_700_000_000, 0)
+	pool := NewClientPool()
+	pool.now = func() time.Time { return now }
+	pool.maxSize = 2
+	clientFor := func(sessionKey string) *Client {
+		return NewClientFromSession(config.SessionInfo{SessionKey: sessionKey}, "", "", WithClientPool(pool))
+	}
+
+	a := clientFor("sk-a")
+	now = now.Add(time.Minute)
+	clientFor("sk-b")
+	now = now.Add(time.Minute)
+	if clientFor("sk-a").client != a.client {
+		t.Fatal("expected sk-a to reuse its transport")
+	}
+	now = now.Add(time.Minute)
+	clientFor("sk-c")
+	if pool.Len() != 2 {
+		t.Fatalf("expected the pool to stay at its size limit, got %d", pool.Len())
+	}
+	if clientFor("sk-a").client != a.client {
+		t.Fatal("expected the least recently used sk-b to be evicted instead of sk-a")
+	}
+
+	now = now.Add(defaultPoolIdleTimeout + time.Second)
+	if clientFor("sk-a").client == a.client {
+		t.Fatal("expected an idle transport to be rebuilt")
+	}
+	if pool.Len() != 1 {
+		t.Fatalf("expected idle transports to be dropped, got %d", pool.Len())
+	}
+
+	clientFor("sk-d")
+	pool.Retain([]string{"sk-d"})
+	if pool.Len() != 1 {
+		t.Fatalf("expected only the retained session to stay pooled, got %d", pool.Len())
+	}
+}
+
+func TestPooledClientsKeepTheirOwnStatusHandlers(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("fail") != "" {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		w.Write([]byte(`[]`))
+	}))
+	defer server.Close()
+
+	pool := NewClientPool()
+	session := config.SessionInfo{SessionKey: "sk-shared"}
+	var wg sync.WaitGroup
+	var mismatches int64
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(fail bool) {
+			defer wg.Done()
+			want := http.StatusOK
+			path := "/ok"
+			if fail {
+				want = http.StatusBadGateway
+				path = "/ok?fail=1"
+			}
+			client := NewClientFromSession(session, "", "",
+				WithClientPool(pool),
+				WithUpstream(server.URL, 5*time.Second, 5*time.Second),
+				WithUpstreamStatusHandler(func(status int) {
+					if status != want {
+						atomic.AddInt64(&mismatches, 1)
+					}
+				}))
+			for j := 0; j < 5; j++ {
+				if _, err := client.newRequest(context.Background()).Get(server.URL + path); err != nil {
+					t.Error(err)
+				}
+			}
+		}(i%2 == 0)
+	}
+	wg.Wait()
+	if mismatches != 0 {
+		t.Fatalf("status handlers saw %d responses of other clients", mismatches)
+	}
+	if pool.Len() != 1 {
+		t.Fatalf("expected one shared transport, got %d", pool.Len())
+	}
+}
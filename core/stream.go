@@ -0,0 +1,243 @@
+package core
+
+import (
+	"bufio"
+	"claude2api/logger"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// EventType names the kind of an Event parsed from a completion stream.
+type EventType string
+
+const (
+	// EventText carries a fragment of the answer.
+	EventText EventType = "text"
+	// EventThinking carries a fragment of extended thinking.
+	EventThinking EventType = "thinking"
+	// EventToolInput carries a fragment of code written through the artifacts tool,
+	// already unescaped from the tool's partial JSON. Language is set on every fragment.
+	EventToolInput EventType = "tool_input"
+	// EventBlockStop marks the end of a content block, closing any thinking or tool input.
+	EventBlockStop EventType = "block_stop"
+	// EventCitation carries a source the answer cites, at most once per URL.
+	EventCitation EventType = "citation"
+	// EventStop carries the reason Claude stopped generating, such as "end_turn".
+	EventStop EventType = "stop"
+	// EventUsage carries the estimated token usage and is the last event of a finished stream.
+	EventUsage EventType = "usage"
+	// EventError carries an error message sent by Claude inside the stream. No events follow
+	// it, and StreamEvents returns the error as an APIError, see IsStreamError.
+	EventError EventType = "error"
+)
+
+// Event is one typed piece of a completion stream. Only the fields for its Type are set.
+type Event struct {
+	Type EventType
+	// Text is the fragment for text, thinking and tool input events, or the message of an error.
+	Text string
+	// Language is the code language of a tool input, "md" when Claude did not name one.
+	Language   string
+	Citation   *Citation
+	StopReason string
+	Usage      *TokenInfo
+}
+
+// Citation is a web source cited by an answer.
+type Citation struct {
+	Title string
+	URL   string
+}
+
+// streamParser holds the state carried between the SSE events of one completion.
+type streamParser struct {
+	client    *Client
+	emit      func(Event)
+	citations *citationCollector
+	// chars counts the characters of every emitted fragment, for the usage estimate.
+	chars        int
+	useTool      bool
+	useToolEnd   bool
+	nextLanguage bool
+	languageStr  string
+}
+
+// StreamEvents reads a completion stream from Claude and calls emit with each event in
+// order. It returns at the end of the stream, with the error of an EventError, or with
+// ErrClientCancelled once ctx is done. It does not depend on gin,
+// so any encoder can be built on top of it; HandleResponse is the OpenAI one.
+func (c *Client) StreamEvents(ctx context.Context, body io.ReadCloser, emit func(Event)) (*TokenInfo, error) {
+	defer body.Close()
+	if !c.firstByteAt.IsZero() {
+		defer c.recordStage(logger.StageStream, c.firstByteAt)
+	}
+	p := &streamParser{
+		client:      c,
+		emit:        emit,
+		citations:   newCitationCollector(),
+		languageStr: "md",
+	}
+	scanner := bufio.NewScanner(body)
+	done := ctx.Done()
+	firstTokenSeen := false
+	for scanner.Scan() {
+		select {
+		case <-done:
+			// 客户端已断开连接，清理资源并退出
+			c.logEntry().Info("Client closed connection")
+			return p.usage(), ErrClientCancelled
+		default:
+			// 继续处理响应
+		}
+		line := scanner.Text()
+		if !strings.HasPrefix(line, "data: ") {
+			continue
+		}
+		data := line[6:]
+		if data == "[DONE]" {
+			break
+		}
+		var rawEvent map[string]interface{}
+		if err := json.Unmarshal([]byte(data), &rawEvent); err == nil {
+			if limit, ok := parseMessageLimitEvent(rawEvent, time.Now()); ok {
+				if c.onMessageLimit != nil {
+					c.onMessageLimit(limit)
+				}
+				continue
+			}
+			p.addCitations(rawEvent)
+		}
+		var event ResponseEvent
+		if err := json.Unmarshal([]byte(data), &event); err != nil {
+			continue
+		}
+		if event.Type == "error" && event.Error.Message != "" {
+			emit(Event{Type: EventError, Text: event.Error.Message})
+			return p.usage(), NewStreamAPIError(event.Error.Type, event.Error.Message)
+		}
+		if !firstTokenSeen && isContentDelta(event.Delta.Type) {
+			firstTokenSeen = true
+			if c.onFirstToken != nil {
+				c.onFirstToken()
+			}
+			if !c.sendStartedAt.IsZero() {
+				c.recordStage(logger.StageFirstToken, c.sendStartedAt)
+			}
+		}
+		p.handle(event)
+	}
+	if err := scanner.Err(); err != nil {
+		// The read is tied to the request context, so a disconnect aborts it at once.
+		if ctx.Err() != nil {
+			c.logEntry().Info("Client closed connection")
+			return p.usage(), ErrClientCancelled
+		}
+		return nil, fmt.Errorf("error reading response: %w", err)
+	}
+	usage := p.usage()
+	emit(Event{Type: EventUsage, Usage: usage})
+	return usage, nil
+}
+
+// addCitations emits the sources in rawEvent that have not been seen before.
+func (p *streamParser) addCitations(rawEvent map[string]interface{}) {
+	seen := len(p.citations.sources)
+	p.citations.AddFrom(rawEvent)
+	for _, source := range p.citations.sources[seen:] {
+		p.emit(Event{Type: EventCitation, Citation: &Citation{Title: source.Title, URL: source.URL}})
+	}
+}
+
+func (p *streamParser) fragment(eventType EventType, text string, language string) {
+	p.chars += len(text)
+	p.emit(Event{Type: eventType, Text: text, Language: language})
+}
+
+func (p *streamParser) handle(event ResponseEvent) {
+	if event.ContentBlock.Type == "tool_use" {
+		p.useTool = true
+	}
+	if event.ContentBlock.Type == "tool_result" {
+		p.useToolEnd = true
+	}
+	switch {
+	case event.Type == "content_block_stop":
+		p.emit(Event{Type: EventBlockStop})
+	case event.Type == "message_delta" && event.Delta.StopReason != "":
+		p.emit(Event{Type: EventStop, StopReason: event.Delta.StopReason})
+	case event.Delta.Type == "text_delta" && event.Delta.Text != "":
+		p.fragment(EventText, event.Delta.Text, "")
+	case event.Delta.Type == "thinking_delta":
+		p.fragment(EventThinking, event.Delta.THINKING, "")
+	case event.Delta.Type == "input_json_delta":
+		if text, ok := p.toolInput(event.Delta.PartialJSON); ok {
+			p.fragment(EventToolInput, text, p.languageStr)
+		}
+	}
+}
+
+// toolInput turns a partial JSON fragment of an artifacts call into code text. It
+// reports false for fragments that are not code, such as the artifact ID or language.
+func (p *streamParser) toolInput(res_text string) (string, bool) {
+	c := p.client
+	//结束使用工具了
+	if p.useTool && res_text == ",\"content\":" {
+		p.useTool = false
+		return "", false
+	}
+	//获取语言,下一次就是了
+	if res_text == ",\"language\":" || res_text == ",\"type\":" {
+		p.nextLanguage = true
+		return "", false
+	}
+	//获取语言注入
+	if p.nextLanguage {
+		p.languageStr = res_text[1:]
+		c.logEntry().Info(fmt.Sprintf("获取的语言为:%s", p.languageStr))
+		if p.languageStr == "text/html" {
+			p.languageStr = "html"
+		}
+		p.nextLanguage = false
+	}
+	//使用工具
+	if p.useTool {
+		c.logEntry().Info(fmt.Sprintf("useTool res_text:%s", res_text))
+		return "", false
+	}
+	//使用了工具结束拉
+	if p.useToolEnd {
+		p.useToolEnd = false
+		return "", false
+	}
+	//存在代码首字母为"的情况,特殊处理
+	if strings.HasPrefix(res_text, "\"") {
+		res_text = res_text[1:]
+	}
+	//可能会存在多出一个}的情况
+	if res_text == "\"}" || res_text == "}" {
+		res_text = ""
+	}
+	//转义
+	unquote, err := strconv.Unquote(fmt.Sprintf("\"%s\"", res_text))
+	if err == nil {
+		return unquote, true
+	}
+	c.logEntry().Error(fmt.Sprintf("转化出错:%s", err.Error()))
+	res_text = strings.ReplaceAll(res_text, "\\\\n", "")
+	res_text = strings.ReplaceAll(res_text, "\\\\u", "\\u")
+	res_text = strings.ReplaceAll(res_text, "\\\"", "\"")
+	res_text = strings.ReplaceAll(res_text, "\\\\'", "'")
+	res_text = strings.ReplaceAll(res_text, "\\n", "\n")
+	res_text = strings.ReplaceAll(res_text, "\\t", "\t")
+	return decodeUnicodeEscape(res_text), true
+}
+
+// usage estimates tokens: roughly 4 characters per token for most languages.
+func (p *streamParser) usage() *TokenInfo {
+	return &TokenInfo{InputTokens: p.chars / 4, OutputTokens: p.chars / 4}
+}
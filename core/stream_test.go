@@ -0,0 +1,46 @@
+package core
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestStreamEventsParsesToolUseWithoutGin(t *testing.T) {
+	transcript, err := os.Open(filepath.Join("testdata", "transcripts", "tool_use.sse"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var events []Event
+	usage, err := (&Client{}).StreamEvents(context.Background(), transcript, func(event Event) {
+		events = append(events, event)
+	})
+	if err != nil {
+		t.Fatalf("unexpected error: %v", err)
+	}
+
+	code := ""
+	var stopReason string
+	for _, event := range events {
+		switch event.Type {
+		case EventToolInput:
+			if event.Language != "python" {
+				t.Fatalf("expected python tool input, got %q", event.Language)
+			}
+			code += event.Text
+		case EventStop:
+			stopReason = event.StopReason
+		}
+	}
+	if code != "print('hello from the fake upstream')\n" {
+		t.Fatalf("unexpected tool input %q", code)
+	}
+	if stopReason != "end_turn" {
+		t.Fatalf("expected end_turn, got %q", stopReason)
+	}
+	last := events[len(events)-1]
+	if last.Type != EventUsage || last.Usage.OutputTokens != usage.OutputTokens || usage.OutputTokens == 0 {
+		t.Fatalf("expected a usage event last, got %+v", last)
+	}
+}
@@ -0,0 +1,113 @@
+package core
+
+import (
+	"bytes"
+	"claude2api/logger"
+	"fmt"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Transcripts are raw completion streams from Claude, saved so that HandleResponse can
+// be replayed against them in tests. Metadata goes in leading SSE comment lines, which
+// StreamEvents skips like any other line that is not "data: ".
+const (
+	TranscriptExt = ".sse"
+
+	transcriptOrgPlaceholder          = "00000000-0000-4000-8000-000000000001"
+	transcriptConversationPlaceholder = "00000000-0000-4000-8000-000000000002"
+)
+
+var transcriptNameUnsafe = regexp.MustCompile(`[^A-Za-z0-9._-]+`)
+
+// WithTranscriptRecording saves the raw upstream stream of every completion to a new
+// file in dir, with the session key, org ID and conversation ID redacted. An empty dir
+// disables recording.
+func WithTranscriptRecording(dir string) ClientOption {
+	return func(c *Client) {
+		c.transcriptDir = strings.TrimSpace(dir)
+	}
+}
+
+// ReplayTranscript feeds a recorded transcript through HandleResponse, writing the
+// OpenAI response to gc as if the stream had just come from Claude.
+func (c *Client) ReplayTranscript(transcript io.Reader, stream bool, gc *gin.Context) (*TokenInfo, error) {
+	return c.HandleResponse(io.NopCloser(transcript), stream, gc)
+}
+
+// recordTranscript wraps a completion body so that what HandleResponse reads is also
+// written to a transcript file. Recording problems are logged and never fail the request.
+func (c *Client) recordTranscript(body io.ReadCloser, conversationID string, stream bool) io.ReadCloser {
+	if c.transcriptDir == "" {
+		return body
+	}
+	if err := os.MkdirAll(c.transcriptDir, 0o755); err != nil {
+		c.logEntry().Error(fmt.Sprintf("Failed to create transcript directory: %v", err))
+		return body
+	}
+	now := time.Now()
+	// CreateTemp fills in a random suffix, so completions finishing in the same
+	// millisecond never truncate each other's transcript.
+	pattern := fmt.Sprintf("%s-%s-*%s", now.Format("20060102-150405.000"), transcriptNameUnsafe.ReplaceAllString(c.model, "_"), TranscriptExt)
+	file, err := os.CreateTemp(c.transcriptDir, pattern)
+	if err != nil {
+		c.logEntry().Error(fmt.Sprintf("Failed to create transcript: %v", err))
+		return body
+	}
+	fmt.Fprintf(file, ": model=%s stream=%t thinking=%s effort=%s recorded_at=%s\n",
+		c.model, stream, c.thinkingMode, c.effortLevel, now.UTC().Format(time.RFC3339))
+	secrets := []string{c.SessionKey, c.orgID, conversationID}
+	placeholders := []string{"sk-ant-redacted", transcriptOrgPlaceholder, transcriptConversationPlaceholder}
+	replacements := make([]string, 0, 2*len(secrets))
+	for i, secret := range secrets {
+		if secret != "" {
+			replacements = append(replacements, secret, placeholders[i])
+		}
+	}
+	return &transcriptBody{
+		ReadCloser: body,
+		file:       file,
+		redactor:   strings.NewReplacer(replacements...),
+	}
+}
+
+// transcriptBody copies complete lines to the transcript as they are read, so that a
+// partial read never splits a secret across two redaction passes.
+type transcriptBody struct {
+	io.ReadCloser
+	file     *os.File
+	redactor *strings.Replacer
+	pending  []byte
+}
+
+func (b *transcriptBody) Read(p []byte) (int, error) {
+	n, err := b.ReadCloser.Read(p)
+	b.pending = append(b.pending, p[:n]...)
+	for {
+		index := bytes.IndexByte(b.pending, '\n')
+		if index < 0 {
+			break
+		}
+		b.writeLine(b.pending[:index+1])
+		b.pending = b.pending[index+1:]
+	}
+	return n, err
+}
+
+func (b *transcriptBody) writeLine(line []byte) {
+	b.file.WriteString(logger.Redact(b.redactor.Replace(string(line))))
+}
+
+func (b *transcriptBody) Close() error {
+	if len(b.pending) > 0 {
+		b.writeLine(append(b.pending, '\n'))
+		b.pending = nil
+	}
+	b.file.Close()
+	return b.ReadCloser.Close()
+}
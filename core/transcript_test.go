@@ -0,0 +1,142 @@
+package core
+
+import (
+	"claude2api/config"
+	"flag"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+var updateGolden = flag.Bool("update", false, "rewrite the golden files in testdata/golden from the current output")
+
+var (
+	goldenIDPattern      = regexp.MustCompile(`"id":"[0-9a-f-]{36}"`)
+	goldenCreatedPattern = regexp.MustCompile(`"created":\d+`)
+)
+
+// normalizeGolden replaces the per-response ID and timestamp so outputs can be compared.
+func normalizeGolden(output string) string {
+	output = goldenIDPattern.ReplaceAllString(output, `"id":"<id>"`)
+	return goldenCreatedPattern.ReplaceAllString(output, `"created":0`)
+}
+
+// TestReplayTranscriptsMatchGolden replays every recorded stream in testdata/transcripts
+// in stream and non-stream mode. After an intended change to the converter, run
+// go test ./core -run TestReplayTranscriptsMatchGolden -update and review the diff.
+func TestReplayTranscriptsMatchGolden(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	transcripts, err := filepath.Glob(filepath.Join("testdata", "transcripts", "*"+TranscriptExt))
+	if err != nil || len(transcripts) == 0 {
+		t.Fatalf("no transcripts found: %v", err)
+	}
+	for _, path := range transcripts {
+		name := strings.TrimSuffix(filepath.Base(path), TranscriptExt)
+		for _, stream := range []bool{true, false} {
+			mode := "json"
+			if stream {
+				mode = "stream"
+			}
+			t.Run(name+"/"+mode, func(t *testing.T) {
+				transcript, err := os.Open(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer transcript.Close()
+				recorder := httptest.NewRecorder()
+				gc, _ := gin.CreateTestContext(recorder)
+				gc.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+
+				// Error events in a transcript come back as errors for the caller to answer.
+				if _, err := (&Client{}).ReplayTranscript(transcript, stream, gc); err != nil && !IsStreamError(err) {
+					t.Fatalf("replay failed: %v", err)
+				}
+				got := normalizeGolden(recorder.Body.String())
+				goldenPath := filepath.Join("testdata", "golden", name+"."+mode+".golden")
+				if *updateGolden {
+					if err := os.WriteFile(goldenPath, []byte(got), 0o644); err != nil {
+						t.Fatal(err)
+					}
+					return
+				}
+				want, err := os.ReadFile(goldenPath)
+				if err != nil {
+					t.Fatalf("missing golden file, run with -update: %v", err)
+				}
+				if got != string(want) {
+					t.Fatalf("output differs from %s\n got: %s\nwant: %s", goldenPath, got, want)
+				}
+			})
+		}
+	}
+}
+
+func TestTranscriptRecordingRedactsSecrets(t *testing.T) {
+	dir := t.TempDir()
+	client := NewClientFromSession(config.SessionInfo{SessionKey: "sk-ant-REDACTED"}, "", "claude-sonnet-4-6",
+		WithTranscriptRecording(dir))
+	client.SetOrgID("11111111-2222-4333-8444-555555555555")
+	conversationID := "66666666-7777-4888-9999-000000000000"
+	stream := "data: {\"type\":\"content_block_delta\",\"delta\":{\"type\":\"text_delta\",\"text\":\"hi\"}}\n" +
+		"data: {\"url\":\"/api/organizations/11111111-2222-4333-8444-555555555555/chat_conversations/" + conversationID + "\"}\n" +
+		"data: {\"cookie\":\"sessionKey=sk-ant-REDACTED\"}"
+
+	// Read in small chunks so secrets straddle read boundaries.
+	body := client.recordTranscript(io.NopCloser(&chunkedReader{data: stream, size: 7}), conversationID, true)
+	if _, err := io.ReadAll(body); err != nil {
+		t.Fatal(err)
+	}
+	body.Close()
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*"+TranscriptExt))
+	if len(files) != 1 {
+		t.Fatalf("expected one transcript, got %v", files)
+	}
+	recorded, _ := os.ReadFile(files[0])
+	for _, secret := range []string{"secretsecret", "11111111-2222", conversationID} {
+		if strings.Contains(string(recorded), secret) {
+			t.Fatalf("transcript leaks %q:\n%s", secret, recorded)
+		}
+	}
+	if !strings.HasPrefix(string(recorded), ": model=claude-sonnet-4-6 stream=true") || !strings.Contains(string(recorded), `"text":"hi"`) {
+		t.Fatalf("unexpected transcript:\n%s", recorded)
+	}
+}
+
+func TestConcurrentTranscriptsDoNotOverwriteEachOther(t *testing.T) {
+	dir := t.TempDir()
+	client := NewClientFromSession(config.SessionInfo{SessionKey: "sk-a"}, "", "claude-sonnet-4-6", WithTranscriptRecording(dir))
+	for i := 0; i < 3; i++ {
+		body := client.recordTranscript(io.NopCloser(strings.NewReader("data: {}\n")), "", true)
+		io.ReadAll(body)
+		body.Close()
+	}
+	if files, _ := filepath.Glob(filepath.Join(dir, "*"+TranscriptExt)); len(files) != 3 {
+		t.Fatalf("expected one transcript per completion, got %v", files)
+	}
+}
+
+type chunkedReader struct {
+	data string
+	size int
+}
+
+func (r *chunkedReader) Read(p []byte) (int, error) {
+	if r.data == "" {
+		return 0, io.EOF
+	}
+	n := r.size
+	if n > len(r.data) {
+		n = len(r.data)
+	}
+	n = copy(p, r.data[:n])
+	r.data = r.data[n:]
+	return n, nil
+}
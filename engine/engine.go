@@ -0,0 +1,384 @@
+// Package engine embeds the claude2api session pool and claude.ai client in another Go
+// program, without going through the HTTP server. An Engine is built from an explicit
+// Config and keeps all of its state to itself, so several engines can run side by side
+// in one process and nothing is read from the working directory or the environment.
+package engine
+
+import (
+	"claude2api/config"
+	"claude2api/core"
+	"claude2api/logger"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// statusClientClosedRequest is logged for answers the caller abandoned, as the server does.
+const statusClientClosedRequest = 499
+
+// DefaultModel is used when a Request does not name a model. Requests carry claude.ai
+// model IDs, not the public aliases the server resolves, such as "claude-sonnet-4-6".
+const DefaultModel = "claude-sonnet-4-6-20260217"
+
+// Session is one claude.ai account the engine can dispatch to.
+type Session = config.SessionInfo
+
+// Event is one typed piece of a streamed answer, see core.Event for the event types.
+type Event = core.Event
+
+// TokenInfo is the estimated token usage of a finished answer.
+type TokenInfo = core.TokenInfo
+
+// Config configures an Engine. Zero values fall back to the same defaults as the server.
+type Config struct {
+	// Sessions are the claude.ai accounts to dispatch over. At least one is required.
+	Sessions []Session
+	// Proxy is an optional HTTP or SOCKS proxy URL for every upstream request.
+	Proxy string
+	// InternalRetryCount is how many sessions one Chat may try before giving up.
+	InternalRetryCount   int
+	MaxConcurrentPerKey  int
+	MaxGlobalConcurrency int
+	// SessionStrategy picks among free sessions: "least_loaded" (the default), "round_robin",
+	// "weighted", "random" or "least_rate_limited".
+	SessionStrategy     string
+	SessionAffinity     config.SessionAffinityConfig
+	PredictiveRateLimit config.PredictiveRateLimitConfig
+	AdaptiveConcurrency config.AdaptiveConcurrencyConfig
+	CircuitBreaker      config.CircuitBreakerConfig
+	Upstream            config.UpstreamConfig
+	// ChatDelete deletes each conversation from claude.ai once its answer is finished.
+	ChatDelete bool
+	// Log receives the engine's log lines; nil logs without extra fields.
+	Log *logger.Entry
+}
+
+// Request is one message to send to Claude.
+type Request struct {
+	// Model is the claude.ai model ID; a "-think" suffix turns on extended thinking.
+	Model string
+	// Prompt is sent as is, so it must already contain any earlier turns of the conversation.
+	Prompt string
+	// Images are data URIs such as data:image/png;base64,... uploaded with the prompt.
+	Images []string
+	// ThinkingMode and EffortLevel are passed to claude.ai when set.
+	ThinkingMode string
+	EffortLevel  string
+	// AffinityKey identifies the end user for sticky session affinity.
+	AffinityKey string
+}
+
+// Engine dispatches requests over a pool of claude.ai sessions, retrying on another
+// session when one fails before its answer starts. It is safe for concurrent use.
+type Engine struct {
+	cfg      *config.Config
+	upstream config.UpstreamConfig
+	log      *logger.Entry
+	// requests records every Chat, feeding the session selection strategies.
+	requests *logger.RequestLogger
+	// clients keeps each session's connections to claude.ai warm between requests.
+	clients *core.ClientPool
+
+	mu        sync.Mutex
+	nextIndex int
+}
+
+// New creates an engine from cfg. The sessions are copied, so cfg can be reused.
+func New(cfg Config) (*Engine, error) {
+	if len(cfg.Sessions) == 0 {
+		return nil, errors.New("engine: no sessions configured")
+	}
+	sessions := make([]Session, 0, len(cfg.Sessions))
+	for _, session := range cfg.Sessions {
+		session.SessionKey = strings.TrimSpace(session.SessionKey)
+		if session.SessionKey == "" {
+			return nil, errors.New("engine: session with an empty session key")
+		}
+		sessions = append(sessions, session)
+	}
+	predictive := cfg.PredictiveRateLimit
+	predictive.Mode = config.NormalizePredictiveMode(predictive.Mode)
+	e := &Engine{
+		upstream: config.NormalizeUpstream(cfg.Upstream),
+		log:      cfg.Log,
+		requests: logger.NewRequestLogger(config.DefaultRequestLogRetention),
+		clients:  core.NewClientPool(),
+	}
+	e.cfg = &config.Config{
+		Sessions:             sessions,
+		Proxy:                cfg.Proxy,
+		ChatDelete:           cfg.ChatDelete,
+		InternalRetryCount:   config.NormalizeInternalRetryCount(cfg.InternalRetryCount),
+		MaxConcurrentPerKey:  config.NormalizeMaxConcurrentPerKey(cfg.MaxConcurrentPerKey),
+		MaxGlobalConcurrency: config.NormalizeMaxGlobalConcurrency(cfg.MaxGlobalConcurrency),
+		SessionStrategy:      config.NormalizeSessionStrategy(cfg.SessionStrategy),
+		SessionAffinity:      cfg.SessionAffinity,
+		PredictiveRateLimit:  predictive,
+		AdaptiveConcurrency:  config.NormalizeAdaptiveConcurrency(cfg.AdaptiveConcurrency),
+		CircuitBreaker:       config.NormalizeCircuitBreaker(cfg.CircuitBreaker),
+		SessionStatsSource:   e.requests.GetStatsBySession,
+	}
+	return e, nil
+}
+
+// Stats returns request counts and success rates since the engine was created.
+func (e *Engine) Stats() logger.Stats {
+	return e.requests.GetStats()
+}
+
+// Chat sends request to Claude on a session from the pool and returns the answer as a
+// stream of events. Sessions that fail before the first event is received are marked
+// like the server does (cooldown, quarantine or failure count) and the request moves on
+// to the next session, so an error from Chat means no session could answer. Cancelling
+// ctx stops the generation; the stream must be read to the end or ctx cancelled.
+func (e *Engine) Chat(ctx context.Context, request Request) (*Stream, error) {
+	if strings.TrimSpace(request.Prompt) == "" {
+		return nil, errors.New("engine: empty prompt")
+	}
+	if request.Model == "" {
+		request.Model = DefaultModel
+	}
+	startTime := time.Now()
+	sessionCount := len(e.cfg.Sessions)
+	maxAttempts := e.cfg.InternalRetryCount
+	if maxAttempts > sessionCount {
+		maxAttempts = sessionCount
+	}
+	startIndex := e.advanceIndex()
+	attempted := make(map[int]bool, maxAttempts)
+	var lastErr error
+	lastIndex := -1
+	for len(attempted) < maxAttempts {
+		acquired := e.cfg.AcquireSessionLeaseWith(config.SessionAcquireRequest{
+			StartIndex:  startIndex,
+			Excluded:    attempted,
+			Now:         time.Now(),
+			AffinityKey: request.AffinityKey,
+		})
+		if !acquired.OK {
+			if lastErr == nil {
+				lastErr = fmt.Errorf("engine: %s", acquired.Reason)
+			}
+			break
+		}
+		lease := acquired.Lease
+		attempted[lease.Index] = true
+		lastIndex = lease.Index
+		stream, err := e.attempt(ctx, &lease, request, startTime)
+		if err == nil {
+			return stream, nil
+		}
+		lease.Release()
+		lastErr = err
+		if core.IsClientCancelledError(err) {
+			break
+		}
+		retry, extraAttempt := e.recordFailure(lease.Index, lease.Session.SessionKey, err)
+		if extraAttempt && maxAttempts < sessionCount {
+			maxAttempts++
+		}
+		if !retry {
+			break
+		}
+		e.logEntry().Info(fmt.Sprintf("Retrying another session after error on session %d: %s", lease.Index+1, core.GetErrorMessage(err)))
+	}
+	e.logRequest(request.Model, lastIndex, nil, startTime, lastErr)
+	return nil, lastErr
+}
+
+// attempt runs request on one leased session and returns once the first event arrives.
+// On success the lease is handed to the stream, which releases it when the answer ends.
+func (e *Engine) attempt(ctx context.Context, lease *config.SessionLease, request Request, startTime time.Time) (*Stream, error) {
+	session := lease.Session
+	log := e.logEntry().WithField("session_label", fmt.Sprintf("S%d", lease.Index+1))
+	client := core.NewClientFromSession(session, e.cfg.Proxy, request.Model,
+		core.WithThinkingOptions(request.ThinkingMode, request.EffortLevel),
+		core.WithMessageLimitHandler(e.quotaRecorder(session.SessionKey)),
+		core.WithContext(ctx),
+		core.WithLogEntry(log),
+		core.WithUpstream(
+			e.upstream.BaseURL,
+			time.Duration(e.upstream.TimeoutSeconds)*time.Second,
+			time.Duration(e.upstream.ResponseHeaderTimeoutSeconds)*time.Second,
+		),
+		core.WithClientPool(e.clients),
+	)
+	if session.OrgID == "" {
+		orgID, err := client.GetOrgID()
+		if err != nil {
+			return nil, fmt.Errorf("failed to get org ID: %w", err)
+		}
+		session.OrgID = orgID
+		e.cfg.SetSessionOrgID(session.SessionKey, orgID, log)
+	}
+	client.SetOrgID(session.OrgID)
+	if len(request.Images) > 0 {
+		if err := client.UploadFile(request.Images); err != nil {
+			return nil, fmt.Errorf("failed to upload file: %w", err)
+		}
+	}
+	conversationID, err := client.CreateConversation()
+	if err != nil {
+		return nil, err
+	}
+
+	events := make(chan Event, streamBuffer)
+	results := make(chan streamResult, 1)
+	go func() {
+		usage, err := client.Complete(ctx, conversationID, request.Prompt, func(event Event) {
+			select {
+			case events <- event:
+			case <-ctx.Done():
+			}
+		})
+		close(events)
+		results <- streamResult{usage: usage, err: err}
+	}()
+
+	first, ok := <-events
+	if !ok || first.Type == core.EventError {
+		// A finished answer always ends with a usage event, so no events means it failed;
+		// an error before any content is retried on another session like a failed request.
+		for range events {
+		}
+		result := <-results
+		go e.cleanupConversation(client, conversationID)
+		if result.err == nil {
+			result.err = errors.New("empty response from Claude")
+		}
+		return nil, result.err
+	}
+	stream := &Stream{
+		first:  &first,
+		events: events,
+		done:   make(chan struct{}),
+	}
+	go func() {
+		result := <-results
+		e.finish(lease, client, conversationID, request.Model, startTime, result)
+		stream.result = result
+		close(stream.done)
+	}()
+	return stream, nil
+}
+
+// finish releases the lease of an answer that has ended and records how it went.
+func (e *Engine) finish(lease *config.SessionLease, client *core.Client, conversationID string, model string, startTime time.Time, result streamResult) {
+	lease.Release()
+	e.logRequest(model, lease.Index, result.usage, startTime, result.err)
+	switch {
+	case result.err == nil:
+		e.cfg.RecordSessionSuccess(lease.Session.SessionKey, time.Now())
+		if e.cfg.ChatDelete {
+			go e.cleanupConversation(client, conversationID)
+		}
+		return
+	case core.IsClientCancelledError(result.err):
+		e.logEntry().Info("Client cancelled, stopped Claude generation")
+	default:
+		e.recordFailure(lease.Index, lease.Session.SessionKey, result.err)
+	}
+	go e.cleanupConversation(client, conversationID)
+}
+
+// recordFailure applies a failed attempt to the session's health the way the server's
+// retry loop does. It reports whether another session should be tried, and whether the
+// failure should not count against the retry budget.
+func (e *Engine) recordFailure(index int, sessionKey string, err error) (retry bool, extraAttempt bool) {
+	now := time.Now()
+	log := e.logEntry()
+	if core.IsAuthError(err) {
+		if until, quarantined := e.cfg.RecordSessionAuthFailure(sessionKey, core.GetErrorMessage(err), now); quarantined {
+			log.Error(fmt.Sprintf("Session %d quarantined after authentication failures until %s", index+1, until.Format(time.RFC3339)))
+		}
+		// A dead key says nothing about the request, so it does not use up the retry budget.
+		return true, true
+	}
+	if core.IsRateLimitError(err) {
+		e.cfg.RecordSessionRateLimit(sessionKey, now)
+		if resetAt, ok := core.GetRateLimitResetAt(err); ok {
+			until, source := e.cfg.CooldownSessionAfterRateLimit(sessionKey, resetAt, now)
+			if source == config.CooldownSourceOfficial {
+				log.Error(fmt.Sprintf("Session %d hit rate limit; cooling down until %s", index+1, until.Format(time.RFC3339)))
+			}
+		}
+		return true, false
+	}
+	if !core.IsRetryableError(err) {
+		log.Error(fmt.Sprintf("Request failed with non-retryable error on session %d: %s", index+1, core.GetErrorMessage(err)))
+		return false, false
+	}
+	e.cfg.RecordSessionFailure(sessionKey)
+	return true, false
+}
+
+// quotaRecorder stores message_limit updates from the stream on the session.
+func (e *Engine) quotaRecorder(sessionKey string) func(core.MessageLimit) {
+	return func(limit core.MessageLimit) {
+		quota := config.SessionQuota{
+			Type:        limit.Type,
+			Remaining:   limit.Remaining,
+			ResetsAt:    limit.ResetsAt,
+			Utilization: limit.MaxUtilization(),
+		}
+		if until, ok := e.cfg.UpdateSessionQuota(sessionKey, quota, time.Now()); ok {
+			e.logEntry().Info(fmt.Sprintf("Session reported %s; cooling down until %s", limit.Type, until.Format(time.RFC3339)))
+		}
+	}
+}
+
+func (e *Engine) cleanupConversation(client *core.Client, conversationID string) {
+	if err := client.DeleteConversation(conversationID); err != nil {
+		e.logEntry().Error(fmt.Sprintf("Failed to delete conversation %s: %v", conversationID, err))
+	}
+}
+
+// logRequest records a Chat the way the server logs a request, so the error types that
+// feed the least_rate_limited strategy and the session stats mean the same in both.
+func (e *Engine) logRequest(model string, sessionIdx int, usage *TokenInfo, startTime time.Time, err error) {
+	entry := logger.RequestLog{
+		Timestamp:   startTime,
+		Model:       model,
+		StatusCode:  http.StatusOK,
+		Duration:    time.Since(startTime).Milliseconds(),
+		Success:     err == nil,
+		SessionIdx:  sessionIdx,
+		IsStreaming: true,
+	}
+	if sessionIdx >= 0 {
+		entry.SessionLabel = fmt.Sprintf("S%d", sessionIdx+1)
+	}
+	if usage != nil {
+		entry.InputTokens = usage.InputTokens
+		entry.OutputTokens = usage.OutputTokens
+	}
+	if err != nil {
+		entry.Error = core.GetErrorMessage(err)
+		entry.ErrorType = logger.ClassifyErrorType(entry.Error)
+		entry.StatusCode = http.StatusInternalServerError
+		if entry.ErrorType == logger.ErrorTypeClientCancelled {
+			entry.StatusCode = statusClientClosedRequest
+		}
+	}
+	e.requests.LogRequest(entry)
+}
+
+// advanceIndex returns the round robin start index for the next request.
+func (e *Engine) advanceIndex() int {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	index := e.nextIndex
+	e.nextIndex = (index + 1) % len(e.cfg.Sessions)
+	return index
+}
+
+func (e *Engine) logEntry() *logger.Entry {
+	if e.log == nil {
+		return logger.WithFields(nil)
+	}
+	return e.log
+}
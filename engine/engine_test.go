@@ -0,0 +1,137 @@
+package engine
+
+import (
+	"claude2api/config"
+	"claude2api/core"
+	"claude2api/fakeupstream"
+	"context"
+	"errors"
+	"io"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func newTestEngine(t *testing.T, server *httptest.Server, sessionKeys ...string) *Engine {
+	t.Helper()
+	cfg := Config{
+		InternalRetryCount: len(sessionKeys),
+		Upstream:           config.UpstreamConfig{BaseURL: server.URL, TimeoutSeconds: 5, ResponseHeaderTimeoutSeconds: 5},
+	}
+	for _, key := range sessionKeys {
+		cfg.Sessions = append(cfg.Sessions, Session{SessionKey: key})
+	}
+	e, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func readAnswer(t *testing.T, stream *Stream) string {
+	t.Helper()
+	var answer strings.Builder
+	for {
+		event, err := stream.Recv()
+		if errors.Is(err, io.EOF) {
+			return answer.String()
+		}
+		if err != nil {
+			t.Fatalf("stream failed: %v", err)
+		}
+		if event.Type == core.EventText {
+			answer.WriteString(event.Text)
+		}
+	}
+}
+
+func TestEnginesRetryAndKeepSeparateState(t *testing.T) {
+	fake := fakeupstream.New(fakeupstream.Options{Scripts: map[string][]string{
+		"sk-limited": {fakeupstream.ScenarioRateLimit, fakeupstream.ScenarioText},
+	}})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	first := newTestEngine(t, server, "sk-limited", "sk-ok")
+	stream, err := first.Chat(context.Background(), Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("expected the second session to answer, got %v", err)
+	}
+	if answer := readAnswer(t, stream); !strings.Contains(answer, "fake upstream") {
+		t.Fatalf("unexpected answer %q", answer)
+	}
+	if usage := stream.Usage(); usage == nil || usage.OutputTokens == 0 {
+		t.Fatalf("expected usage after the answer, got %+v", usage)
+	}
+	if until, cooling := first.cfg.GetSessionCooldownByIndex(0, time.Now()); !cooling || until.Before(time.Now().Add(50*time.Minute)) {
+		t.Fatalf("expected the rate limited session to cool down, got %s (%t)", until, cooling)
+	}
+
+	// A second engine shares nothing with the first, so the same key is still usable.
+	second := newTestEngine(t, server, "sk-limited")
+	stream, err = second.Chat(context.Background(), Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("expected the second engine to answer, got %v", err)
+	}
+	readAnswer(t, stream)
+
+	stats := first.Stats()
+	if stats.TotalRequests != 1 || stats.SuccessRequests != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestChatFailsWhenNoSessionCanAnswer(t *testing.T) {
+	fake := fakeupstream.New(fakeupstream.Options{Scripts: map[string][]string{
+		"sk-a": {fakeupstream.ScenarioUnauthorized},
+		"sk-b": {fakeupstream.ScenarioUnauthorized},
+	}})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	e := newTestEngine(t, server, "sk-a", "sk-b")
+	if _, err := e.Chat(context.Background(), Request{Prompt: "hi"}); !core.IsAuthError(err) {
+		t.Fatalf("expected an auth error, got %v", err)
+	}
+	if logs := e.requests.GetRecentLogs(1); len(logs) != 1 || logs[0].ErrorType != "认证失败" || logs[0].StatusCode != 500 {
+		t.Fatalf("expected the failure to be logged like the server does, got %+v", logs)
+	}
+	if _, err := New(Config{}); err == nil {
+		t.Fatal("expected an error without sessions")
+	}
+}
+
+func TestStreamErrorEndsTheAnswerWithAnError(t *testing.T) {
+	fake := fakeupstream.New(fakeupstream.Options{Scripts: map[string][]string{
+		"sk-a": {fakeupstream.ScenarioStreamError},
+	}})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+
+	e := newTestEngine(t, server, "sk-a")
+	stream, err := e.Chat(context.Background(), Request{Prompt: "hi"})
+	if err != nil {
+		t.Fatalf("expected the answer to start, got %v", err)
+	}
+	var sawError bool
+	for {
+		event, err := stream.Recv()
+		if event.Type == core.EventError {
+			sawError = true
+		}
+		if err == nil {
+			continue
+		}
+		if !core.IsStreamError(err) || !core.IsRetryableError(err) {
+			t.Fatalf("expected a retryable stream error, got %v", err)
+		}
+		break
+	}
+	if !sawError {
+		t.Fatal("expected an error event before the error")
+	}
+	if stats := e.Stats(); stats.FailedRequests != 1 || stats.SuccessRequests != 0 {
+		t.Fatalf("expected the answer to count as failed, got %+v", stats)
+	}
+}
@@ -0,0 +1,48 @@
+package engine
+
+import "io"
+
+// streamBuffer is how many events may wait unread before Claude's stream is held back.
+const streamBuffer = 64
+
+type streamResult struct {
+	usage *TokenInfo
+	err   error
+}
+
+// Stream is an answer from Claude as it arrives. It is not safe for concurrent use.
+type Stream struct {
+	first  *Event
+	events <-chan Event
+	// done is closed once the answer has ended and result is set.
+	done   chan struct{}
+	result streamResult
+}
+
+// Recv returns the next event of the answer. After the last event it returns io.EOF, or
+// the error that cut the answer short, such as core.ErrClientCancelled.
+func (s *Stream) Recv() (Event, error) {
+	if s.first != nil {
+		event := *s.first
+		s.first = nil
+		return event, nil
+	}
+	if event, ok := <-s.events; ok {
+		return event, nil
+	}
+	<-s.done
+	if s.result.err != nil {
+		return Event{}, s.result.err
+	}
+	return Event{}, io.EOF
+}
+
+// Usage returns the estimated token usage once Recv has returned io.EOF, or nil before.
+func (s *Stream) Usage() *TokenInfo {
+	select {
+	case <-s.done:
+		return s.result.usage
+	default:
+		return nil
+	}
+}
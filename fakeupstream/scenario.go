@@ -0,0 +1,225 @@
+package fakeupstream
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Scenarios a completion can play. Each one mimics a response shape that core.Client
+// handles differently.
+const (
+	// ScenarioText streams a plain text answer.
+	ScenarioText = "text"
+	// ScenarioThinking streams thinking deltas before the answer, like extended thinking.
+	ScenarioThinking = "thinking"
+	// ScenarioToolUse streams an artifacts tool call as partial JSON, then a short answer.
+	ScenarioToolUse = "tool_use"
+	// ScenarioCitations streams an answer with web search citations.
+	ScenarioCitations = "citations"
+	// ScenarioRateLimit answers 429 with a Retry-After header.
+	ScenarioRateLimit = "rate_limit"
+	// ScenarioRateLimitBody answers 429 with the reset time only in the JSON body.
+	ScenarioRateLimitBody = "rate_limit_body"
+	// ScenarioUnauthorized answers 401 on every endpoint, like an expired session key.
+	ScenarioUnauthorized = "unauthorized"
+	// ScenarioStreamError streams some text, then an SSE error event.
+	ScenarioStreamError = "stream_error"
+	// ScenarioStreamAbort streams some text, then drops the connection.
+	ScenarioStreamAbort = "stream_abort"
+)
+
+var scenarios = map[string]bool{
+	ScenarioText:          true,
+	ScenarioThinking:      true,
+	ScenarioToolUse:       true,
+	ScenarioCitations:     true,
+	ScenarioRateLimit:     true,
+	ScenarioRateLimitBody: true,
+	ScenarioUnauthorized:  true,
+	ScenarioStreamError:   true,
+	ScenarioStreamAbort:   true,
+}
+
+// Scenarios lists the known scenario names in sorted order.
+func Scenarios() []string {
+	names := make([]string, 0, len(scenarios))
+	for name := range scenarios {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// ParseScript reads a comma separated list of scenarios, such as "rate_limit,text".
+func ParseScript(raw string) ([]string, error) {
+	var script []string
+	for _, part := range strings.Split(raw, ",") {
+		name := strings.ToLower(strings.TrimSpace(part))
+		if name == "" {
+			continue
+		}
+		if !scenarios[name] {
+			return nil, fmt.Errorf("unknown scenario %q (known: %s)", name, strings.Join(Scenarios(), ", "))
+		}
+		script = append(script, name)
+	}
+	return script, nil
+}
+
+// scenarioFromPrompt finds a "scenario:<name>" marker in a prompt, so any OpenAI client
+// can pick a scenario per request.
+func scenarioFromPrompt(prompt string) string {
+	lower := strings.ToLower(prompt)
+	for {
+		index := strings.Index(lower, "scenario:")
+		if index < 0 {
+			return ""
+		}
+		lower = lower[index+len("scenario:"):]
+		end := strings.IndexFunc(lower, func(r rune) bool {
+			return !(r == '_' || r >= 'a' && r <= 'z')
+		})
+		name := lower
+		if end >= 0 {
+			name = lower[:end]
+		}
+		if scenarios[name] {
+			return name
+		}
+	}
+}
+
+// event is one SSE event of a completion stream.
+type event struct {
+	name string
+	data map[string]interface{}
+}
+
+func textEvents(index int, chunks ...string) []event {
+	events := []event{{"content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         index,
+		"content_block": map[string]interface{}{"type": "text", "text": ""},
+	}}}
+	for _, chunk := range chunks {
+		events = append(events, event{"content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": index,
+			"delta": map[string]interface{}{"type": "text_delta", "text": chunk},
+		}})
+	}
+	return append(events, blockStop(index))
+}
+
+func thinkingEvents(index int, chunks ...string) []event {
+	events := []event{{"content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         index,
+		"content_block": map[string]interface{}{"type": "thinking", "thinking": ""},
+	}}}
+	for _, chunk := range chunks {
+		events = append(events, event{"content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": index,
+			"delta": map[string]interface{}{"type": "thinking_delta", "thinking": chunk},
+		}})
+	}
+	return append(events, blockStop(index))
+}
+
+// toolUseEvents streams an artifacts call the way claude.ai splits it: the language and
+// content keys arrive as their own partial JSON fragments.
+func toolUseEvents(index int) []event {
+	fragments := []string{
+		`{"id": "fake-script"`,
+		`,"language":`,
+		`"python`,
+		`,"content":`,
+		`"print(`,
+		`'hello from the fake upstream')\n`,
+		`"}`,
+	}
+	events := []event{{"content_block_start", map[string]interface{}{
+		"type":          "content_block_start",
+		"index":         index,
+		"content_block": map[string]interface{}{"type": "tool_use", "name": "artifacts", "input": map[string]interface{}{}},
+	}}}
+	for _, fragment := range fragments {
+		events = append(events, event{"content_block_delta", map[string]interface{}{
+			"type":  "content_block_delta",
+			"index": index,
+			"delta": map[string]interface{}{"type": "input_json_delta", "partial_json": fragment},
+		}})
+	}
+	events = append(events, blockStop(index))
+	events = append(events,
+		event{"content_block_start", map[string]interface{}{
+			"type":          "content_block_start",
+			"index":         index + 1,
+			"content_block": map[string]interface{}{"type": "tool_result", "name": "artifacts", "content": []interface{}{}},
+		}},
+		blockStop(index+1),
+	)
+	return events
+}
+
+func citationEvents(index int) []event {
+	events := textEvents(index, "Go 1.22 added method and wildcard patterns to ServeMux.")
+	citation := event{"content_block_delta", map[string]interface{}{
+		"type":  "content_block_delta",
+		"index": index,
+		"delta": map[string]interface{}{
+			"type": "citation_start_delta",
+			"citation": map[string]interface{}{
+				"uuid":  "fake-citation",
+				"title": "Go 1.22 Release Notes",
+				"url":   "https://go.dev/doc/go1.22",
+			},
+		},
+	}}
+	// Place the citation just before the block stops, as claude.ai does.
+	last := len(events) - 1
+	return append(events[:last:last], citation, events[last])
+}
+
+func blockStop(index int) event {
+	return event{"content_block_stop", map[string]interface{}{"type": "content_block_stop", "index": index}}
+}
+
+func messageStart(model string) event {
+	return event{"message_start", map[string]interface{}{
+		"type": "message_start",
+		"message": map[string]interface{}{
+			"id":    "msg_fake",
+			"type":  "message",
+			"role":  "assistant",
+			"model": model,
+		},
+	}}
+}
+
+func messageLimit(now time.Time) event {
+	return event{"message_limit", map[string]interface{}{
+		"type": "message_limit",
+		"message_limit": map[string]interface{}{
+			"type":      "within_limit",
+			"resetsAt":  now.Add(5 * time.Hour).Unix(),
+			"remaining": nil,
+			"windows": map[string]interface{}{
+				"5h": map[string]interface{}{"status": "within_limit", "resets_at": now.Add(5 * time.Hour).Unix(), "utilization": 0.1},
+			},
+		},
+	}}
+}
+
+func messageEnd() []event {
+	return []event{
+		{"message_delta", map[string]interface{}{
+			"type":  "message_delta",
+			"delta": map[string]interface{}{"stop_reason": "end_turn", "stop_sequence": nil},
+		}},
+		{"message_stop", map[string]interface{}{"type": "message_stop"}},
+	}
+}
@@ -0,0 +1,351 @@
+// Package fakeupstream is a stand-in for the claude.ai endpoints core.Client calls, so
+// routing, cooldowns and streaming can be exercised end to end without real accounts.
+// Point upstream.baseURL at it and give the proxy any session keys.
+//
+// Each completion plays a scenario. It is chosen by a "scenario:<name>" marker in the
+// prompt, else by the next step of the session key's script, else the default.
+package fakeupstream
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	DefaultOrgID      = "00000000-0000-4000-8000-00000000f00d"
+	DefaultRetryAfter = time.Hour
+)
+
+// Options configures a Server. Zero values fall back to the defaults.
+type Options struct {
+	// OrgID is the single organization every session belongs to.
+	OrgID string
+	// DefaultScenario is played when neither the prompt nor a script picks one.
+	DefaultScenario string
+	// Scripts maps a session key to the scenarios of its successive completions. The
+	// last step repeats once the script is used up.
+	Scripts map[string][]string
+	// ChunkDelay is the pause between SSE events, to make streaming visible.
+	ChunkDelay time.Duration
+	// RetryAfter is how far in the future rate limit responses reset.
+	RetryAfter time.Duration
+}
+
+// Stats counts the calls a Server has answered, by endpoint and by scenario played.
+type Stats struct {
+	Organizations int            `json:"organizations"`
+	Conversations int            `json:"conversations"`
+	Completions   int            `json:"completions"`
+	Uploads       int            `json:"uploads"`
+	Settings      int            `json:"settings"`
+	Deletes       int            `json:"deletes"`
+	Stops         int            `json:"stops"`
+	Scenarios     map[string]int `json:"scenarios"`
+}
+
+// Server serves the fake claude.ai API.
+type Server struct {
+	opts  Options
+	mux   *http.ServeMux
+	now   func() time.Time
+	mu    sync.Mutex
+	steps map[string]int
+	stats Stats
+}
+
+func New(opts Options) *Server {
+	if opts.OrgID == "" {
+		opts.OrgID = DefaultOrgID
+	}
+	if opts.DefaultScenario == "" {
+		opts.DefaultScenario = ScenarioText
+	}
+	if opts.RetryAfter <= 0 {
+		opts.RetryAfter = DefaultRetryAfter
+	}
+	s := &Server{
+		opts:  opts,
+		mux:   http.NewServeMux(),
+		now:   time.Now,
+		steps: make(map[string]int),
+		stats: Stats{Scenarios: make(map[string]int)},
+	}
+	s.mux.HandleFunc("GET /api/organizations", s.authorized(s.handleOrganizations))
+	s.mux.HandleFunc("POST /api/organizations/{org}/chat_conversations", s.authorized(s.handleCreateConversation))
+	s.mux.HandleFunc("DELETE /api/organizations/{org}/chat_conversations/{conversation}", s.authorized(s.handleDeleteConversation))
+	s.mux.HandleFunc("POST /api/organizations/{org}/chat_conversations/{conversation}/completion", s.authorized(s.handleCompletion))
+	s.mux.HandleFunc("POST /api/organizations/{org}/chat_conversations/{conversation}/stop_response", s.authorized(s.handleStopResponse))
+	s.mux.HandleFunc("POST /api/{org}/upload", s.authorized(s.handleUpload))
+	s.mux.HandleFunc("PUT /api/account", s.authorized(s.handleAccount))
+	s.mux.HandleFunc("GET /fake/stats", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, s.Stats())
+	})
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mux.ServeHTTP(w, r)
+}
+
+// SetScript replaces the script of a session key and restarts it.
+func (s *Server) SetScript(sessionKey string, script []string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.opts.Scripts == nil {
+		s.opts.Scripts = make(map[string][]string)
+	}
+	s.opts.Scripts[sessionKey] = script
+	delete(s.steps, sessionKey)
+}
+
+// Stats returns a copy of the call counters.
+func (s *Server) Stats() Stats {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stats := s.stats
+	stats.Scenarios = make(map[string]int, len(s.stats.Scenarios))
+	for name, count := range s.stats.Scenarios {
+		stats.Scenarios[name] = count
+	}
+	return stats
+}
+
+// authorized rejects requests without a sessionKey cookie, or whose session is currently
+// scripted as unauthorized, before counting and handling them.
+func (s *Server) authorized(next func(http.ResponseWriter, *http.Request, string)) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		cookie, err := r.Cookie("sessionKey")
+		if err != nil || cookie.Value == "" || s.currentStep(cookie.Value) == ScenarioUnauthorized {
+			writeError(w, http.StatusUnauthorized, "authentication_error", "Invalid authorization")
+			return
+		}
+		if org := r.PathValue("org"); org != "" && org != s.opts.OrgID {
+			writeError(w, http.StatusForbidden, "permission_error", "Organization not found")
+			return
+		}
+		next(w, r, cookie.Value)
+	}
+}
+
+// currentStep returns the scripted scenario of the session's next completion without
+// consuming it.
+func (s *Server) currentStep(sessionKey string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	script := s.opts.Scripts[sessionKey]
+	if len(script) == 0 {
+		return ""
+	}
+	step := s.steps[sessionKey]
+	if step >= len(script) {
+		step = len(script) - 1
+	}
+	return script[step]
+}
+
+// nextScenario picks and counts the scenario of a completion. A prompt marker wins and
+// leaves the script untouched; otherwise the session's next script step is consumed.
+func (s *Server) nextScenario(sessionKey string, prompt string) string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	scenario := scenarioFromPrompt(prompt)
+	if scenario == "" {
+		scenario = s.opts.DefaultScenario
+		if script := s.opts.Scripts[sessionKey]; len(script) > 0 {
+			step := s.steps[sessionKey]
+			if step >= len(script) {
+				step = len(script) - 1
+			}
+			scenario = script[step]
+			s.steps[sessionKey] = step + 1
+		}
+	}
+	s.stats.Completions++
+	s.stats.Scenarios[scenario]++
+	return scenario
+}
+
+func (s *Server) count(counter *int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	*counter++
+}
+
+func (s *Server) handleOrganizations(w http.ResponseWriter, r *http.Request, sessionKey string) {
+	s.count(&s.stats.Organizations)
+	writeJSON(w, http.StatusOK, []map[string]interface{}{{
+		"id":              1,
+		"uuid":            s.opts.OrgID,
+		"name":            "Fake Organization",
+		"rate_limit_tier": "default_claude_ai",
+		"capabilities":    []string{"chat", "claude_pro"},
+	}})
+}
+
+func (s *Server) handleCreateConversation(w http.ResponseWriter, r *http.Request, sessionKey string) {
+	s.count(&s.stats.Conversations)
+	var body struct {
+		UUID  string `json:"uuid"`
+		Model string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON body")
+		return
+	}
+	if body.UUID == "" {
+		body.UUID = uuid.New().String()
+	}
+	writeJSON(w, http.StatusCreated, map[string]interface{}{
+		"uuid":       body.UUID,
+		"name":       "",
+		"model":      body.Model,
+		"created_at": s.now().UTC().Format(time.RFC3339),
+	})
+}
+
+func (s *Server) handleDeleteConversation(w http.ResponseWriter, r *http.Request, sessionKey string) {
+	s.count(&s.stats.Deletes)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) handleStopResponse(w http.ResponseWriter, r *http.Request, sessionKey string) {
+	s.count(&s.stats.Stops)
+	writeJSON(w, http.StatusOK, map[string]interface{}{})
+}
+
+func (s *Server) handleUpload(w http.ResponseWriter, r *http.Request, sessionKey string) {
+	s.count(&s.stats.Uploads)
+	file, header, err := r.FormFile("file")
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Missing file")
+		return
+	}
+	defer file.Close()
+	size, _ := io.Copy(io.Discard, file)
+	writeJSON(w, http.StatusOK, map[string]interface{}{
+		"file_uuid":  uuid.New().String(),
+		"file_name":  header.Filename,
+		"size_bytes": size,
+	})
+}
+
+func (s *Server) handleAccount(w http.ResponseWriter, r *http.Request, sessionKey string) {
+	s.count(&s.stats.Settings)
+	writeJSON(w, http.StatusAccepted, map[string]interface{}{})
+}
+
+func (s *Server) handleCompletion(w http.ResponseWriter, r *http.Request, sessionKey string) {
+	var body struct {
+		Prompt string `json:"prompt"`
+		Model  string `json:"model"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid_request_error", "Invalid JSON body")
+		return
+	}
+	now := s.now()
+	switch scenario := s.nextScenario(sessionKey, body.Prompt); scenario {
+	case ScenarioRateLimit:
+		w.Header().Set("Retry-After", strconv.Itoa(int(s.opts.RetryAfter/time.Second)))
+		writeError(w, http.StatusTooManyRequests, "rate_limit_error", "Rate limited. Please try again later.")
+	case ScenarioRateLimitBody:
+		writeJSON(w, http.StatusTooManyRequests, map[string]interface{}{
+			"type": "error",
+			"error": map[string]interface{}{
+				"type":     "rate_limit_error",
+				"message":  "exceeded_limit",
+				"resetsAt": now.Add(s.opts.RetryAfter).Unix(),
+			},
+		})
+	default:
+		s.stream(w, r, scenario, body.Model, now)
+	}
+}
+
+func (s *Server) stream(w http.ResponseWriter, r *http.Request, scenario string, model string, now time.Time) {
+	events := []event{messageStart(model)}
+	switch scenario {
+	case ScenarioThinking:
+		events = append(events, thinkingEvents(0, "The user wants a short answer. ", "I will keep it brief.")...)
+		events = append(events, textEvents(1, "Here is the answer ", "after some thought.")...)
+	case ScenarioToolUse:
+		events = append(events, textEvents(0, "Here is a script:")...)
+		events = append(events, toolUseEvents(1)...)
+		events = append(events, textEvents(3, "Run it with python3.")...)
+	case ScenarioCitations:
+		events = append(events, citationEvents(0)...)
+	case ScenarioStreamError, ScenarioStreamAbort:
+		// The block start and first delta, but no block stop: the stream breaks mid-answer.
+		events = append(events, textEvents(0, "This answer will not ")[:2]...)
+	default:
+		events = append(events, textEvents(0, "Hello", " from the", " fake upstream.")...)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher, _ := w.(http.Flusher)
+	for _, e := range events {
+		if !s.writeEvent(w, r, flusher, e) {
+			return
+		}
+	}
+	switch scenario {
+	case ScenarioStreamError:
+		s.writeEvent(w, r, flusher, event{"error", map[string]interface{}{
+			"type":  "error",
+			"error": map[string]interface{}{"type": "overloaded_error", "message": "Overloaded"},
+		}})
+		return
+	case ScenarioStreamAbort:
+		// Drops the connection without finishing the chunked body.
+		panic(http.ErrAbortHandler)
+	}
+	for _, e := range append([]event{messageLimit(now)}, messageEnd()...) {
+		if !s.writeEvent(w, r, flusher, e) {
+			return
+		}
+	}
+}
+
+// writeEvent writes one SSE event after ChunkDelay; it reports false once the client is gone.
+func (s *Server) writeEvent(w http.ResponseWriter, r *http.Request, flusher http.Flusher, e event) bool {
+	if s.opts.ChunkDelay > 0 {
+		select {
+		case <-r.Context().Done():
+			return false
+		case <-time.After(s.opts.ChunkDelay):
+		}
+	}
+	data, err := json.Marshal(e.data)
+	if err != nil {
+		return false
+	}
+	if _, err := fmt.Fprintf(w, "event: %s\ndata: %s\n\n", e.name, data); err != nil {
+		return false
+	}
+	if flusher != nil {
+		flusher.Flush()
+	}
+	return true
+}
+
+func writeJSON(w http.ResponseWriter, status int, body interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
+}
+
+func writeError(w http.ResponseWriter, status int, errorType string, message string) {
+	writeJSON(w, status, map[string]interface{}{
+		"type":  "error",
+		"error": map[string]interface{}{"type": errorType, "message": message},
+	})
+}
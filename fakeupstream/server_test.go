@@ -0,0 +1,107 @@
+package fakeupstream
+
+import (
+	"claude2api/config"
+	"claude2api/core"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func newTestClient(t *testing.T, server *httptest.Server, sessionKey string) *core.Client {
+	t.Helper()
+	client := core.NewClientFromSession(config.SessionInfo{SessionKey: sessionKey}, "", "claude-sonnet-4-6",
+		core.WithUpstream(server.URL, 5*time.Second, 5*time.Second))
+	orgID, err := client.GetOrgID()
+	if err != nil {
+		t.Fatalf("failed to get org ID: %v", err)
+	}
+	client.SetOrgID(orgID)
+	return client
+}
+
+func complete(t *testing.T, client *core.Client, prompt string) (string, error) {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	gc, _ := gin.CreateTestContext(recorder)
+	gc.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", nil)
+	conversationID, err := client.CreateConversation()
+	if err != nil {
+		t.Fatalf("failed to create conversation: %v", err)
+	}
+	_, err = client.SendMessage(conversationID, prompt, true, gc)
+	return recorder.Body.String(), err
+}
+
+func TestScenariosDriveCoreClient(t *testing.T) {
+	fake := New(Options{})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := newTestClient(t, server, "sk-fake")
+
+	cases := map[string]string{
+		ScenarioText:      `"content":" fake upstream."`,
+		ScenarioThinking:  `"content":"\u003c/think\u003e\n"`,
+		ScenarioToolUse:   "```python\\nprint(",
+		ScenarioCitations: "https://go.dev/doc/go1.22",
+	}
+	for scenario, want := range cases {
+		body, err := complete(t, client, "scenario:"+scenario+" please")
+		if err != nil {
+			t.Fatalf("%s: unexpected error: %v", scenario, err)
+		}
+		if !strings.Contains(body, want) || !strings.HasSuffix(body, "data: [DONE]\n\n") {
+			t.Fatalf("%s: expected %q in a finished stream, got %q", scenario, want, body)
+		}
+	}
+	if got := fake.Stats().Scenarios[ScenarioToolUse]; got != 1 {
+		t.Fatalf("expected one tool use completion, got %d", got)
+	}
+}
+
+func TestScriptedFailuresSurfaceAsCoreErrors(t *testing.T) {
+	fake := New(Options{Scripts: map[string][]string{
+		"sk-limited": {ScenarioRateLimit, ScenarioRateLimitBody, ScenarioStreamAbort, ScenarioText},
+	}})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	client := newTestClient(t, server, "sk-limited")
+
+	for _, scenario := range []string{ScenarioRateLimit, ScenarioRateLimitBody} {
+		_, err := complete(t, client, "hi")
+		if !core.IsRateLimitError(err) {
+			t.Fatalf("%s: expected a rate limit error, got %v", scenario, err)
+		}
+		if resetAt, ok := core.GetRateLimitResetAt(err); !ok || resetAt.Before(time.Now().Add(50*time.Minute)) {
+			t.Fatalf("%s: expected the reset time about an hour ahead, got %s (%t)", scenario, resetAt, ok)
+		}
+	}
+	if _, err := complete(t, client, "hi"); err == nil || !core.IsRetryableError(err) {
+		t.Fatalf("expected a retryable error for the dropped stream, got %v", err)
+	}
+	if body, err := complete(t, client, "hi"); err != nil || !strings.Contains(body, "fake upstream") {
+		t.Fatalf("expected the script to end on text, got %q (%v)", body, err)
+	}
+
+	fake.SetScript("sk-expired", []string{ScenarioUnauthorized})
+	expired := core.NewClientFromSession(config.SessionInfo{SessionKey: "sk-expired"}, "", "",
+		core.WithUpstream(server.URL, time.Second, time.Second))
+	if _, err := expired.GetOrganizations(); !core.IsAuthError(err) {
+		t.Fatalf("expected an auth error, got %v", err)
+	}
+}
+
+func TestParseScriptRejectsUnknownScenario(t *testing.T) {
+	script, err := ParseScript(" rate_limit, TEXT ,")
+	if err != nil || len(script) != 2 || script[1] != ScenarioText {
+		t.Fatalf("unexpected script %v (%v)", script, err)
+	}
+	if _, err := ParseScript("text,teapot"); err == nil {
+		t.Fatal("expected an error for an unknown scenario")
+	}
+}
@@ -0,0 +1,30 @@
+package logger
+
+import "strings"
+
+// ErrorTypeClientCancelled is the error type of requests the client abandoned.
+const ErrorTypeClientCancelled = "客户端取消"
+
+// ClassifyErrorType sorts an error message into the category shown in the request log.
+func ClassifyErrorType(errMsg string) string {
+	if errMsg == "" {
+		return ""
+	}
+
+	lowerErr := strings.ToLower(errMsg)
+
+	switch {
+	case strings.Contains(lowerErr, "client cancelled"):
+		return ErrorTypeClientCancelled
+	case strings.Contains(lowerErr, "invalid request") || strings.Contains(lowerErr, "bind") || strings.Contains(lowerErr, "parse"):
+		return "请求解析失败"
+	case strings.Contains(lowerErr, "rate limit") || strings.Contains(lowerErr, "429") || strings.Contains(lowerErr, "retry-after"):
+		return "限流"
+	case strings.Contains(lowerErr, "auth") || strings.Contains(lowerErr, "unauthorized") || strings.Contains(lowerErr, "forbidden") || strings.Contains(lowerErr, "api key"):
+		return "认证失败"
+	case strings.Contains(lowerErr, "claude") || strings.Contains(lowerErr, "conversation") || strings.Contains(lowerErr, "send message"):
+		return "Claude 接口错误"
+	default:
+		return "未知错误"
+	}
+}
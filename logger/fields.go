@@ -0,0 +1,65 @@
+package logger
+
+// Fields are structured key/value pairs attached to a log line, such as request_id,
+// session_label or model. In the text format they are appended as key=value.
+type Fields map[string]interface{}
+
+// Entry logs with a fixed set of fields.
+type Entry struct {
+	fields Fields
+}
+
+// WithFields returns an entry that adds fields to every line it logs.
+func WithFields(fields Fields) *Entry {
+	copied := make(Fields, len(fields))
+	for key, value := range fields {
+		copied[key] = value
+	}
+	return &Entry{fields: copied}
+}
+
+// WithField returns a copy of the entry with one more field; empty values are skipped.
+func (e *Entry) WithField(key string, value interface{}) *Entry {
+	next := WithFields(e.fieldsOrNil())
+	if value != nil && value != "" {
+		next.fields[key] = value
+	}
+	return next
+}
+
+func (e *Entry) fieldsOrNil() Fields {
+	if e == nil {
+		return nil
+	}
+	return e.fields
+}
+
+func (e *Entry) Debug(format string, args ...interface{}) {
+	log(DEBUG, e.fieldsOrNil(), format, args...)
+}
+
+func (e *Entry) Info(format string, args ...interface{}) {
+	log(INFO, e.fieldsOrNil(), format, args...)
+}
+
+func (e *Entry) Warn(format string, args ...interface{}) {
+	log(WARN, e.fieldsOrNil(), format, args...)
+}
+
+func (e *Entry) Error(format string, args ...interface{}) {
+	log(ERROR, e.fieldsOrNil(), format, args...)
+}
+
+func (f Fields) redacted() Fields {
+	if len(f) == 0 {
+		return f
+	}
+	result := make(Fields, len(f))
+	for key, value := range f {
+		if text, ok := value.(string); ok {
+			value = Redact(text)
+		}
+		result[key] = value
+	}
+	return result
+}
@@ -0,0 +1,141 @@
+package logger
+
+import (
+	"fmt"
+	"strings"
+	"time"
+)
+
+// LogFilter selects request logs; zero-valued fields match everything.
+type LogFilter struct {
+	// Start and End bound Timestamp as [Start, End).
+	Start       time.Time
+	End         time.Time
+	Model       string
+	SessionIdx  *int
+	Success     *bool
+	ErrorType   string
+	Streaming   *bool
+	ClientKey   string
+	MinDuration int64
+	RequestID   string
+	// Search is a case-insensitive substring matched against the error message.
+	Search string
+}
+
+// IsEmpty reports whether the filter matches every log.
+func (f LogFilter) IsEmpty() bool {
+	return f.Start.IsZero() && f.End.IsZero() && f.Model == "" && f.SessionIdx == nil &&
+		f.Success == nil && f.ErrorType == "" && f.Streaming == nil && f.ClientKey == "" &&
+		f.MinDuration <= 0 && f.RequestID == "" && f.Search == ""
+}
+
+func (f LogFilter) Match(log RequestLog) bool {
+	if !f.Start.IsZero() && log.Timestamp.Before(f.Start) {
+		return false
+	}
+	if !f.End.IsZero() && !log.Timestamp.Before(f.End) {
+		return false
+	}
+	if f.Model != "" && !strings.EqualFold(log.Model, f.Model) {
+		return false
+	}
+	if f.SessionIdx != nil && log.SessionIdx != *f.SessionIdx {
+		return false
+	}
+	if f.Success != nil && log.Success != *f.Success {
+		return false
+	}
+	if f.ErrorType != "" && log.ErrorType != f.ErrorType {
+		return false
+	}
+	if f.Streaming != nil && log.IsStreaming != *f.Streaming {
+		return false
+	}
+	if f.ClientKey != "" && log.ClientKey != f.ClientKey {
+		return false
+	}
+	if f.MinDuration > 0 && log.Duration < f.MinDuration {
+		return false
+	}
+	if f.RequestID != "" && log.RequestID != f.RequestID {
+		return false
+	}
+	if f.Search != "" && !strings.Contains(strings.ToLower(log.Error), strings.ToLower(f.Search)) {
+		return false
+	}
+	return true
+}
+
+// EachLog calls fn for every log matching the filter, oldest first. History comes
+// from the sink when it holds at least as many logs as the in-memory cache; it is
+// read without holding the logger's lock, so fn never blocks new requests.
+func (rl *RequestLogger) EachLog(filter LogFilter, fn func(RequestLog) bool) {
+	rl.mu.RLock()
+	sink := rl.sink
+	useSink := sink != nil && sink.Count() >= len(rl.logs)
+	rl.mu.RUnlock()
+
+	if useSink {
+		err := sink.Scan(filter.Start, filter.End, func(log RequestLog) bool {
+			if !filter.Match(log) {
+				return true
+			}
+			return fn(log)
+		})
+		if err == nil {
+			return
+		}
+		Error(fmt.Sprintf("Failed to read request log history: %v", err))
+	}
+	for _, log := range rl.cachedLogs() {
+		if filter.Match(log) && !fn(log) {
+			return
+		}
+	}
+}
+
+// QueryLogs returns one page of the logs matching the filter, newest first, with
+// the total number of matches. It counts the matches first and then reads only the
+// page, so memory stays bounded by the page size however many logs match; logs
+// appended between the two passes are newer than the page and do not shift it.
+func (rl *RequestLogger) QueryLogs(filter LogFilter, page, pageSize int) ([]RequestLog, int, bool) {
+	if page < 1 {
+		page = 1
+	}
+	if pageSize < 1 {
+		pageSize = 10
+	}
+	if pageSize > 100 {
+		pageSize = 100
+	}
+
+	total := 0
+	rl.EachLog(filter, func(RequestLog) bool {
+		total++
+		return true
+	})
+
+	endIdx := total - (page-1)*pageSize
+	if endIdx <= 0 {
+		return []RequestLog{}, total, false
+	}
+	startIdx := endIdx - pageSize
+	if startIdx < 0 {
+		startIdx = 0
+	}
+
+	result := make([]RequestLog, 0, endIdx-startIdx)
+	position := 0
+	rl.EachLog(filter, func(log RequestLog) bool {
+		if position >= startIdx {
+			result = append(result, log)
+		}
+		position++
+		return position < endIdx
+	})
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result, total, startIdx > 0
+}
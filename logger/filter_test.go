@@ -0,0 +1,54 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestQueryLogsAppliesFilters(t *testing.T) {
+	requestLogger := NewRequestLogger(100)
+	start := time.Date(2026, 7, 10, 8, 0, 0, 0, time.Local)
+	for i := 0; i < 10; i++ {
+		log := RequestLog{
+			Timestamp:   start.Add(time.Duration(i) * time.Minute),
+			Model:       "claude-sonnet-4-6",
+			Success:     i%2 == 0,
+			SessionIdx:  i % 3,
+			Duration:    int64(i * 100),
+			IsStreaming: i < 5,
+			ClientKey:   "sk-c...ient",
+		}
+		if !log.Success {
+			log.ErrorType = "限流"
+			log.Error = "Rate limit exceeded on attempt"
+		}
+		requestLogger.LogRequest(log)
+	}
+
+	failed := false
+	logs, total, hasMore := requestLogger.QueryLogs(LogFilter{Success: &failed, Search: "RATE LIMIT"}, 1, 2)
+	if total != 5 || !hasMore || len(logs) != 2 || logs[0].Timestamp != start.Add(9*time.Minute) {
+		t.Fatalf("unexpected failed page: total=%d hasMore=%t logs=%+v", total, hasMore, logs)
+	}
+
+	session := 0
+	streaming := true
+	logs, total, _ = requestLogger.QueryLogs(LogFilter{
+		Start:       start.Add(time.Minute),
+		End:         start.Add(9 * time.Minute),
+		SessionIdx:  &session,
+		Streaming:   &streaming,
+		MinDuration: 200,
+		ClientKey:   "sk-c...ient",
+	}, 1, 10)
+	if total != 1 || logs[0].Duration != 300 {
+		t.Fatalf("expected only the 4th request, got total=%d logs=%+v", total, logs)
+	}
+
+	if _, total, _ := requestLogger.QueryLogs(LogFilter{Model: "claude-opus-4-6"}, 1, 10); total != 0 {
+		t.Fatalf("expected no logs for another model, got %d", total)
+	}
+	if _, total, hasMore := requestLogger.QueryLogs(LogFilter{ErrorType: "限流"}, 9, 10); total != 5 || hasMore {
+		t.Fatalf("expected an empty page past the end, got total=%d hasMore=%t", total, hasMore)
+	}
+}
@@ -57,48 +57,42 @@ func GetLevelName(level int) string {
 }
 
 // 基础日志打印函数
-func log(level int, format string, args ...interface{}) {
+func log(level int, fields Fields, format string, args ...interface{}) {
 	if level < logLevel {
 		return
 	}
 
-	now := time.Now().Format("2006-01-02 15:04:05.000")
-	levelName := levelNames[level]
-	colorFunc := levelColors[level]
-
 	logContent := fmt.Sprintf(format, args...)
-	logPrefix := fmt.Sprintf("[%s] [%s] ", now, levelName)
-
-	// 使用颜色输出日志级别
-	fmt.Fprintf(os.Stdout, "%s%s\n", logPrefix, colorFunc(logContent))
+	write(level, time.Now(), logContent, fields)
 
 	// 如果是致命错误，则退出程序
 	if level == FATAL {
+		Close()
 		os.Exit(1)
 	}
 }
 
 // Debug 打印调试日志
 func Debug(format string, args ...interface{}) {
-	log(DEBUG, format, args...)
+	log(DEBUG, nil, format, args...)
 }
 
 // Info 打印信息日志
 func Info(format string, args ...interface{}) {
-	log(INFO, format, args...)
+	log(INFO, nil, format, args...)
 }
 
 // Warn 打印警告日志
 func Warn(format string, args ...interface{}) {
-	log(WARN, format, args...)
+	log(WARN, nil, format, args...)
 }
 
 // Error 打印错误日志
 func Error(format string, args ...interface{}) {
-	log(ERROR, format, args...)
+	log(ERROR, nil, format, args...)
 }
 
 // Fatal 打印致命错误日志并退出程序
 func Fatal(format string, args ...interface{}) {
-	log(FATAL, format, args...)
+	log(FATAL, nil, format, args...)
 }
@@ -0,0 +1,154 @@
+package logger
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// Output formats.
+const (
+	FormatText = "text"
+	FormatJSON = "json"
+)
+
+// Options controls where and how log lines are written.
+type Options struct {
+	Level  int
+	Format string
+	// FilePath, when set, also writes plain (uncolored) lines to a size-rotated file.
+	FilePath   string
+	MaxBytes   int64
+	MaxBackups int
+	// Redact masks session keys, cookies, API keys and org IDs before lines are written.
+	Redact bool
+}
+
+var (
+	outputMu sync.Mutex
+	output   = struct {
+		format string
+		redact bool
+		stdout io.Writer
+		file   *rotatingFile
+	}{format: FormatText, redact: true, stdout: os.Stdout}
+)
+
+// Configure applies logging options, replacing any previously opened log file.
+func Configure(opts Options) error {
+	var file *rotatingFile
+	if opts.FilePath != "" {
+		var err error
+		if file, err = openRotatingFile(opts.FilePath, opts.MaxBytes, opts.MaxBackups); err != nil {
+			return err
+		}
+	}
+
+	SetLevel(opts.Level)
+	outputMu.Lock()
+	previous := output.file
+	output.format = opts.Format
+	if output.format != FormatJSON {
+		output.format = FormatText
+	}
+	output.redact = opts.Redact
+	output.file = file
+	outputMu.Unlock()
+
+	if previous != nil {
+		return previous.Close()
+	}
+	return nil
+}
+
+// Close flushes and closes the log file, if any; later lines go to stdout only.
+func Close() error {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+	if output.file == nil {
+		return nil
+	}
+	err := output.file.Close()
+	output.file = nil
+	return err
+}
+
+// ParseLevel maps a level name such as "info" or "WARN" to its constant.
+func ParseLevel(name string) (int, bool) {
+	name = strings.ToUpper(strings.TrimSpace(name))
+	if name == "WARNING" {
+		name = "WARN"
+	}
+	for level, levelName := range levelNames {
+		if levelName == name {
+			return level, true
+		}
+	}
+	return INFO, false
+}
+
+func write(level int, now time.Time, message string, fields Fields) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	if output.redact {
+		message = Redact(message)
+		fields = fields.redacted()
+	}
+
+	if output.format == FormatJSON {
+		line := jsonLine(level, now, message, fields)
+		output.stdout.Write(line)
+		if output.file != nil {
+			output.file.Write(line)
+		}
+		return
+	}
+
+	prefix := fmt.Sprintf("[%s] [%s] ", now.Format("2006-01-02 15:04:05.000"), levelNames[level])
+	suffix := fields.text()
+	// 使用颜色输出日志级别
+	fmt.Fprintf(output.stdout, "%s%s%s\n", prefix, levelColors[level](message), suffix)
+	if output.file != nil {
+		fmt.Fprintf(output.file, "%s%s%s\n", prefix, message, suffix)
+	}
+}
+
+func jsonLine(level int, now time.Time, message string, fields Fields) []byte {
+	record := make(map[string]interface{}, len(fields)+3)
+	for key, value := range fields {
+		if err, ok := value.(error); ok {
+			value = err.Error()
+		}
+		record[key] = value
+	}
+	record["time"] = now.Format(time.RFC3339Nano)
+	record["level"] = strings.ToLower(levelNames[level])
+	record["msg"] = message
+	line, err := json.Marshal(record)
+	if err != nil {
+		line, _ = json.Marshal(map[string]string{"time": now.Format(time.RFC3339Nano), "level": "error", "msg": message})
+	}
+	return append(line, '\n')
+}
+
+func (f Fields) text() string {
+	if len(f) == 0 {
+		return ""
+	}
+	keys := make([]string, 0, len(f))
+	for key := range f {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	var b strings.Builder
+	for _, key := range keys {
+		fmt.Fprintf(&b, " %s=%v", key, f[key])
+	}
+	return b.String()
+}
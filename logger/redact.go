@@ -0,0 +1,53 @@
+package logger
+
+import (
+	"regexp"
+	"strings"
+)
+
+// redactRules match secrets that must not reach log output. Each rule masks the last
+// submatch, keeping any leading context such as the header name.
+var redactRules = []*regexp.Regexp{
+	// Cookie and header style assignments: sessionKey=..., Authorization: Bearer ..., "api_key": "..."
+	regexp.MustCompile(`(?i)((?:sessionKey|session_key|cookie|cf_clearance|authorization|x-api-key|api[_-]?key|apikey|token)["']?\s*[:=]\s*["']?(?:bearer\s+)?)([^\s"';,&]{6,})`),
+	regexp.MustCompile(`(?i)(bearer\s+)([A-Za-z0-9._~+/=\-]{8,})`),
+	// Claude session keys and API keys anywhere in the text.
+	regexp.MustCompile(`()(sk-[A-Za-z0-9_\-]{16,})`),
+	// Organization IDs inside claude.ai URLs.
+	regexp.MustCompile(`(organizations/)([0-9a-fA-F-]{36})`),
+	// Credentials in proxy URLs.
+	regexp.MustCompile(`(://[^/\s:@]+:)([^/\s@]+)(?:@)`),
+}
+
+// Redact masks anything in text that looks like a session key, cookie, API key or org ID.
+func Redact(text string) string {
+	for _, rule := range redactRules {
+		text = rule.ReplaceAllStringFunc(text, func(match string) string {
+			parts := rule.FindStringSubmatchIndex(match)
+			if len(parts) < 6 || parts[4] < 0 {
+				return match
+			}
+			secret := match[parts[4]:parts[5]]
+			if strings.Contains(secret, "...") || secret == "****" {
+				return match
+			}
+			return match[:parts[4]] + MaskSecret(secret) + match[parts[5]:]
+		})
+	}
+	return text
+}
+
+// MaskSecret keeps only the ends of a secret so it can still be told apart in logs.
+func MaskSecret(value string) string {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return ""
+	}
+	if len(value) <= 8 {
+		return "****"
+	}
+	if len(value) <= 20 {
+		return value[:4] + "..." + value[len(value)-4:]
+	}
+	return value[:10] + "..." + value[len(value)-5:]
+}
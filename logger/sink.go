@@ -0,0 +1,343 @@
+package logger
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	activeLogFile     = "requests.jsonl"
+	rotatedLogPrefix  = "requests-"
+	rotatedLogSuffix  = ".jsonl"
+	rotatedTimeLayout = "20060102-150405.000"
+	maxActiveLogAge   = 24 * time.Hour
+)
+
+// LogSink durably stores request logs behind the in-memory ring.
+type LogSink interface {
+	Append(log RequestLog) error
+	// Scan calls fn for every stored log with start <= Timestamp < end, oldest first.
+	// Zero bounds are open; fn returns false to stop.
+	Scan(start, end time.Time, fn func(RequestLog) bool) error
+	Count() int
+	Clear() error
+	Close() error
+}
+
+// JSONLSink appends request logs to requests.jsonl in Dir. The active file is rotated
+// when it grows past MaxBytes or holds a day of logs; rotated files older than MaxAge
+// are deleted.
+type JSONLSink struct {
+	Dir      string
+	MaxBytes int64
+	MaxAge   time.Duration
+
+	mu           sync.Mutex
+	file         *os.File
+	size         int64
+	activeSince  time.Time
+	activeCount  int
+	rotated      map[string]int
+	lastPrunedAt time.Time
+	now          func() time.Time
+}
+
+// OpenJSONLSink opens (or creates) the log directory and counts the stored entries.
+func OpenJSONLSink(dir string, maxBytes int64, maxAge time.Duration) (*JSONLSink, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	sink := &JSONLSink{Dir: dir, MaxBytes: maxBytes, MaxAge: maxAge, rotated: make(map[string]int), now: time.Now}
+	for _, name := range sink.rotatedFiles() {
+		count, _, err := countLogFile(filepath.Join(dir, name))
+		if err != nil {
+			return nil, err
+		}
+		sink.rotated[name] = count
+	}
+	if err := sink.openActive(); err != nil {
+		return nil, err
+	}
+	sink.prune()
+	return sink, nil
+}
+
+func (s *JSONLSink) openActive() error {
+	path := filepath.Join(s.Dir, activeLogFile)
+	count, firstAt, err := countLogFile(path)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	s.file = file
+	s.size = info.Size()
+	s.activeCount = count
+	s.activeSince = firstAt
+	return nil
+}
+
+func (s *JSONLSink) Append(log RequestLog) error {
+	line, err := json.Marshal(log)
+	if err != nil {
+		return err
+	}
+	line = append(line, '\n')
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.file == nil {
+		return os.ErrClosed
+	}
+	now := s.now()
+	if s.activeCount > 0 && (s.MaxBytes > 0 && s.size+int64(len(line)) > s.MaxBytes || now.Sub(s.activeSince) >= maxActiveLogAge) {
+		if err := s.rotate(now); err != nil {
+			return err
+		}
+	}
+	if now.Sub(s.lastPrunedAt) >= time.Hour {
+		s.prune()
+	}
+	n, err := s.file.Write(line)
+	s.size += int64(n)
+	if err != nil {
+		return err
+	}
+	if s.activeCount == 0 {
+		s.activeSince = now
+	}
+	s.activeCount++
+	return nil
+}
+
+func (s *JSONLSink) rotate(now time.Time) error {
+	if err := s.file.Close(); err != nil {
+		return err
+	}
+	name := rotatedLogPrefix + now.UTC().Format(rotatedTimeLayout) + rotatedLogSuffix
+	if err := os.Rename(filepath.Join(s.Dir, activeLogFile), filepath.Join(s.Dir, name)); err != nil {
+		return err
+	}
+	s.rotated[name] = s.activeCount
+	return s.openActive()
+}
+
+// prune deletes rotated files whose newest entry is older than MaxAge.
+func (s *JSONLSink) prune() {
+	s.lastPrunedAt = s.now()
+	if s.MaxAge <= 0 {
+		return
+	}
+	cutoff := s.lastPrunedAt.Add(-s.MaxAge)
+	for name := range s.rotated {
+		rotatedAt, ok := rotatedFileTime(name)
+		if !ok || !rotatedAt.Before(cutoff) {
+			continue
+		}
+		if err := os.Remove(filepath.Join(s.Dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			Error(fmt.Sprintf("Failed to remove expired request log %s: %v", name, err))
+			continue
+		}
+		delete(s.rotated, name)
+	}
+}
+
+// Scan opens the files to read while holding the lock and reads them after releasing
+// it, so a long scan never blocks Append. Open files stay readable if they are rotated
+// or pruned meanwhile, and the active file is only read up to its size at the snapshot.
+func (s *JSONLSink) Scan(start, end time.Time, fn func(RequestLog) bool) error {
+	readers, closeAll, err := s.snapshot(start)
+	defer closeAll()
+	if err != nil {
+		return err
+	}
+
+	for _, reader := range readers {
+		keepGoing := true
+		err := readLogs(reader, func(log RequestLog) bool {
+			if !start.IsZero() && log.Timestamp.Before(start) {
+				return true
+			}
+			if !end.IsZero() && !log.Timestamp.Before(end) {
+				return true
+			}
+			keepGoing = fn(log)
+			return keepGoing
+		})
+		if err != nil {
+			return err
+		}
+		if !keepGoing {
+			return nil
+		}
+	}
+	return nil
+}
+
+// snapshot opens the files that may hold entries logged at or after start, oldest first.
+func (s *JSONLSink) snapshot(start time.Time) ([]io.Reader, func(), error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	names := make([]string, 0, len(s.rotated)+1)
+	for name := range s.rotated {
+		// A rotated file only holds entries logged before its rotation time.
+		if rotatedAt, ok := rotatedFileTime(name); ok && !start.IsZero() && rotatedAt.Before(start) {
+			continue
+		}
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	names = append(names, activeLogFile)
+
+	var files []*os.File
+	closeAll := func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}
+	readers := make([]io.Reader, 0, len(names))
+	for _, name := range names {
+		file, err := os.Open(filepath.Join(s.Dir, name))
+		if errors.Is(err, os.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, closeAll, err
+		}
+		files = append(files, file)
+		if name == activeLogFile {
+			readers = append(readers, io.LimitReader(file, s.size))
+		} else {
+			readers = append(readers, file)
+		}
+	}
+	return readers, closeAll, nil
+}
+
+func (s *JSONLSink) Count() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	total := s.activeCount
+	for _, count := range s.rotated {
+		total += count
+	}
+	return total
+}
+
+// Clear deletes every stored log.
+func (s *JSONLSink) Clear() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for name := range s.rotated {
+		if err := os.Remove(filepath.Join(s.Dir, name)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+		delete(s.rotated, name)
+	}
+	if s.file != nil {
+		if err := s.file.Truncate(0); err != nil {
+			return err
+		}
+	}
+	s.size = 0
+	s.activeCount = 0
+	s.activeSince = time.Time{}
+	return nil
+}
+
+func (s *JSONLSink) Close() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.file == nil {
+		return nil
+	}
+	err := s.file.Close()
+	s.file = nil
+	return err
+}
+
+func (s *JSONLSink) rotatedFiles() []string {
+	entries, err := os.ReadDir(s.Dir)
+	if err != nil {
+		return nil
+	}
+	names := make([]string, 0, len(entries))
+	for _, entry := range entries {
+		if _, ok := rotatedFileTime(entry.Name()); ok && !entry.IsDir() {
+			names = append(names, entry.Name())
+		}
+	}
+	return names
+}
+
+func rotatedFileTime(name string) (time.Time, bool) {
+	if !strings.HasPrefix(name, rotatedLogPrefix) || !strings.HasSuffix(name, rotatedLogSuffix) {
+		return time.Time{}, false
+	}
+	stamp := strings.TrimSuffix(strings.TrimPrefix(name, rotatedLogPrefix), rotatedLogSuffix)
+	rotatedAt, err := time.ParseInLocation(rotatedTimeLayout, stamp, time.UTC)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return rotatedAt, true
+}
+
+// countLogFile returns the number of entries in a JSONL file and the first entry's timestamp.
+func countLogFile(path string) (int, time.Time, error) {
+	count := 0
+	var firstAt time.Time
+	err := readLogFile(path, func(log RequestLog) bool {
+		if count == 0 {
+			firstAt = log.Timestamp
+		}
+		count++
+		return true
+	})
+	return count, firstAt, err
+}
+
+// readLogFile decodes a JSONL file line by line, skipping lines that fail to decode
+// (e.g. a partial last line after a crash).
+func readLogFile(path string, fn func(RequestLog) bool) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+	return readLogs(file, fn)
+}
+
+func readLogs(reader io.Reader, fn func(RequestLog) bool) error {
+	scanner := bufio.NewScanner(reader)
+	scanner.Buffer(make([]byte, 64*1024), 4*1024*1024)
+	for scanner.Scan() {
+		var log RequestLog
+		if err := json.Unmarshal(scanner.Bytes(), &log); err != nil {
+			continue
+		}
+		if !fn(log) {
+			return nil
+		}
+	}
+	return scanner.Err()
+}
@@ -0,0 +1,179 @@
+package logger
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestJSONLSinkRotatesBySizeAndKeepsHistory(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := OpenJSONLSink(dir, 400, 0)
+	if err != nil {
+		t.Fatalf("open sink: %v", err)
+	}
+	now := time.Date(2026, 7, 9, 8, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+
+	for i := 0; i < 6; i++ {
+		now = now.Add(time.Second)
+		if err := sink.Append(RequestLog{Timestamp: now, Model: "claude-sonnet-4-6", SessionIdx: i}); err != nil {
+			t.Fatalf("append: %v", err)
+		}
+	}
+	if len(sink.rotated) == 0 {
+		t.Fatal("expected the active file to rotate")
+	}
+	if err := sink.Close(); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	reopened, err := OpenJSONLSink(dir, 400, 0)
+	if err != nil {
+		t.Fatalf("reopen sink: %v", err)
+	}
+	defer reopened.Close()
+	if got := reopened.Count(); got != 6 {
+		t.Fatalf("expected 6 stored logs after reopen, got %d", got)
+	}
+	var indices []int
+	reopened.Scan(time.Time{}, time.Time{}, func(log RequestLog) bool {
+		indices = append(indices, log.SessionIdx)
+		return true
+	})
+	for i, idx := range indices {
+		if idx != i {
+			t.Fatalf("expected logs oldest first, got %v", indices)
+		}
+	}
+}
+
+func TestJSONLSinkPrunesExpiredFiles(t *testing.T) {
+	dir := t.TempDir()
+	sink, err := OpenJSONLSink(dir, 0, 48*time.Hour)
+	if err != nil {
+		t.Fatalf("open sink: %v", err)
+	}
+	defer sink.Close()
+	now := time.Date(2026, 7, 9, 8, 0, 0, 0, time.UTC)
+	sink.now = func() time.Time { return now }
+	sink.lastPrunedAt = time.Time{}
+
+	sink.Append(RequestLog{Timestamp: now})
+	now = now.Add(25 * time.Hour)
+	sink.Append(RequestLog{Timestamp: now})
+	if len(sink.rotated) != 1 || sink.Count() != 2 {
+		t.Fatalf("expected a daily rotation, got %d rotated files and %d logs", len(sink.rotated), sink.Count())
+	}
+
+	now = now.Add(72 * time.Hour)
+	sink.Append(RequestLog{Timestamp: now})
+	if _, err := os.Stat(filepath.Join(dir, activeLogFile)); err != nil {
+		t.Fatalf("expected active file to exist: %v", err)
+	}
+	if got := sink.Count(); got != 2 {
+		t.Fatalf("expected the expired file to be pruned, got %d logs", got)
+	}
+}
+
+func TestRequestLoggerPaginatesIntoSinkHistory(t *testing.T) {
+	sink, err := OpenJSONLSink(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("open sink: %v", err)
+	}
+	defer sink.Close()
+
+	requestLogger := NewRequestLogger(3)
+	requestLogger.SetSink(sink)
+	start := time.Date(2026, 7, 9, 8, 0, 0, 0, time.Local)
+	for i := 0; i < 8; i++ {
+		requestLogger.LogRequest(RequestLog{Timestamp: start.Add(time.Duration(i) * time.Minute), SessionIdx: i})
+	}
+
+	logs, total, hasMore := requestLogger.GetLogsWithPagination(1, 3)
+	if total != 8 || !hasMore || logs[0].SessionIdx != 7 {
+		t.Fatalf("unexpected first page: total=%d hasMore=%t logs=%+v", total, hasMore, logs)
+	}
+	logs, _, hasMore = requestLogger.GetLogsWithPagination(3, 3)
+	if hasMore || len(logs) != 2 || logs[0].SessionIdx != 1 || logs[1].SessionIdx != 0 {
+		t.Fatalf("unexpected history page: hasMore=%t logs=%+v", hasMore, logs)
+	}
+
+	ranged := requestLogger.GetLogsByTimeRange(start, start.Add(4*time.Minute))
+	if len(ranged) != 3 || ranged[0].SessionIdx != 1 {
+		t.Fatalf("expected logs strictly inside the range from history, got %+v", ranged)
+	}
+}
+
+func TestScansDoNotHoldLocksWhileReading(t *testing.T) {
+	sink, err := OpenJSONLSink(t.TempDir(), 0, 0)
+	if err != nil {
+		t.Fatalf("open sink: %v", err)
+	}
+	defer sink.Close()
+
+	requestLogger := NewRequestLogger(10)
+	requestLogger.SetSink(sink)
+	start := time.Date(2026, 7, 9, 8, 0, 0, 0, time.Local)
+	for i := 0; i < 3; i++ {
+		requestLogger.LogRequest(RequestLog{Timestamp: start.Add(time.Duration(i) * time.Minute), SessionIdx: i})
+	}
+
+	// Logging from inside the callback deadlocks if either lock is held during the scan.
+	seen := 0
+	requestLogger.EachLog(LogFilter{}, func(log RequestLog) bool {
+		seen++
+		requestLogger.LogRequest(RequestLog{Timestamp: start.Add(time.Hour), SessionIdx: 9})
+		return true
+	})
+	if seen != 3 {
+		t.Fatalf("expected the scan to stop at the snapshot, saw %d logs", seen)
+	}
+	if got := sink.Count(); got != 6 {
+		t.Fatalf("expected the logs written during the scan to be stored, got %d", got)
+	}
+
+	logs, total, hasMore := requestLogger.QueryLogs(LogFilter{}, 2, 4)
+	if total != 6 || hasMore || len(logs) != 2 || logs[0].SessionIdx != 1 || logs[1].SessionIdx != 0 {
+		t.Fatalf("unexpected second page: total=%d hasMore=%t logs=%+v", total, hasMore, logs)
+	}
+}
+
+// blockingSink holds every Append until release is closed.
+type blockingSink struct {
+	appending chan struct{}
+	release   chan struct{}
+}
+
+func (s *blockingSink) Append(log RequestLog) error {
+	s.appending <- struct{}{}
+	<-s.release
+	return nil
+}
+
+func (s *blockingSink) Scan(start, end time.Time, fn func(RequestLog) bool) error { return nil }
+func (s *blockingSink) Count() int                                                { return 0 }
+func (s *blockingSink) Clear() error                                              { return nil }
+func (s *blockingSink) Close() error                                              { return nil }
+
+func TestLogRequestDoesNotHoldTheLockWhileAppending(t *testing.T) {
+	sink := &blockingSink{appending: make(chan struct{}, 1), release: make(chan struct{})}
+	requestLogger := NewRequestLogger(10)
+	requestLogger.SetSink(sink)
+
+	go requestLogger.LogRequest(RequestLog{Timestamp: time.Now(), SessionIdx: 0, Success: true})
+	<-sink.appending
+	defer close(sink.release)
+
+	done := make(chan map[int]SessionStats)
+	go func() { done <- requestLogger.GetStatsBySession() }()
+	select {
+	case stats := <-done:
+		if stats[0].SuccessRequests != 1 {
+			t.Fatalf("expected the entry to be counted before it is persisted, got %+v", stats)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected stats to be readable while the sink is appending")
+	}
+}
@@ -1,6 +1,7 @@
 package logger
 
 import (
+	"fmt"
 	"strings"
 	"sync"
 	"time"
@@ -9,20 +10,25 @@ import (
 // RequestLog represents a single API request log entry
 type RequestLog struct {
 	Timestamp    time.Time `json:"timestamp"`
+	RequestID    string    `json:"request_id,omitempty"`
 	Method       string    `json:"method"`
 	Path         string    `json:"path"`
 	Model        string    `json:"model"`
 	StatusCode   int       `json:"status_code"`
-	Duration     int64     `json:"duration_ms"` // milliseconds
+	Duration     int64     `json:"duration_ms"`       // milliseconds
+	TTFTMs       int64     `json:"ttft_ms,omitempty"` // time to first token, milliseconds
 	Success      bool      `json:"success"`
 	Error        string    `json:"error,omitempty"`
 	ErrorType    string    `json:"error_type,omitempty"`
 	SessionIdx   int       `json:"session_idx"`
 	SessionLabel string    `json:"session_label,omitempty"`
+	ClientKey    string    `json:"client_key,omitempty"` // masked API key of the caller
 	IsStreaming  bool      `json:"is_streaming"`
 	ContextCount int       `json:"context_count"`
 	InputTokens  int       `json:"input_tokens"`
 	OutputTokens int       `json:"output_tokens"`
+	// Stages breaks Duration down for the final session attempt.
+	Stages *StageTimings `json:"stages,omitempty"`
 }
 
 // Stats represents aggregated statistics
@@ -31,8 +37,23 @@ type Stats struct {
 	SuccessRequests int64   `json:"success_requests"`
 	FailedRequests  int64   `json:"failed_requests"`
 	SuccessRate     float64 `json:"success_rate"`
-	RPM             float64 `json:"rpm"` // requests per minute
+	RPM             float64 `json:"rpm"` // requests per minute over the last WindowMinutes
+	TPM             float64 `json:"tpm"` // tokens per minute over the last WindowMinutes
+	WindowMinutes   int     `json:"window_minutes"`
 	AvgDuration     float64 `json:"avg_duration_ms"`
+	// Latency holds p50/p95 of the total duration and of each stage.
+	Latency map[string]LatencySummary `json:"latency"`
+	Models  map[string]ModelStats     `json:"models"`
+}
+
+// ModelStats aggregates the logs of one model.
+type ModelStats struct {
+	TotalRequests   int64                     `json:"total_requests"`
+	SuccessRequests int64                     `json:"success_requests"`
+	FailedRequests  int64                     `json:"failed_requests"`
+	SuccessRate     float64                   `json:"success_rate"`
+	AvgDuration     float64                   `json:"avg_duration_ms"`
+	Latency         map[string]LatencySummary `json:"latency"`
 }
 
 // SessionStats represents aggregated statistics for a single session.
@@ -58,6 +79,10 @@ type RequestLogger struct {
 	sessionStats                  map[int]SessionStats
 	successesSinceRateLimit       map[int]int64
 	successesBeforeRateLimitTotal map[int]int64
+	// sink optionally persists every log; the logs slice stays as a hot cache.
+	sink LogSink
+	// series keeps per-minute counters for sliding-window stats, independent of maxLogs.
+	series *TimeSeries
 }
 
 var GlobalRequestLogger *RequestLogger
@@ -75,22 +100,54 @@ func NewRequestLogger(maxLogs int) *RequestLogger {
 		sessionStats:                  make(map[int]SessionStats),
 		successesSinceRateLimit:       make(map[int]int64),
 		successesBeforeRateLimitTotal: make(map[int]int64),
+		series:                        NewTimeSeries(),
 	}
 }
 
-// LogRequest adds a new request log entry
-func (rl *RequestLogger) LogRequest(log RequestLog) {
+// SetSink attaches a durable store for request logs and returns the previous one,
+// which the caller should close. A nil sink keeps logs in memory only. The time series
+// is rebuilt from the last 24 hours in the store, so charts survive restarts.
+func (rl *RequestLogger) SetSink(sink LogSink) LogSink {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
+	previous := rl.sink
+	rl.sink = sink
+	if sink != nil {
+		rl.series.Reset()
+		err := sink.Scan(time.Now().Add(-seriesRetention*time.Minute), time.Time{}, func(log RequestLog) bool {
+			rl.series.Record(log)
+			return true
+		})
+		if err != nil {
+			Error(fmt.Sprintf("Failed to load request log history for stats: %v", err))
+		}
+	}
+	return previous
+}
+
+// LogRequest adds a new request log entry. The entry is written to the sink after the
+// lock is released, so slow disk I/O does not hold up other requests.
+func (rl *RequestLogger) LogRequest(log RequestLog) {
+	rl.mu.Lock()
+	sink := rl.sink
+
 	// Add log
 	rl.logs = append(rl.logs, log)
 	rl.updateSessionStats(log)
+	rl.series.Record(log)
 
 	// Trim if exceeds max
 	if len(rl.logs) > rl.maxLogs {
 		rl.logs = rl.logs[len(rl.logs)-rl.maxLogs:]
 	}
+	rl.mu.Unlock()
+
+	if sink != nil {
+		if err := sink.Append(log); err != nil {
+			Error(fmt.Sprintf("Failed to persist request log: %v", err))
+		}
+	}
 }
 
 func (rl *RequestLogger) updateSessionStats(log RequestLog) {
@@ -141,6 +198,9 @@ func (rl *RequestLogger) GetStats() Stats {
 
 	var successCount, failedCount int64
 	var totalDuration int64
+	samples := latencySamples{}
+	models := make(map[string]*ModelStats)
+	modelSamples := make(map[string]latencySamples)
 
 	for _, log := range rl.logs {
 		if log.Success {
@@ -149,29 +209,54 @@ func (rl *RequestLogger) GetStats() Stats {
 			failedCount++
 		}
 		totalDuration += log.Duration
+		samples.add(log)
+
+		modelStats := models[log.Model]
+		if modelStats == nil {
+			modelStats = &ModelStats{}
+			models[log.Model] = modelStats
+			modelSamples[log.Model] = latencySamples{}
+		}
+		modelStats.TotalRequests++
+		if log.Success {
+			modelStats.SuccessRequests++
+		} else {
+			modelStats.FailedRequests++
+		}
+		modelStats.AvgDuration += float64(log.Duration)
+		modelSamples[log.Model].add(log)
+	}
+
+	modelResult := make(map[string]ModelStats, len(models))
+	for name, modelStats := range models {
+		modelStats.SuccessRate = float64(modelStats.SuccessRequests) / float64(modelStats.TotalRequests) * 100
+		modelStats.AvgDuration /= float64(modelStats.TotalRequests)
+		modelStats.Latency = modelSamples[name].summarize()
+		modelResult[name] = *modelStats
 	}
 
 	total := successCount + failedCount
-	var successRate, rpm, avgDuration float64
+	var successRate, avgDuration float64
 
 	if total > 0 {
 		successRate = float64(successCount) / float64(total) * 100
 		avgDuration = float64(totalDuration) / float64(total)
 	}
 
-	// Calculate RPM (requests per minute)
-	elapsed := time.Since(rl.startTime).Minutes()
-	if elapsed > 0 {
-		rpm = float64(total) / elapsed
-	}
+	// RPM and TPM come from the sliding window rather than the whole uptime
+	window := rl.series.Window(time.Now(), DefaultStatsWindow)
 
 	return Stats{
 		TotalRequests:   total,
 		SuccessRequests: successCount,
 		FailedRequests:  failedCount,
 		SuccessRate:     successRate,
-		RPM:             rpm,
+		RPM:             window.Total.RPM,
+		TPM:             window.Total.TPM,
+		WindowMinutes:   window.WindowMinutes,
 		AvgDuration:     avgDuration,
+		Latency:         samples.summarize(),
+		Models:          modelResult,
 	}
 }
 
@@ -196,10 +281,14 @@ func (rl *RequestLogger) GetRecentLogs(limit int) []RequestLog {
 // page is 1-indexed, pageSize is the number of items per page
 func (rl *RequestLogger) GetLogsWithPagination(page, pageSize int) ([]RequestLog, int, bool) {
 	rl.mu.RLock()
-	defer rl.mu.RUnlock()
-
-	total := len(rl.logs)
+	sink := rl.sink
+	cached := len(rl.logs)
+	total := cached
+	if sink != nil && sink.Count() > total {
+		total = sink.Count()
+	}
 	if total == 0 {
+		rl.mu.RUnlock()
 		return []RequestLog{}, 0, false
 	}
 
@@ -231,13 +320,23 @@ func (rl *RequestLogger) GetLogsWithPagination(page, pageSize int) ([]RequestLog
 		endIdx = total
 	}
 
+	hasMore := page < totalPages
+
+	// Pages older than the in-memory cache are read from the sink after unlocking
+	if total-startIdx > cached {
+		rl.mu.RUnlock()
+		return readSinkRange(sink, startIdx, endIdx), total, hasMore
+	}
+	offset := total - cached
+	startIdx -= offset
+	endIdx -= offset
+
 	// Extract logs in reverse order (newest first)
 	result := make([]RequestLog, 0, endIdx-startIdx)
 	for i := endIdx - 1; i >= startIdx; i-- {
 		result = append(result, rl.logs[i])
 	}
-
-	hasMore := page < totalPages
+	rl.mu.RUnlock()
 
 	return result, total, hasMore
 }
@@ -246,6 +345,9 @@ func (rl *RequestLogger) GetLogsWithPagination(page, pageSize int) ([]RequestLog
 func (rl *RequestLogger) GetTotalCount() int {
 	rl.mu.RLock()
 	defer rl.mu.RUnlock()
+	if rl.sink != nil && rl.sink.Count() > len(rl.logs) {
+		return rl.sink.Count()
+	}
 	return len(rl.logs)
 }
 
@@ -296,6 +398,68 @@ func (rl *RequestLogger) GetStatsBySession() map[int]SessionStats {
 	return result
 }
 
+// SessionStatsSnapshot is the persisted form of one session's aggregated statistics.
+type SessionStatsSnapshot struct {
+	Stats                         SessionStats `json:"stats"`
+	SuccessesSinceRateLimit       int64        `json:"successes_since_rate_limit"`
+	SuccessesBeforeRateLimitTotal int64        `json:"successes_before_rate_limit_total"`
+}
+
+// ExportSessionStats returns the per-session aggregates, including the counters behind
+// AvgSuccessesBeforeRateLimit, so they can be saved and restored across restarts.
+func (rl *RequestLogger) ExportSessionStats() map[int]SessionStatsSnapshot {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+
+	result := make(map[int]SessionStatsSnapshot, len(rl.sessionStats))
+	for sessionIdx, stats := range rl.sessionStats {
+		result[sessionIdx] = SessionStatsSnapshot{
+			Stats:                         stats,
+			SuccessesSinceRateLimit:       rl.successesSinceRateLimit[sessionIdx],
+			SuccessesBeforeRateLimitTotal: rl.successesBeforeRateLimitTotal[sessionIdx],
+		}
+	}
+	return result
+}
+
+// RestoreSessionStats replaces the aggregates of the given sessions with saved snapshots.
+func (rl *RequestLogger) RestoreSessionStats(snapshots map[int]SessionStatsSnapshot) {
+	rl.mu.Lock()
+	defer rl.mu.Unlock()
+
+	for sessionIdx, snapshot := range snapshots {
+		if sessionIdx < 0 {
+			continue
+		}
+		stats := snapshot.Stats
+		finalizeSessionStats(&stats, snapshot.SuccessesBeforeRateLimitTotal)
+		rl.sessionStats[sessionIdx] = stats
+		rl.successesSinceRateLimit[sessionIdx] = snapshot.SuccessesSinceRateLimit
+		rl.successesBeforeRateLimitTotal[sessionIdx] = snapshot.SuccessesBeforeRateLimitTotal
+	}
+}
+
+// readSinkRange returns the stored logs with chronological positions in [startIdx, endIdx),
+// newest first.
+func readSinkRange(sink LogSink, startIdx, endIdx int) []RequestLog {
+	result := make([]RequestLog, 0, endIdx-startIdx)
+	position := 0
+	err := sink.Scan(time.Time{}, time.Time{}, func(log RequestLog) bool {
+		if position >= startIdx && position < endIdx {
+			result = append(result, log)
+		}
+		position++
+		return position < endIdx
+	})
+	if err != nil {
+		Error(fmt.Sprintf("Failed to read request log history: %v", err))
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
 func finalizeSessionStats(stats *SessionStats, successesBeforeRateLimitTotal int64) {
 	if stats.TotalRequests > 0 {
 		stats.SuccessRate = float64(stats.SuccessRequests) / float64(stats.TotalRequests) * 100
@@ -322,10 +486,24 @@ func isRateLimitLog(log RequestLog) bool {
 // GetLogsByTimeRange returns logs within a time range
 func (rl *RequestLogger) GetLogsByTimeRange(start, end time.Time) []RequestLog {
 	rl.mu.RLock()
-	defer rl.mu.RUnlock()
+	sink := rl.sink
+	rl.mu.RUnlock()
 
 	var result []RequestLog
-	for _, log := range rl.logs {
+	if sink != nil {
+		err := sink.Scan(start, end, func(log RequestLog) bool {
+			if log.Timestamp.After(start) {
+				result = append(result, log)
+			}
+			return true
+		})
+		if err == nil {
+			return result
+		}
+		Error(fmt.Sprintf("Failed to read request log history: %v", err))
+		result = nil
+	}
+	for _, log := range rl.cachedLogs() {
 		if log.Timestamp.After(start) && log.Timestamp.Before(end) {
 			result = append(result, log)
 		}
@@ -333,14 +511,37 @@ func (rl *RequestLogger) GetLogsByTimeRange(start, end time.Time) []RequestLog {
 	return result
 }
 
+// cachedLogs returns a copy of the in-memory logs, so callers can filter them unlocked.
+func (rl *RequestLogger) cachedLogs() []RequestLog {
+	rl.mu.RLock()
+	defer rl.mu.RUnlock()
+	return append([]RequestLog(nil), rl.logs...)
+}
+
 // Clear clears all logs
 func (rl *RequestLogger) Clear() {
 	rl.mu.Lock()
 	defer rl.mu.Unlock()
 
 	rl.logs = make([]RequestLog, 0)
+	if rl.sink != nil {
+		if err := rl.sink.Clear(); err != nil {
+			Error(fmt.Sprintf("Failed to clear request log history: %v", err))
+		}
+	}
 	rl.startTime = time.Now()
+	rl.series.Reset()
 	rl.sessionStats = make(map[int]SessionStats)
 	rl.successesSinceRateLimit = make(map[int]int64)
 	rl.successesBeforeRateLimitTotal = make(map[int]int64)
 }
+
+// StatsWindow summarizes the last window of requests by model, session and client key.
+func (rl *RequestLogger) StatsWindow(now time.Time, window time.Duration) WindowBreakdown {
+	return rl.series.Window(now, window)
+}
+
+// StatsSeries returns per-step points over the last window for charts.
+func (rl *RequestLogger) StatsSeries(now time.Time, window, step time.Duration, filter SeriesFilter) []SeriesPoint {
+	return rl.series.Series(now, window, step, filter)
+}
@@ -75,3 +75,23 @@ func TestGetStatsBySessionKeepsCumulativeStatsAfterLogTrim(t *testing.T) {
 		t.Fatalf("expected cumulative total tokens 45, got %d", stats.TotalTokens)
 	}
 }
+
+func TestExportAndRestoreSessionStats(t *testing.T) {
+	requestLogger := NewRequestLogger(20)
+	now := time.Date(2026, 7, 8, 8, 0, 0, 0, time.Local)
+	requestLogger.LogRequest(RequestLog{Timestamp: now, Success: true, SessionIdx: 0, InputTokens: 10})
+	requestLogger.LogRequest(RequestLog{Timestamp: now, Success: false, ErrorType: "限流", SessionIdx: 0})
+	requestLogger.LogRequest(RequestLog{Timestamp: now, Success: true, SessionIdx: 0})
+
+	restoredLogger := NewRequestLogger(20)
+	restoredLogger.RestoreSessionStats(requestLogger.ExportSessionStats())
+	restoredLogger.LogRequest(RequestLog{Timestamp: now, Success: false, ErrorType: "限流", SessionIdx: 0})
+
+	stats := restoredLogger.GetStatsBySession()[0]
+	if stats.TotalRequests != 4 || stats.RateLimitRequests != 2 {
+		t.Fatalf("unexpected restored stats: %+v", stats)
+	}
+	if stats.AvgSuccessesBeforeRateLimit != 1 {
+		t.Fatalf("expected restored rate-limit profile, got %f", stats.AvgSuccessesBeforeRateLimit)
+	}
+}
@@ -0,0 +1,343 @@
+package logger
+
+import (
+	"math"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	// seriesRetention is how many one-minute buckets are kept.
+	seriesRetention = 24 * 60
+	// DefaultStatsWindow is the sliding window behind RPM, TPM and success rate in GetStats.
+	DefaultStatsWindow = 5 * time.Minute
+)
+
+// seriesLatencyBounds are histogram upper bounds in milliseconds used to estimate
+// percentiles without keeping every duration for 24 hours.
+var seriesLatencyBounds = [...]int64{
+	100, 250, 500, 1000, 2000, 3000, 5000, 7500, 10000, 15000, 20000, 30000, 45000, 60000, 90000, 120000, 180000, 300000,
+}
+
+// seriesCounter aggregates the requests of one dimension value within a time range.
+type seriesCounter struct {
+	requests     int64
+	success      int64
+	inputTokens  int64
+	outputTokens int64
+	durationSum  int64
+	maxDuration  int64
+	// latency counts durations per seriesLatencyBounds, plus an overflow slot.
+	latency [len(seriesLatencyBounds) + 1]int64
+}
+
+func (s *seriesCounter) add(log RequestLog) {
+	s.requests++
+	if log.Success {
+		s.success++
+	}
+	s.inputTokens += int64(log.InputTokens)
+	s.outputTokens += int64(log.OutputTokens)
+	s.durationSum += log.Duration
+	if log.Duration > s.maxDuration {
+		s.maxDuration = log.Duration
+	}
+	slot := sort.Search(len(seriesLatencyBounds), func(i int) bool { return log.Duration <= seriesLatencyBounds[i] })
+	s.latency[slot]++
+}
+
+func (s *seriesCounter) merge(other *seriesCounter) {
+	s.requests += other.requests
+	s.success += other.success
+	s.inputTokens += other.inputTokens
+	s.outputTokens += other.outputTokens
+	s.durationSum += other.durationSum
+	if other.maxDuration > s.maxDuration {
+		s.maxDuration = other.maxDuration
+	}
+	for i := range s.latency {
+		s.latency[i] += other.latency[i]
+	}
+}
+
+// percentile returns the upper bound of the histogram slot holding the p-th percentile,
+// capped at the slowest request seen.
+func (s *seriesCounter) percentile(p float64) float64 {
+	if s.requests == 0 {
+		return 0
+	}
+	rank := int64(math.Ceil(p / 100 * float64(s.requests)))
+	if rank < 1 {
+		rank = 1
+	}
+	var seen int64
+	for i, count := range s.latency {
+		seen += count
+		if seen >= rank {
+			if i < len(seriesLatencyBounds) && seriesLatencyBounds[i] < s.maxDuration {
+				return float64(seriesLatencyBounds[i])
+			}
+			return float64(s.maxDuration)
+		}
+	}
+	return float64(s.maxDuration)
+}
+
+type seriesBucket struct {
+	minute    int64
+	total     seriesCounter
+	byModel   map[string]*seriesCounter
+	bySession map[int]*seriesCounter
+	byClient  map[string]*seriesCounter
+}
+
+// SeriesFilter limits a time series to one model, session or client key. Buckets keep
+// each dimension separately, so at most one field should be set; empty fields match
+// everything.
+type SeriesFilter struct {
+	Model      string
+	SessionIdx *int
+	ClientKey  string
+}
+
+// WindowStats summarizes the requests in a sliding window.
+type WindowStats struct {
+	Requests     int64   `json:"requests"`
+	Success      int64   `json:"success"`
+	Failed       int64   `json:"failed"`
+	SuccessRate  float64 `json:"success_rate"`
+	RPM          float64 `json:"rpm"`
+	TPM          float64 `json:"tpm"`
+	InputTokens  int64   `json:"input_tokens"`
+	OutputTokens int64   `json:"output_tokens"`
+	AvgDuration  float64 `json:"avg_duration_ms"`
+	P50          float64 `json:"p50_ms"`
+	P95          float64 `json:"p95_ms"`
+	P99          float64 `json:"p99_ms"`
+}
+
+// WindowBreakdown is a window summary with the same numbers per model, session and client key.
+type WindowBreakdown struct {
+	WindowMinutes int                    `json:"window_minutes"`
+	Total         WindowStats            `json:"total"`
+	Models        map[string]WindowStats `json:"models"`
+	Sessions      map[string]WindowStats `json:"sessions"`
+	ClientKeys    map[string]WindowStats `json:"client_keys"`
+}
+
+// SeriesPoint is one step of a time series.
+type SeriesPoint struct {
+	Time time.Time `json:"time"`
+	WindowStats
+}
+
+// TimeSeries keeps per-minute request counters for the last 24 hours.
+type TimeSeries struct {
+	mu            sync.Mutex
+	buckets       [seriesRetention]seriesBucket
+	sessionLabels map[int]string
+}
+
+func NewTimeSeries() *TimeSeries {
+	return &TimeSeries{sessionLabels: make(map[int]string)}
+}
+
+// Record counts a finished request in the minute it completed.
+func (ts *TimeSeries) Record(log RequestLog) {
+	finishedAt := log.Timestamp.Add(time.Duration(log.Duration) * time.Millisecond)
+	minute := finishedAt.Unix() / 60
+
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+
+	bucket := &ts.buckets[minute%seriesRetention]
+	if bucket.minute != minute {
+		*bucket = seriesBucket{
+			minute:    minute,
+			byModel:   make(map[string]*seriesCounter),
+			bySession: make(map[int]*seriesCounter),
+			byClient:  make(map[string]*seriesCounter),
+		}
+	}
+	bucket.total.add(log)
+	counterFor(bucket.byModel, log.Model).add(log)
+	if log.SessionIdx >= 0 {
+		counter := bucket.bySession[log.SessionIdx]
+		if counter == nil {
+			counter = &seriesCounter{}
+			bucket.bySession[log.SessionIdx] = counter
+		}
+		counter.add(log)
+		if log.SessionLabel != "" {
+			ts.sessionLabels[log.SessionIdx] = log.SessionLabel
+		}
+	}
+	if log.ClientKey != "" {
+		counterFor(bucket.byClient, log.ClientKey).add(log)
+	}
+}
+
+func counterFor(counters map[string]*seriesCounter, key string) *seriesCounter {
+	counter := counters[key]
+	if counter == nil {
+		counter = &seriesCounter{}
+		counters[key] = counter
+	}
+	return counter
+}
+
+// Reset drops every bucket.
+func (ts *TimeSeries) Reset() {
+	ts.mu.Lock()
+	defer ts.mu.Unlock()
+	ts.buckets = [seriesRetention]seriesBucket{}
+	ts.sessionLabels = make(map[int]string)
+}
+
+// Window summarizes the window ending at now, broken down by model, session and client key.
+func (ts *TimeSeries) Window(now time.Time, window time.Duration) WindowBreakdown {
+	minutes := windowMinutes(window)
+	total := &seriesCounter{}
+	models := make(map[string]*seriesCounter)
+	sessions := make(map[int]*seriesCounter)
+	clients := make(map[string]*seriesCounter)
+
+	ts.mu.Lock()
+	ts.eachBucket(now, minutes, func(bucket *seriesBucket) {
+		total.merge(&bucket.total)
+		for key, counter := range bucket.byModel {
+			counterFor(models, key).merge(counter)
+		}
+		for idx, counter := range bucket.bySession {
+			if sessions[idx] == nil {
+				sessions[idx] = &seriesCounter{}
+			}
+			sessions[idx].merge(counter)
+		}
+		for key, counter := range bucket.byClient {
+			counterFor(clients, key).merge(counter)
+		}
+	})
+	labels := make(map[int]string, len(sessions))
+	for idx := range sessions {
+		labels[idx] = ts.sessionLabels[idx]
+	}
+	ts.mu.Unlock()
+
+	result := WindowBreakdown{
+		WindowMinutes: minutes,
+		Total:         total.summary(minutes),
+		Models:        make(map[string]WindowStats, len(models)),
+		Sessions:      make(map[string]WindowStats, len(sessions)),
+		ClientKeys:    make(map[string]WindowStats, len(clients)),
+	}
+	for key, counter := range models {
+		result.Models[key] = counter.summary(minutes)
+	}
+	for idx, counter := range sessions {
+		label := labels[idx]
+		if label == "" {
+			label = "S" + strconv.Itoa(idx+1)
+		}
+		result.Sessions[label] = counter.summary(minutes)
+	}
+	for key, counter := range clients {
+		result.ClientKeys[key] = counter.summary(minutes)
+	}
+	return result
+}
+
+// Series returns one point per step over the window ending at now, oldest first.
+func (ts *TimeSeries) Series(now time.Time, window, step time.Duration, filter SeriesFilter) []SeriesPoint {
+	minutes := windowMinutes(window)
+	stepMinutes := int(step / time.Minute)
+	if stepMinutes < 1 {
+		stepMinutes = 1
+	}
+	if stepMinutes > minutes {
+		stepMinutes = minutes
+	}
+	points := (minutes + stepMinutes - 1) / stepMinutes
+	counters := make([]seriesCounter, points)
+	current := now.Unix() / 60
+	first := current - int64(points*stepMinutes) + 1
+
+	ts.mu.Lock()
+	ts.eachBucket(now, points*stepMinutes, func(bucket *seriesBucket) {
+		if counter := filter.counter(bucket); counter != nil {
+			counters[int(bucket.minute-first)/stepMinutes].merge(counter)
+		}
+	})
+	ts.mu.Unlock()
+
+	result := make([]SeriesPoint, points)
+	for i := range counters {
+		result[i] = SeriesPoint{
+			Time:        time.Unix((first+int64(i*stepMinutes))*60, 0),
+			WindowStats: counters[i].summary(stepMinutes),
+		}
+	}
+	return result
+}
+
+func (f SeriesFilter) counter(bucket *seriesBucket) *seriesCounter {
+	switch {
+	case f.Model != "":
+		return bucket.byModel[f.Model]
+	case f.SessionIdx != nil:
+		return bucket.bySession[*f.SessionIdx]
+	case f.ClientKey != "":
+		return bucket.byClient[f.ClientKey]
+	default:
+		return &bucket.total
+	}
+}
+
+// eachBucket calls fn for the buckets of the last minutes minutes; ts.mu must be held.
+func (ts *TimeSeries) eachBucket(now time.Time, minutes int, fn func(*seriesBucket)) {
+	current := now.Unix() / 60
+	for minute := current - int64(minutes) + 1; minute <= current; minute++ {
+		if minute < 0 {
+			continue
+		}
+		bucket := &ts.buckets[minute%seriesRetention]
+		if bucket.minute == minute && bucket.total.requests > 0 {
+			fn(bucket)
+		}
+	}
+}
+
+func (s *seriesCounter) summary(minutes int) WindowStats {
+	stats := WindowStats{
+		Requests:     s.requests,
+		Success:      s.success,
+		Failed:       s.requests - s.success,
+		InputTokens:  s.inputTokens,
+		OutputTokens: s.outputTokens,
+	}
+	if minutes > 0 {
+		stats.RPM = float64(s.requests) / float64(minutes)
+		stats.TPM = float64(s.inputTokens+s.outputTokens) / float64(minutes)
+	}
+	if s.requests > 0 {
+		stats.SuccessRate = float64(s.success) / float64(s.requests) * 100
+		stats.AvgDuration = float64(s.durationSum) / float64(s.requests)
+		stats.P50 = s.percentile(50)
+		stats.P95 = s.percentile(95)
+		stats.P99 = s.percentile(99)
+	}
+	return stats
+}
+
+func windowMinutes(window time.Duration) int {
+	minutes := int(window / time.Minute)
+	if minutes < 1 {
+		minutes = 1
+	}
+	if minutes > seriesRetention {
+		minutes = seriesRetention
+	}
+	return minutes
+}
@@ -0,0 +1,79 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTimeSeriesWindowBreaksDownByDimension(t *testing.T) {
+	series := NewTimeSeries()
+	now := time.Date(2026, 6, 19, 20, 30, 30, 0, time.Local)
+
+	for i := 0; i < 8; i++ {
+		series.Record(RequestLog{
+			Timestamp:    now.Add(-time.Duration(i) * time.Minute / 2),
+			Model:        "claude-sonnet-4-6",
+			Success:      i != 0,
+			Duration:     int64(400 + i*100),
+			SessionIdx:   i % 2,
+			SessionLabel: []string{"S1 / sk-a...1111", "S2 / sk-b...2222"}[i%2],
+			ClientKey:    "sk-c...1234",
+			InputTokens:  100,
+			OutputTokens: 50,
+		})
+	}
+	// Outside the five minute window.
+	series.Record(RequestLog{Timestamp: now.Add(-10 * time.Minute), Model: "claude-opus-4-6", Success: true, SessionIdx: -1})
+
+	window := series.Window(now, 5*time.Minute)
+	if window.Total.Requests != 8 || window.Total.Failed != 1 {
+		t.Fatalf("unexpected window totals: %+v", window.Total)
+	}
+	if window.Total.RPM != 1.6 || window.Total.TPM != 240 {
+		t.Fatalf("unexpected rpm/tpm: %f / %f", window.Total.RPM, window.Total.TPM)
+	}
+	if window.Total.SuccessRate != 87.5 {
+		t.Fatalf("unexpected success rate: %f", window.Total.SuccessRate)
+	}
+	if window.Total.P50 != 1000 || window.Total.P95 != 1100 {
+		t.Fatalf("unexpected percentiles: p50=%f p95=%f", window.Total.P50, window.Total.P95)
+	}
+	if _, ok := window.Models["claude-opus-4-6"]; ok {
+		t.Fatal("expected requests outside the window to be excluded")
+	}
+	if window.Sessions["S1 / sk-a...1111"].Requests != 4 || window.Sessions["S2 / sk-b...2222"].Requests != 4 {
+		t.Fatalf("unexpected session breakdown: %+v", window.Sessions)
+	}
+	if window.ClientKeys["sk-c...1234"].Requests != 8 {
+		t.Fatalf("unexpected client breakdown: %+v", window.ClientKeys)
+	}
+}
+
+func TestTimeSeriesSeriesFillsStepsAndFilters(t *testing.T) {
+	series := NewTimeSeries()
+	now := time.Date(2026, 6, 19, 20, 30, 30, 0, time.Local)
+	series.Record(RequestLog{Timestamp: now, Model: "claude-sonnet-4-6", Success: true, SessionIdx: 0})
+	series.Record(RequestLog{Timestamp: now.Add(-3 * time.Minute), Model: "claude-opus-4-6", Success: true, SessionIdx: 1})
+	series.Record(RequestLog{Timestamp: now.Add(-25 * time.Hour), Model: "claude-opus-4-6", Success: true, SessionIdx: 1})
+
+	points := series.Series(now, 10*time.Minute, 2*time.Minute, SeriesFilter{})
+	if len(points) != 5 {
+		t.Fatalf("expected 5 points, got %d", len(points))
+	}
+	if points[4].Requests != 1 || points[3].Requests != 1 || points[0].Requests != 0 {
+		t.Fatalf("unexpected points: %+v", points)
+	}
+	if !points[4].Time.Equal(now.Truncate(time.Minute).Add(-time.Minute)) {
+		t.Fatalf("unexpected last point time %s", points[4].Time)
+	}
+
+	session := 1
+	filtered := series.Series(now, 10*time.Minute, time.Minute, SeriesFilter{SessionIdx: &session})
+	total := int64(0)
+	for _, point := range filtered {
+		total += point.Requests
+	}
+	if total != 1 {
+		t.Fatalf("expected one request for session 2 in the window, got %d", total)
+	}
+}
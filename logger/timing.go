@@ -0,0 +1,126 @@
+package logger
+
+import (
+	"math"
+	"sort"
+	"time"
+)
+
+// Stage names reported by the Claude client for one chat request.
+const (
+	StageOrgLookup    = "org_lookup"
+	StageSettings     = "settings"
+	StageConversation = "conversation"
+	StageUpload       = "upload"
+	StageFirstByte    = "first_byte"
+	StageFirstToken   = "first_token"
+	StageStream       = "stream"
+	// StageTotal is the whole request, used as a key in latency summaries.
+	StageTotal = "total"
+)
+
+// StageTimings breaks a request's duration down by pipeline stage, in milliseconds.
+// FirstByteMs and FirstTokenMs are measured from the start of the completion call,
+// StreamMs from the first response byte to the end of the stream.
+type StageTimings struct {
+	OrgLookupMs    int64 `json:"org_lookup_ms,omitempty"`
+	SettingsMs     int64 `json:"settings_ms,omitempty"`
+	ConversationMs int64 `json:"conversation_ms,omitempty"`
+	UploadMs       int64 `json:"upload_ms,omitempty"`
+	FirstByteMs    int64 `json:"first_byte_ms,omitempty"`
+	FirstTokenMs   int64 `json:"first_token_ms,omitempty"`
+	StreamMs       int64 `json:"stream_ms,omitempty"`
+}
+
+// Record adds elapsed to a stage; settings are updated several times per request, so
+// durations accumulate.
+func (t *StageTimings) Record(stage string, elapsed time.Duration) {
+	if t == nil {
+		return
+	}
+	ms := elapsed.Milliseconds()
+	switch stage {
+	case StageOrgLookup:
+		t.OrgLookupMs += ms
+	case StageSettings:
+		t.SettingsMs += ms
+	case StageConversation:
+		t.ConversationMs += ms
+	case StageUpload:
+		t.UploadMs += ms
+	case StageFirstByte:
+		t.FirstByteMs += ms
+	case StageFirstToken:
+		t.FirstTokenMs += ms
+	case StageStream:
+		t.StreamMs += ms
+	}
+}
+
+func (t *StageTimings) IsZero() bool {
+	return t == nil || *t == StageTimings{}
+}
+
+// values returns the recorded stages by name, skipping stages that did not run.
+func (t *StageTimings) values() map[string]int64 {
+	result := make(map[string]int64, 7)
+	if t == nil {
+		return result
+	}
+	for stage, ms := range map[string]int64{
+		StageOrgLookup:    t.OrgLookupMs,
+		StageSettings:     t.SettingsMs,
+		StageConversation: t.ConversationMs,
+		StageUpload:       t.UploadMs,
+		StageFirstByte:    t.FirstByteMs,
+		StageFirstToken:   t.FirstTokenMs,
+		StageStream:       t.StreamMs,
+	} {
+		if ms > 0 {
+			result[stage] = ms
+		}
+	}
+	return result
+}
+
+// LatencySummary holds percentiles of one stage in milliseconds.
+type LatencySummary struct {
+	Count int     `json:"count"`
+	P50   float64 `json:"p50_ms"`
+	P95   float64 `json:"p95_ms"`
+}
+
+// latencySamples collects stage durations and summarizes them.
+type latencySamples map[string][]int64
+
+func (s latencySamples) add(log RequestLog) {
+	s[StageTotal] = append(s[StageTotal], log.Duration)
+	for stage, ms := range log.Stages.values() {
+		s[stage] = append(s[stage], ms)
+	}
+}
+
+func (s latencySamples) summarize() map[string]LatencySummary {
+	result := make(map[string]LatencySummary, len(s))
+	for stage, samples := range s {
+		sort.Slice(samples, func(i, j int) bool { return samples[i] < samples[j] })
+		result[stage] = LatencySummary{
+			Count: len(samples),
+			P50:   percentile(samples, 50),
+			P95:   percentile(samples, 95),
+		}
+	}
+	return result
+}
+
+// percentile uses the nearest-rank method on sorted samples.
+func percentile(sorted []int64, p float64) float64 {
+	if len(sorted) == 0 {
+		return 0
+	}
+	rank := int(math.Ceil(p / 100 * float64(len(sorted))))
+	if rank < 1 {
+		rank = 1
+	}
+	return float64(sorted[rank-1])
+}
@@ -0,0 +1,65 @@
+package logger
+
+import (
+	"testing"
+	"time"
+)
+
+func TestGetStatsSummarizesStageLatencyByModel(t *testing.T) {
+	requestLogger := NewRequestLogger(100)
+	now := time.Date(2026, 6, 19, 20, 0, 0, 0, time.Local)
+
+	for i := 1; i <= 20; i++ {
+		requestLogger.LogRequest(RequestLog{
+			Timestamp:  now.Add(time.Duration(i) * time.Second),
+			Model:      "claude-sonnet-4-6",
+			Success:    true,
+			Duration:   int64(i * 100),
+			SessionIdx: 0,
+			Stages:     &StageTimings{ConversationMs: int64(i * 10), FirstTokenMs: int64(i * 50)},
+		})
+	}
+	requestLogger.LogRequest(RequestLog{
+		Timestamp:  now,
+		Model:      "claude-opus-4-6",
+		Success:    false,
+		Duration:   300,
+		SessionIdx: 1,
+	})
+
+	stats := requestLogger.GetStats()
+	if total := stats.Latency[StageTotal]; total.Count != 21 || total.P50 != 1000 || total.P95 != 1900 {
+		t.Fatalf("unexpected total latency summary: %+v", total)
+	}
+	if firstToken := stats.Latency[StageFirstToken]; firstToken.Count != 20 || firstToken.P50 != 500 || firstToken.P95 != 950 {
+		t.Fatalf("unexpected first token summary: %+v", firstToken)
+	}
+	if _, ok := stats.Latency[StageUpload]; ok {
+		t.Fatal("expected stages that never ran to be omitted")
+	}
+
+	sonnet := stats.Models["claude-sonnet-4-6"]
+	if sonnet.TotalRequests != 20 || sonnet.SuccessRate != 100 || sonnet.AvgDuration != 1050 {
+		t.Fatalf("unexpected sonnet stats: %+v", sonnet)
+	}
+	if conversation := sonnet.Latency[StageConversation]; conversation.P50 != 100 || conversation.P95 != 190 {
+		t.Fatalf("unexpected sonnet conversation summary: %+v", conversation)
+	}
+	opus := stats.Models["claude-opus-4-6"]
+	if opus.FailedRequests != 1 || opus.SuccessRate != 0 || opus.Latency[StageTotal].P95 != 300 {
+		t.Fatalf("unexpected opus stats: %+v", opus)
+	}
+}
+
+func TestStageTimingsRecordAccumulatesSettings(t *testing.T) {
+	timings := &StageTimings{}
+	timings.Record(StageSettings, 30*time.Millisecond)
+	timings.Record(StageSettings, 20*time.Millisecond)
+	timings.Record("unknown", time.Second)
+	if timings.SettingsMs != 50 {
+		t.Fatalf("expected settings to accumulate to 50ms, got %d", timings.SettingsMs)
+	}
+	if (&StageTimings{}).IsZero() != true || timings.IsZero() {
+		t.Fatal("unexpected IsZero result")
+	}
+}
@@ -2,18 +2,72 @@ package main
 
 import (
 	"claude2api/config"
+	"claude2api/logger"
 	"claude2api/router"
+	"claude2api/service"
+	"claude2api/tracing"
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
 func main() {
-	r := gin.Default()
 	// Load configuration
+	config.Init()
+	r := gin.Default()
 
 	// Setup all routes
 	router.SetupRoutes(r)
 
+	// Restore cooldowns and session stats saved by the previous run
+	service.RestoreRuntimeState()
+
+	// Open the durable request log store
+	if err := service.ConfigureRequestLogStorage(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to open request log storage: %v", err))
+	}
+
+	// Install the tracer before serving so the first requests are traced
+	if err := tracing.Configure(config.ConfigInstance.Tracing); err != nil {
+		logger.Error(fmt.Sprintf("Failed to configure tracing: %v", err))
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	// Start background session health prober and runtime state persister
+	service.StartSessionProber(ctx)
+	service.StartRuntimeStatePersister(ctx)
+
 	// Run the server on 0.0.0.0:8080
-	r.Run(config.ConfigInstance.Address)
+	server := &http.Server{Addr: config.ConfigInstance.Address, Handler: r}
+	go func() {
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error(fmt.Sprintf("Server stopped: %v", err))
+			stop()
+		}
+	}()
+
+	<-ctx.Done()
+	logger.Info("Shutting down server...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		logger.Error(fmt.Sprintf("Server shutdown failed: %v", err))
+	}
+	if err := service.SaveRuntimeState(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to save runtime state: %v", err))
+	}
+	service.CloseRequestLogStorage()
+	if err := tracing.SetGlobalTracer(nil).Shutdown(); err != nil {
+		logger.Error(fmt.Sprintf("Failed to flush traces: %v", err))
+	}
+	logger.Close()
 }
@@ -0,0 +1,114 @@
+package metrics
+
+import (
+	"claude2api/config"
+	"claude2api/logger"
+	"strconv"
+	"sync/atomic"
+	"time"
+)
+
+const namespace = "claude2api_"
+
+// Default is the registry served on /metrics.
+var Default = newDefaultRegistry()
+
+// activeRequests counts chat requests inside the handler, with or without a lease.
+var activeRequests int64
+
+func newDefaultRegistry() *Registry {
+	r := NewRegistry()
+	r.NewCounter(namespace+"requests_total", "Chat completion requests by model, HTTP status and error type.", "model", "status", "error_type")
+	r.NewHistogram(namespace+"request_duration_seconds", "End-to-end chat completion latency.", DefaultLatencyBuckets, "model")
+	r.NewHistogram(namespace+"time_to_first_token_seconds", "Time from request start to the first streamed token.", DefaultLatencyBuckets, "model")
+	r.NewCounter(namespace+"tokens_total", "Estimated tokens by model and direction.", "model", "type")
+	r.NewCounter(namespace+"upstream_responses_total", "Claude upstream responses by HTTP status code.", "code")
+	r.NewGaugeFunc(namespace+"global_in_flight", "Requests currently holding a session lease.", collectGlobalInFlight)
+	r.NewGaugeFunc(namespace+"queue_depth", "Requests being handled that do not hold a session lease yet.", collectQueueDepth)
+	r.NewGaugeFunc(namespace+"session_in_flight", "Requests in flight per session.", collectSessions(sessionInFlight), "session", "key")
+	r.NewGaugeFunc(namespace+"session_cooldown_seconds", "Seconds until the session's cooldown ends; 0 when not cooling.", collectSessions(sessionCooldown), "session", "key")
+	r.NewGaugeFunc(namespace+"session_quarantined", "1 when the session's circuit breaker is open or half-open.", collectSessions(sessionQuarantined), "session", "key")
+	return r
+}
+
+// ObserveRequest records a finished chat request from its request log entry.
+func ObserveRequest(log logger.RequestLog) {
+	errorType := log.ErrorType
+	if log.Success {
+		errorType = ""
+	}
+	Default.Add(namespace+"requests_total", 1, log.Model, strconv.Itoa(log.StatusCode), errorType)
+	Default.Observe(namespace+"request_duration_seconds", float64(log.Duration)/1000, log.Model)
+	if log.TTFTMs > 0 {
+		Default.Observe(namespace+"time_to_first_token_seconds", float64(log.TTFTMs)/1000, log.Model)
+	}
+	if log.InputTokens > 0 {
+		Default.Add(namespace+"tokens_total", float64(log.InputTokens), log.Model, "input")
+	}
+	if log.OutputTokens > 0 {
+		Default.Add(namespace+"tokens_total", float64(log.OutputTokens), log.Model, "output")
+	}
+}
+
+// ObserveUpstreamStatus counts one response status code from Claude.
+func ObserveUpstreamStatus(code int) {
+	Default.Add(namespace+"upstream_responses_total", 1, strconv.Itoa(code))
+}
+
+// RequestStarted and RequestFinished bracket a chat request for the queue depth gauge.
+func RequestStarted() {
+	atomic.AddInt64(&activeRequests, 1)
+}
+
+func RequestFinished() {
+	atomic.AddInt64(&activeRequests, -1)
+}
+
+func collectGlobalInFlight() []Sample {
+	return []Sample{{Value: float64(config.ConfigInstance.GetGlobalInFlight())}}
+}
+
+func collectQueueDepth() []Sample {
+	depth := atomic.LoadInt64(&activeRequests) - int64(config.ConfigInstance.GetGlobalInFlight())
+	if depth < 0 {
+		depth = 0
+	}
+	return []Sample{{Value: float64(depth)}}
+}
+
+func collectSessions(value func(idx int, now time.Time) float64) func() []Sample {
+	return func() []Sample {
+		now := time.Now()
+		config.ConfigInstance.RwMutx.RLock()
+		sessions := append([]config.SessionInfo(nil), config.ConfigInstance.Sessions...)
+		config.ConfigInstance.RwMutx.RUnlock()
+		samples := make([]Sample, 0, len(sessions))
+		for idx, session := range sessions {
+			samples = append(samples, Sample{
+				Labels: []string{strconv.Itoa(idx + 1), config.MaskSecret(session.SessionKey)},
+				Value:  value(idx, now),
+			})
+		}
+		return samples
+	}
+}
+
+func sessionInFlight(idx int, now time.Time) float64 {
+	inFlight, _, _, _, _ := config.ConfigInstance.GetSessionDispatchSnapshot(idx, now)
+	return float64(inFlight)
+}
+
+func sessionCooldown(idx int, now time.Time) float64 {
+	until, cooling := config.ConfigInstance.GetSessionCooldownByIndex(idx, now)
+	if !cooling {
+		return 0
+	}
+	return until.Sub(now).Seconds()
+}
+
+func sessionQuarantined(idx int, now time.Time) float64 {
+	if _, open := config.ConfigInstance.GetSessionBreakerByIndex(idx, now); open {
+		return 1
+	}
+	return 0
+}
@@ -0,0 +1,225 @@
+package metrics
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// DefaultLatencyBuckets are upper bounds in seconds for request latency histograms.
+var DefaultLatencyBuckets = []float64{0.25, 0.5, 1, 2.5, 5, 10, 20, 30, 60, 120, 300}
+
+// Sample is one labelled value of a gauge collected at scrape time.
+type Sample struct {
+	Labels []string
+	Value  float64
+}
+
+// Registry holds counters and histograms and renders them in the Prometheus text format.
+// It is a small hand-rolled subset of the client library, enough for /metrics.
+type Registry struct {
+	mu         sync.Mutex
+	counters   map[string]*counterVec
+	histograms map[string]*histogramVec
+	gauges     map[string]*gaugeFunc
+	names      []string
+}
+
+type counterVec struct {
+	help   string
+	labels []string
+	values map[string]float64
+}
+
+type histogramVec struct {
+	help    string
+	labels  []string
+	buckets []float64
+	values  map[string]*histogram
+}
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+type gaugeFunc struct {
+	help    string
+	labels  []string
+	collect func() []Sample
+}
+
+func NewRegistry() *Registry {
+	return &Registry{
+		counters:   make(map[string]*counterVec),
+		histograms: make(map[string]*histogramVec),
+		gauges:     make(map[string]*gaugeFunc),
+	}
+}
+
+func (r *Registry) NewCounter(name, help string, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.counters[name] = &counterVec{help: help, labels: labels, values: make(map[string]float64)}
+	r.names = append(r.names, name)
+}
+
+func (r *Registry) NewHistogram(name, help string, buckets []float64, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.histograms[name] = &histogramVec{help: help, labels: labels, buckets: buckets, values: make(map[string]*histogram)}
+	r.names = append(r.names, name)
+}
+
+// NewGaugeFunc registers a gauge whose samples are collected on every scrape.
+func (r *Registry) NewGaugeFunc(name, help string, collect func() []Sample, labels ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.gauges[name] = &gaugeFunc{help: help, labels: labels, collect: collect}
+	r.names = append(r.names, name)
+}
+
+// Add increases a counter; labelValues must match the registered label names.
+func (r *Registry) Add(name string, value float64, labelValues ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if counter, ok := r.counters[name]; ok {
+		counter.values[joinLabelValues(labelValues)] += value
+	}
+}
+
+func (r *Registry) Observe(name string, value float64, labelValues ...string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	vec, ok := r.histograms[name]
+	if !ok {
+		return
+	}
+	key := joinLabelValues(labelValues)
+	h := vec.values[key]
+	if h == nil {
+		h = &histogram{counts: make([]uint64, len(vec.buckets))}
+		vec.values[key] = h
+	}
+	for i, bound := range vec.buckets {
+		if value <= bound {
+			h.counts[i]++
+		}
+	}
+	h.sum += value
+	h.count++
+}
+
+// WriteText writes every metric in the Prometheus text exposition format.
+func (r *Registry) WriteText(w io.Writer) error {
+	r.mu.Lock()
+	names := append([]string(nil), r.names...)
+	r.mu.Unlock()
+
+	var b strings.Builder
+	for _, name := range names {
+		r.mu.Lock()
+		counter, isCounter := r.counters[name]
+		hist, isHistogram := r.histograms[name]
+		gauge, isGauge := r.gauges[name]
+		switch {
+		case isCounter:
+			writeHeader(&b, name, counter.help, "counter")
+			for _, key := range sortedKeys(counter.values) {
+				writeSample(&b, name, counter.labels, splitLabelValues(key), nil, counter.values[key])
+			}
+		case isHistogram:
+			writeHeader(&b, name, hist.help, "histogram")
+			keys := make([]string, 0, len(hist.values))
+			for key := range hist.values {
+				keys = append(keys, key)
+			}
+			sort.Strings(keys)
+			for _, key := range keys {
+				h := hist.values[key]
+				values := splitLabelValues(key)
+				for i, bound := range hist.buckets {
+					writeSample(&b, name+"_bucket", hist.labels, values, []string{"le", formatFloat(bound)}, float64(h.counts[i]))
+				}
+				writeSample(&b, name+"_bucket", hist.labels, values, []string{"le", "+Inf"}, float64(h.count))
+				writeSample(&b, name+"_sum", hist.labels, values, nil, h.sum)
+				writeSample(&b, name+"_count", hist.labels, values, nil, float64(h.count))
+			}
+		}
+		r.mu.Unlock()
+
+		// Gauges are collected outside the registry lock, since collectors take other locks.
+		if isGauge {
+			writeHeader(&b, name, gauge.help, "gauge")
+			for _, sample := range gauge.collect() {
+				writeSample(&b, name, gauge.labels, sample.Labels, nil, sample.Value)
+			}
+		}
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func writeHeader(b *strings.Builder, name, help, kind string) {
+	fmt.Fprintf(b, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+}
+
+func writeSample(b *strings.Builder, name string, labels []string, values []string, extra []string, value float64) {
+	b.WriteString(name)
+	pairs := make([]string, 0, len(labels)+1)
+	for i, label := range labels {
+		labelValue := ""
+		if i < len(values) {
+			labelValue = values[i]
+		}
+		pairs = append(pairs, label+"=\""+escapeLabelValue(labelValue)+"\"")
+	}
+	if len(extra) == 2 {
+		pairs = append(pairs, extra[0]+"=\""+extra[1]+"\"")
+	}
+	if len(pairs) > 0 {
+		b.WriteString("{" + strings.Join(pairs, ",") + "}")
+	}
+	b.WriteString(" " + formatFloat(value) + "\n")
+}
+
+func formatFloat(value float64) string {
+	if math.IsInf(value, 1) {
+		return "+Inf"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+func escapeLabelValue(value string) string {
+	value = strings.ReplaceAll(value, `\`, `\\`)
+	value = strings.ReplaceAll(value, "\n", `\n`)
+	return strings.ReplaceAll(value, `"`, `\"`)
+}
+
+// label values are joined with a separator that cannot appear in them.
+const labelSeparator = "\xff"
+
+func joinLabelValues(values []string) string {
+	return strings.Join(values, labelSeparator)
+}
+
+func splitLabelValues(key string) []string {
+	if key == "" {
+		return nil
+	}
+	return strings.Split(key, labelSeparator)
+}
+
+func sortedKeys(values map[string]float64) []string {
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,42 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRegistryWritesPrometheusText(t *testing.T) {
+	r := NewRegistry()
+	r.NewCounter("test_requests_total", "Requests.", "model", "status")
+	r.NewHistogram("test_duration_seconds", "Latency.", []float64{1, 5}, "model")
+	r.NewGaugeFunc("test_in_flight", "In flight.", func() []Sample {
+		return []Sample{{Labels: []string{`S1 "a"`}, Value: 2}}
+	}, "session")
+
+	r.Add("test_requests_total", 1, "claude-sonnet-4-6", "200")
+	r.Add("test_requests_total", 2, "claude-sonnet-4-6", "200")
+	r.Observe("test_duration_seconds", 0.5, "claude-sonnet-4-6")
+	r.Observe("test_duration_seconds", 3, "claude-sonnet-4-6")
+	r.Observe("test_duration_seconds", 7, "claude-sonnet-4-6")
+
+	var out strings.Builder
+	if err := r.WriteText(&out); err != nil {
+		t.Fatalf("write metrics: %v", err)
+	}
+	text := out.String()
+	for _, want := range []string{
+		"# TYPE test_requests_total counter\n",
+		`test_requests_total{model="claude-sonnet-4-6",status="200"} 3`,
+		`test_duration_seconds_bucket{model="claude-sonnet-4-6",le="1"} 1`,
+		`test_duration_seconds_bucket{model="claude-sonnet-4-6",le="5"} 2`,
+		`test_duration_seconds_bucket{model="claude-sonnet-4-6",le="+Inf"} 3`,
+		`test_duration_seconds_sum{model="claude-sonnet-4-6"} 10.5`,
+		`test_duration_seconds_count{model="claude-sonnet-4-6"} 3`,
+		"# TYPE test_in_flight gauge\n",
+		`test_in_flight{session="S1 \"a\""} 2`,
+	} {
+		if !strings.Contains(text, want) {
+			t.Fatalf("expected metrics output to contain %q, got:\n%s", want, text)
+		}
+	}
+}
@@ -3,6 +3,7 @@ package middleware
 import (
 	"claude2api/adminauth"
 	"claude2api/config"
+	"crypto/subtle"
 	"net/http"
 	"strings"
 
@@ -39,6 +40,20 @@ func AuthMiddleware() gin.HandlerFunc {
 			return
 		}
 
+		// A dedicated metrics token lets scrapers in without the API key
+		if path == "/metrics" && config.ConfigInstance.Metrics.Token != "" {
+			token := strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer ")
+			if subtle.ConstantTimeCompare([]byte(token), []byte(config.ConfigInstance.Metrics.Token)) != 1 {
+				c.JSON(http.StatusUnauthorized, gin.H{
+					"error": "Invalid metrics token",
+				})
+				c.Abort()
+				return
+			}
+			c.Next()
+			return
+		}
+
 		if config.ConfigInstance.EnableMirrorApi && strings.HasPrefix(path, config.ConfigInstance.MirrorApiPrefix) {
 			c.Set("UseMirrorApi", true)
 			c.Next()
@@ -0,0 +1,43 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestRequestIDMiddlewareReusesOrGeneratesID(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	r.Use(RequestIDMiddleware())
+	r.GET("/", func(c *gin.Context) {
+		c.String(http.StatusOK, c.GetString("request_id"))
+	})
+
+	for header, reused := range map[string]bool{
+		"client-req-123":          true,
+		"":                        false,
+		"bad id\nwith newline":    false,
+		string(make([]byte, 200)): false,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		if header != "" {
+			req.Header.Set("X-Request-ID", header)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+
+		got := w.Header().Get("X-Request-ID")
+		if got == "" || got != w.Body.String() {
+			t.Fatalf("expected response header to match context ID, got %q / %q", got, w.Body.String())
+		}
+		if reused && got != header {
+			t.Fatalf("expected incoming ID %q to be reused, got %q", header, got)
+		}
+		if !reused && len(got) != 36 {
+			t.Fatalf("expected a generated UUID for %q, got %q", header, got)
+		}
+	}
+}
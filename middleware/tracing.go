@@ -0,0 +1,37 @@
+package middleware
+
+import (
+	"claude2api/tracing"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// TracingMiddleware starts a server span for each API request, continuing the trace
+// from an incoming W3C traceparent header, and returns the span's traceparent.
+func TracingMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		path := c.Request.URL.Path
+		if path == "/health" || path == "/metrics" || strings.HasPrefix(path, "/admin/") {
+			c.Next()
+			return
+		}
+
+		ctx := tracing.ContextWithTraceparent(c.Request.Context(), c.GetHeader("traceparent"))
+		ctx, span := tracing.Start(ctx, c.Request.Method+" "+path)
+		if span == nil {
+			c.Next()
+			return
+		}
+		defer span.End()
+		span.SetAttribute("http.method", c.Request.Method)
+		span.SetAttribute("http.target", path)
+		span.SetAttribute("request_id", c.GetString("request_id"))
+		c.Request = c.Request.WithContext(ctx)
+		c.Writer.Header().Set("traceparent", span.Traceparent())
+
+		c.Next()
+
+		span.SetAttribute("http.status_code", c.Writer.Status())
+	}
+}
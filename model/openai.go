@@ -18,6 +18,7 @@ type ChatCompletionRequest struct {
 	ReasoningEffort string                   `json:"reasoning_effort,omitempty"`
 	Thinking        map[string]interface{}   `json:"thinking,omitempty"`
 	OutputConfig    map[string]interface{}   `json:"output_config,omitempty"`
+	User            string                   `json:"user,omitempty"`
 }
 
 // OpenAISrteamResponse 定义 OpenAI 的流式响应结构
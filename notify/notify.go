@@ -0,0 +1,259 @@
+package notify
+
+import (
+	"bytes"
+	"claude2api/config"
+	"claude2api/logger"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryBackoff = time.Second
+	maxRetryBackoff     = 30 * time.Second
+	webhookTimeout      = 10 * time.Second
+)
+
+// Event is one session or pool event worth telling the on-call about.
+type Event struct {
+	Type    string
+	Title   string
+	Message string
+	// Session is a masked session label such as "S2 / sk-a****wxyz".
+	Session string
+	// ResetAt is the official Claude reset time, when known.
+	ResetAt time.Time
+	Time    time.Time
+	// DedupKey distinguishes events of the same type, e.g. per session; empty dedups per type.
+	DedupKey string
+}
+
+// Notifier posts events to the configured webhooks.
+type Notifier struct {
+	settings func() config.NotificationConfig
+	client   *http.Client
+	sleep    func(time.Duration)
+	now      func() time.Time
+	backoff  time.Duration
+
+	mu       sync.Mutex
+	lastSent map[string]time.Time
+	pending  sync.WaitGroup
+}
+
+var GlobalNotifier = NewNotifier(func() config.NotificationConfig {
+	if config.ConfigInstance == nil {
+		return config.NotificationConfig{}
+	}
+	return config.ConfigInstance.Notifications
+})
+
+// NewNotifier creates a notifier that reads its settings from the given source on every event.
+func NewNotifier(settings func() config.NotificationConfig) *Notifier {
+	return &Notifier{
+		settings: settings,
+		client:   &http.Client{Timeout: webhookTimeout},
+		sleep:    time.Sleep,
+		now:      time.Now,
+		backoff:  defaultRetryBackoff,
+		lastSent: make(map[string]time.Time),
+	}
+}
+
+// Publish sends the event through GlobalNotifier.
+func Publish(event Event) {
+	GlobalNotifier.Publish(event)
+}
+
+// Publish delivers the event asynchronously to every subscribed webhook, skipping
+// targets that already received the same event inside the dedup window.
+func (n *Notifier) Publish(event Event) {
+	settings := config.NormalizeNotification(n.settings())
+	if !settings.Enabled || len(settings.Webhooks) == 0 {
+		return
+	}
+	if event.Time.IsZero() {
+		event.Time = n.now()
+	}
+
+	window := time.Duration(settings.DedupSeconds) * time.Second
+	for _, webhook := range settings.Webhooks {
+		if !subscribes(webhook, event.Type) {
+			continue
+		}
+		if !n.claim(webhook.URL+"|"+event.Type+"|"+event.DedupKey, event.Time, window) {
+			continue
+		}
+		payload, err := buildPayload(webhook.Format, event)
+		if err != nil {
+			logger.Error(fmt.Sprintf("Failed to build %s notification: %v", webhook.Format, err))
+			continue
+		}
+		n.pending.Add(1)
+		go func(url string) {
+			defer n.pending.Done()
+			n.deliver(url, payload, settings.MaxRetries)
+		}(webhook.URL)
+	}
+}
+
+// Wait blocks until every in-flight delivery has finished.
+func (n *Notifier) Wait() {
+	n.pending.Wait()
+}
+
+func (n *Notifier) claim(key string, now time.Time, window time.Duration) bool {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for existing, sentAt := range n.lastSent {
+		if now.Sub(sentAt) >= window {
+			delete(n.lastSent, existing)
+		}
+	}
+	if _, ok := n.lastSent[key]; ok {
+		return false
+	}
+	n.lastSent[key] = now
+	return true
+}
+
+// deliver posts the payload, retrying failures with exponential backoff.
+func (n *Notifier) deliver(url string, payload []byte, maxRetries int) {
+	backoff := n.backoff
+	var lastErr error
+	for attempt := 0; attempt <= maxRetries; attempt++ {
+		if attempt > 0 {
+			n.sleep(backoff)
+			backoff *= 2
+			if backoff > maxRetryBackoff {
+				backoff = maxRetryBackoff
+			}
+		}
+		resp, err := n.client.Post(url, "application/json", bytes.NewReader(payload))
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		resp.Body.Close()
+		if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+			return
+		}
+		lastErr = fmt.Errorf("unexpected status code %d", resp.StatusCode)
+		if resp.StatusCode < 500 && resp.StatusCode != http.StatusTooManyRequests {
+			break
+		}
+	}
+	logger.Error(fmt.Sprintf("Failed to deliver notification to %s: %v", maskWebhookURL(url), lastErr))
+}
+
+func subscribes(webhook config.WebhookConfig, eventType string) bool {
+	if len(webhook.Events) == 0 {
+		return true
+	}
+	for _, event := range webhook.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+// buildPayload renders the event for the webhook's format.
+func buildPayload(format string, event Event) ([]byte, error) {
+	text := formatText(event)
+	switch format {
+	case config.NotifyFormatSlack:
+		return json.Marshal(map[string]interface{}{
+			"text": text,
+		})
+	case config.NotifyFormatFeishu:
+		return json.Marshal(map[string]interface{}{
+			"msg_type": "text",
+			"content":  map[string]string{"text": text},
+		})
+	case config.NotifyFormatDingTalk:
+		return json.Marshal(map[string]interface{}{
+			"msgtype": "text",
+			"text":    map[string]string{"content": text},
+		})
+	default:
+		body := map[string]interface{}{
+			"event":   event.Type,
+			"title":   event.Title,
+			"message": event.Message,
+			"session": event.Session,
+			"time":    event.Time.Format(time.RFC3339),
+		}
+		if !event.ResetAt.IsZero() {
+			body["reset_at"] = event.ResetAt.Format(time.RFC3339)
+		}
+		return json.Marshal(body)
+	}
+}
+
+func formatText(event Event) string {
+	lines := []string{"[claude2api] " + event.Title}
+	if event.Message != "" {
+		lines = append(lines, event.Message)
+	}
+	if event.Session != "" {
+		lines = append(lines, "Session: "+event.Session)
+	}
+	if !event.ResetAt.IsZero() {
+		lines = append(lines, "Reset at: "+formatChinaTime(event.ResetAt))
+	}
+	lines = append(lines, "Time: "+formatChinaTime(event.Time))
+	return strings.Join(lines, "\n")
+}
+
+func formatChinaTime(t time.Time) string {
+	location, err := time.LoadLocation("Asia/Shanghai")
+	if err != nil {
+		location = time.FixedZone("CST", 8*60*60)
+	}
+	return t.In(location).Format("2006-01-02 15:04:05") + " 中国时间"
+}
+
+// maskWebhookURL hides the path, which usually carries the webhook token.
+func maskWebhookURL(raw string) string {
+	schemeEnd := strings.Index(raw, "://")
+	if schemeEnd < 0 {
+		return config.MaskSecret(raw)
+	}
+	hostEnd := strings.Index(raw[schemeEnd+3:], "/")
+	if hostEnd < 0 {
+		return raw
+	}
+	return raw[:schemeEnd+3+hostEnd] + "/****"
+}
+
+// MaskWebhooks returns a copy of the webhooks with their URLs masked for display.
+func MaskWebhooks(webhooks []config.WebhookConfig) []config.WebhookConfig {
+	masked := make([]config.WebhookConfig, 0, len(webhooks))
+	for _, webhook := range webhooks {
+		webhook.URL = maskWebhookURL(webhook.URL)
+		masked = append(masked, webhook)
+	}
+	return masked
+}
+
+// RestoreMaskedWebhooks swaps URLs that the admin panel echoed back in masked form
+// for the stored URL they were masked from, so saving the form keeps the real tokens.
+func RestoreMaskedWebhooks(settings config.NotificationConfig, existing []config.WebhookConfig) config.NotificationConfig {
+	webhooks := make([]config.WebhookConfig, 0, len(settings.Webhooks))
+	for _, webhook := range settings.Webhooks {
+		for _, stored := range existing {
+			if stored.URL != webhook.URL && maskWebhookURL(stored.URL) == webhook.URL {
+				webhook.URL = stored.URL
+				break
+			}
+		}
+		webhooks = append(webhooks, webhook)
+	}
+	settings.Webhooks = webhooks
+	return settings
+}
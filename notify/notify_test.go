@@ -0,0 +1,148 @@
+package notify
+
+import (
+	"claude2api/config"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+)
+
+type webhookRecorder struct {
+	mu       sync.Mutex
+	bodies   []map[string]interface{}
+	failures int
+}
+
+func (r *webhookRecorder) handler(t *testing.T) http.HandlerFunc {
+	return func(w http.ResponseWriter, req *http.Request) {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		if r.failures > 0 {
+			r.failures--
+			w.WriteHeader(http.StatusInternalServerError)
+			return
+		}
+		raw, _ := io.ReadAll(req.Body)
+		body := map[string]interface{}{}
+		if err := json.Unmarshal(raw, &body); err != nil {
+			t.Errorf("webhook received invalid JSON %q: %v", raw, err)
+		}
+		r.bodies = append(r.bodies, body)
+	}
+}
+
+func (r *webhookRecorder) received() []map[string]interface{} {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]map[string]interface{}(nil), r.bodies...)
+}
+
+func newTestNotifier(settings config.NotificationConfig) *Notifier {
+	n := NewNotifier(func() config.NotificationConfig { return settings })
+	n.sleep = func(time.Duration) {}
+	return n
+}
+
+func TestPublishBuildsPayloadPerFormat(t *testing.T) {
+	recorder := &webhookRecorder{}
+	server := httptest.NewServer(recorder.handler(t))
+	defer server.Close()
+
+	n := newTestNotifier(config.NotificationConfig{
+		Enabled: true,
+		Webhooks: []config.WebhookConfig{
+			{URL: server.URL + "/json"},
+			{URL: server.URL + "/slack", Format: "slack"},
+			{URL: server.URL + "/feishu", Format: "lark"},
+			{URL: server.URL + "/dingtalk", Format: "dingtalk"},
+		},
+	})
+	n.Publish(Event{
+		Type:    config.NotifyEventCooldownSet,
+		Title:   "Session cooling down",
+		Session: "S1 / sk-ant-sid...abcde",
+		ResetAt: time.Date(2026, 7, 7, 10, 0, 0, 0, time.UTC),
+	})
+	n.Wait()
+
+	bodies := recorder.received()
+	if len(bodies) != 4 {
+		t.Fatalf("expected 4 deliveries, got %d", len(bodies))
+	}
+	seen := map[string]bool{}
+	for _, body := range bodies {
+		switch {
+		case body["event"] == config.NotifyEventCooldownSet:
+			if body["reset_at"] != "2026-07-07T10:00:00Z" {
+				t.Fatalf("unexpected json payload: %v", body)
+			}
+			seen["json"] = true
+		case body["msg_type"] == "text":
+			seen["feishu"] = true
+		case body["msgtype"] == "text":
+			seen["dingtalk"] = true
+		case body["text"] != nil:
+			seen["slack"] = true
+		}
+	}
+	if len(seen) != 4 {
+		t.Fatalf("expected every format to be delivered once, got %v", seen)
+	}
+}
+
+func TestPublishRetriesServerErrors(t *testing.T) {
+	recorder := &webhookRecorder{failures: 2}
+	server := httptest.NewServer(recorder.handler(t))
+	defer server.Close()
+
+	n := newTestNotifier(config.NotificationConfig{Enabled: true, Webhooks: []config.WebhookConfig{{URL: server.URL}}})
+	n.Publish(Event{Type: config.NotifyEventPoolExhausted, Title: "No dispatchable Claude session"})
+	n.Wait()
+
+	if got := len(recorder.received()); got != 1 {
+		t.Fatalf("expected delivery after retries, got %d", got)
+	}
+}
+
+func TestPublishDedupsAndFiltersEvents(t *testing.T) {
+	recorder := &webhookRecorder{}
+	server := httptest.NewServer(recorder.handler(t))
+	defer server.Close()
+
+	now := time.Date(2026, 7, 7, 8, 0, 0, 0, time.UTC)
+	n := newTestNotifier(config.NotificationConfig{
+		Enabled:      true,
+		DedupSeconds: 60,
+		Webhooks:     []config.WebhookConfig{{URL: server.URL, Events: []string{"Session_Quarantined"}}},
+	})
+	n.now = func() time.Time { return now }
+
+	n.Publish(Event{Type: config.NotifyEventSessionQuarantined, DedupKey: "sk-a"})
+	n.Publish(Event{Type: config.NotifyEventSessionQuarantined, DedupKey: "sk-a"})
+	n.Publish(Event{Type: config.NotifyEventSessionQuarantined, DedupKey: "sk-b"})
+	n.Publish(Event{Type: config.NotifyEventPoolExhausted})
+	now = now.Add(2 * time.Minute)
+	n.Publish(Event{Type: config.NotifyEventSessionQuarantined, DedupKey: "sk-a"})
+	n.Wait()
+
+	if got := len(recorder.received()); got != 3 {
+		t.Fatalf("expected 3 deliveries after dedup and filtering, got %d", got)
+	}
+}
+
+func TestRestoreMaskedWebhooks(t *testing.T) {
+	stored := []config.WebhookConfig{{URL: "https://hooks.slack.com/services/T000/B000/secret"}}
+	masked := MaskWebhooks(stored)
+	if masked[0].URL != "https://hooks.slack.com/****" {
+		t.Fatalf("unexpected masked URL: %s", masked[0].URL)
+	}
+
+	restored := RestoreMaskedWebhooks(config.NotificationConfig{Webhooks: append(masked, config.WebhookConfig{URL: "https://example.com/new"})}, stored)
+	if restored.Webhooks[0].URL != stored[0].URL || restored.Webhooks[1].URL != "https://example.com/new" {
+		t.Fatalf("unexpected restored webhooks: %+v", restored.Webhooks)
+	}
+}
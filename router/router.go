@@ -12,12 +12,17 @@ import (
 
 func SetupRoutes(r *gin.Engine) {
 	// Apply middleware
+	r.Use(middleware.RequestIDMiddleware())
 	r.Use(middleware.CORSMiddleware())
 	r.Use(middleware.AuthMiddleware())
+	r.Use(middleware.TracingMiddleware())
 
 	// Health check endpoint
 	r.GET("/health", service.HealthCheckHandler)
 
+	// Prometheus metrics endpoint
+	r.GET("/metrics", service.MetricsHandler)
+
 	// Admin authentication endpoints
 	r.POST("/admin-api/login", service.AdminLoginHandler)
 	r.GET("/admin-api/auth/status", service.AdminAuthStatusHandler)
@@ -34,8 +39,12 @@ func SetupRoutes(r *gin.Engine) {
 	r.POST("/admin-api/session/:index/cooldown/clear", service.AdminClearSessionCooldownHandler)
 	r.POST("/admin-api/session/test", service.AdminTestSessionHandler)
 	r.GET("/admin-api/sessions/export", service.AdminExportSessionsHandler)
+	r.GET("/admin-api/affinity", service.AdminAffinityHandler)
+	r.DELETE("/admin-api/affinity", service.AdminClearAffinityHandler)
 	r.GET("/admin-api/stats", service.AdminStatsHandler)
+	r.GET("/admin-api/stats/timeseries", service.AdminStatsTimeseriesHandler)
 	r.GET("/admin-api/logs", service.AdminLogsHandler)
+	r.GET("/admin-api/logs/export", service.AdminExportLogsHandler)
 	r.DELETE("/admin-api/logs", service.AdminClearLogsHandler)
 
 	// Admin static files (no auth required)
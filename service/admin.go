@@ -5,10 +5,14 @@ import (
 	"claude2api/config"
 	"claude2api/core"
 	"claude2api/logger"
+	"claude2api/metrics"
+	"claude2api/notify"
+	"claude2api/tracing"
 	"claude2api/utils"
+	"context"
+	"errors"
 	"fmt"
 	"net/http"
-	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"strings"
@@ -57,6 +61,34 @@ func AdminStatusHandler(c *gin.Context) {
 		}
 		sessionStats := statsBySession[i]
 		inFlight, maxConcurrent, maxGlobalConcurrency, dispatchStatus, dispatchAvailable := config.ConfigInstance.GetSessionDispatchSnapshot(i, now)
+		budget := config.ConfigInstance.GetSessionBudgetStatus(i, sessionStats, now)
+		breakerState := config.BreakerStateClosed
+		breakerFailures := 0
+		quarantinedUntil := ""
+		if breaker, ok := config.ConfigInstance.GetSessionBreakerByIndex(i, now); ok {
+			breakerState = breaker.State
+			breakerFailures = breaker.ConsecutiveFailures
+			if breaker.State == config.BreakerStateOpen {
+				quarantinedUntil = formatChinaTime(breaker.OpenUntil)
+			}
+		}
+		health := config.ConfigInstance.GetSessionHealthByIndex(i)
+		healthCheckedAt := ""
+		if !health.CheckedAt.IsZero() {
+			healthCheckedAt = formatChinaTime(health.CheckedAt)
+		}
+		quotaType := ""
+		quotaRemaining := -1
+		quotaResetsAt := ""
+		quotaUtilization := 0.0
+		if quota, ok := config.ConfigInstance.GetSessionQuotaByIndex(i, now); ok {
+			quotaType = quota.Type
+			quotaRemaining = quota.Remaining
+			quotaUtilization = quota.Utilization
+			if !quota.ResetsAt.IsZero() {
+				quotaResetsAt = formatChinaTime(quota.ResetsAt)
+			}
+		}
 		sessions = append(sessions, map[string]interface{}{
 			"index":                           i,
 			"session_key":                     maskedKey,
@@ -64,6 +96,7 @@ func AdminStatusHandler(c *gin.Context) {
 			"cf_clearance":                    session.CFClearance != "",
 			"cookie_string":                   session.CookieString != "",
 			"cookie_preview":                  maskCookiePreview(session),
+			"weight":                          config.NormalizeSessionWeight(session.Weight),
 			"cooling_down":                    coolingDown,
 			"cooldown_until":                  cooldownUntil,
 			"cooldown_source":                 cooldownSource,
@@ -88,6 +121,21 @@ func AdminStatusHandler(c *gin.Context) {
 			"total_tokens":                    sessionStats.TotalTokens,
 			"avg_tokens_per_success":          sessionStats.AvgTokensPerSuccess,
 			"avg_successes_before_rate_limit": sessionStats.AvgSuccessesBeforeRateLimit,
+			"learned_budget":                  budget.Budget,
+			"has_learned_budget":              budget.HasBudget,
+			"budget_window_usage":             budget.WindowUsage,
+			"budget_pressured":                budget.Pressured,
+			"breaker_state":                   breakerState,
+			"breaker_failures":                breakerFailures,
+			"quarantined_until":               quarantinedUntil,
+			"health_status":                   health.Status,
+			"health_checked_at":               healthCheckedAt,
+			"health_latency_ms":               health.LatencyMs,
+			"health_error":                    health.LastError,
+			"quota_type":                      quotaType,
+			"quota_remaining":                 quotaRemaining,
+			"quota_resets_at":                 quotaResetsAt,
+			"quota_utilization":               quotaUtilization,
 		})
 	}
 
@@ -148,6 +196,13 @@ func AdminLogoutHandler(c *gin.Context) {
 }
 
 // maskSessionKey masks the session key for display
+// maskedNotificationConfig hides webhook tokens before the config leaves the server.
+func maskedNotificationConfig(settings config.NotificationConfig) config.NotificationConfig {
+	settings = config.NormalizeNotification(settings)
+	settings.Webhooks = notify.MaskWebhooks(settings.Webhooks)
+	return settings
+}
+
 func maskSessionKey(key string) string {
 	key = strings.TrimSpace(key)
 	if key == "" {
@@ -168,6 +223,7 @@ type AddSessionRequest struct {
 	OrgID        string `json:"org_id"`
 	CFClearance  string `json:"cf_clearance"`
 	CookieString string `json:"cookie_string"`
+	Weight       int    `json:"weight"`
 }
 
 type ImportSessionsRequest struct {
@@ -211,6 +267,9 @@ func AdminAddSessionHandler(c *gin.Context) {
 		CFClearance:  strings.TrimSpace(req.CFClearance),
 		CookieString: strings.TrimSpace(req.CookieString),
 	}
+	if req.Weight > 0 {
+		newSession.Weight = config.NormalizeSessionWeight(req.Weight)
+	}
 	config.ConfigInstance.Sessions = append(config.ConfigInstance.Sessions, newSession)
 	config.ConfigInstance.RetryCount = len(config.ConfigInstance.Sessions)
 	if config.ConfigInstance.RetryCount > 5 {
@@ -275,6 +334,8 @@ func AdminImportSessionsHandler(c *gin.Context) {
 		config.ConfigInstance.RetryCount = 5
 	}
 
+	pruneClientPool()
+
 	if added > 0 {
 		if err := saveConfigToYAML(); err != nil {
 			logger.Error(fmt.Sprintf("Failed to save config: %v", err))
@@ -371,6 +432,7 @@ func AdminRemoveSessionHandler(c *gin.Context) {
 		config.ConfigInstance.Sessions[index+1:]...,
 	)
 	config.ConfigInstance.ClearSessionCooldown(removed.SessionKey)
+	pruneClientPool()
 	config.ConfigInstance.RetryCount = len(config.ConfigInstance.Sessions)
 	if config.ConfigInstance.RetryCount > 5 {
 		config.ConfigInstance.RetryCount = 5
@@ -405,7 +467,8 @@ func AdminClearSessionCooldownHandler(c *gin.Context) {
 
 	session := config.ConfigInstance.Sessions[index]
 	config.ConfigInstance.ClearSessionCooldown(session.SessionKey)
-	logger.Info(fmt.Sprintf("Cleared cooldown for session %d (%s)", index+1, maskSessionKey(session.SessionKey)))
+	config.ConfigInstance.ResetSessionBreaker(session.SessionKey)
+	logger.Info(fmt.Sprintf("Cleared cooldown and quarantine for session %d (%s)", index+1, maskSessionKey(session.SessionKey)))
 
 	c.JSON(http.StatusOK, gin.H{
 		"status":  "ok",
@@ -456,9 +519,10 @@ func AdminTestSessionHandler(c *gin.Context) {
 	// Update org ID if not set
 	if req.Index >= 0 && req.Index < len(config.ConfigInstance.Sessions) {
 		if config.ConfigInstance.Sessions[req.Index].OrgID == "" && result.OrgID != "" {
-			config.ConfigInstance.SetSessionOrgID(testSession.SessionKey, result.OrgID)
+			config.ConfigInstance.SetSessionOrgID(testSession.SessionKey, result.OrgID, requestLogger(c))
 		}
 		config.ConfigInstance.ClearSessionCooldown(testSession.SessionKey)
+		config.ConfigInstance.ResetSessionBreaker(testSession.SessionKey)
 	}
 
 	c.JSON(http.StatusOK, gin.H{
@@ -505,9 +569,10 @@ func AdminBatchTestSessionsHandler(c *gin.Context) {
 			continue
 		}
 		if config.ConfigInstance.Sessions[index].OrgID == "" && result.OrgID != "" {
-			config.ConfigInstance.SetSessionOrgID(session.SessionKey, result.OrgID)
+			config.ConfigInstance.SetSessionOrgID(session.SessionKey, result.OrgID, requestLogger(c))
 		}
 		config.ConfigInstance.ClearSessionCooldown(session.SessionKey)
+		config.ConfigInstance.ResetSessionBreaker(session.SessionKey)
 		successCount++
 		results = append(results, gin.H{
 			"index":        index,
@@ -559,15 +624,30 @@ func normalizeBatchTestIndices(indices []int) []int {
 }
 
 type adminSessionTestResult struct {
-	Model        string
-	OrgID        string
-	InputTokens  int
-	OutputTokens int
+	Model string
+	// UpstreamModel is the claude.ai model the test ran on, as logged for the request.
+	UpstreamModel string
+	OrgID         string
+	InputTokens   int
+	OutputTokens  int
 }
 
 func runAdminOpenAITestRequest(c *gin.Context, session config.SessionInfo, sessionIdx int, requestedModel string) (adminSessionTestResult, error) {
 	startTime := time.Now()
 	c.Set("request_message_count", 1)
+	result, err := runSessionTestCompletion(c.Request.Context(), session, sessionIdx, requestedModel, requestLogger(c))
+	if err != nil {
+		logRequest(c, result.UpstreamModel, sessionIdx, 0, 0, false, startTime, err.Error())
+		return result, fmt.Errorf("OpenAI request test failed: %s", err.Error())
+	}
+	logRequest(c, result.UpstreamModel, sessionIdx, result.InputTokens, result.OutputTokens, true, startTime, "")
+	return result, nil
+}
+
+// runSessionTestCompletion sends a one-line chat on session and reads the answer with
+// Client.Complete, so it needs no HTTP response and also serves the health probe. A rate
+// limited session is cooled down the same way the chat handler does it.
+func runSessionTestCompletion(ctx context.Context, session config.SessionInfo, sessionIdx int, requestedModel string, log *logger.Entry) (adminSessionTestResult, error) {
 	if requestedModel == "" {
 		requestedModel = "claude-sonnet-4-6"
 	}
@@ -583,79 +663,87 @@ func runAdminOpenAITestRequest(c *gin.Context, session config.SessionInfo, sessi
 		},
 	})
 
-	recorder := httptest.NewRecorder()
-	testContext, _ := gin.CreateTestContext(recorder)
-	testContext.Request = c.Request.Clone(c.Request.Context())
-
 	modelName := selectedModel.UpstreamID
 	if selectedModel.Thinking {
 		modelName += "-think"
 	}
-
+	result := adminSessionTestResult{Model: selectedModel.PublicID, UpstreamModel: modelName}
+
+	client := core.NewClientFromSession(session, config.ConfigInstance.Proxy, modelName,
+		core.WithThinkingOptions(selectedModel.ThinkingMode, selectedModel.EffortLevel),
+		core.WithMessageLimitHandler(newSessionQuotaRecorder(sessionIdx, session.SessionKey, log)),
+		core.WithUpstreamStatusHandler(metrics.ObserveUpstreamStatus),
+		core.WithContext(ctx),
+		core.WithLogEntry(log),
+		upstreamClientOption(selectedModel.Upstream),
+		transcriptClientOption(),
+		pooledClientOption(session.SessionKey),
+	)
 	if session.OrgID == "" {
-		client := core.NewClientFromSession(session, config.ConfigInstance.Proxy, modelName)
 		orgID, err := client.GetOrgID()
 		if err != nil {
-			errorMessage := fmt.Sprintf("failed to get org ID: %s", core.GetErrorMessage(err))
-			logRequest(c, modelName, sessionIdx, 0, 0, false, startTime, errorMessage)
-			return adminSessionTestResult{Model: selectedModel.PublicID}, fmt.Errorf("OpenAI request test failed: %s", errorMessage)
+			return result, fmt.Errorf("failed to get org ID: %s", core.GetErrorMessage(err))
 		}
 		session.OrgID = orgID
 		if sessionIdx >= 0 && sessionIdx < len(config.ConfigInstance.Sessions) {
-			config.ConfigInstance.SetSessionOrgID(session.SessionKey, orgID)
+			config.ConfigInstance.SetSessionOrgID(session.SessionKey, orgID, log)
 		}
 	}
+	client.SetOrgID(session.OrgID)
 
-	inputTokens, outputTokens, err := handleChatRequestWithTokens(
-		testContext,
-		session,
-		modelName,
-		processor,
-		false,
-		selectedModel.ThinkingMode,
-		selectedModel.EffortLevel,
-	)
+	conversationID, err := client.CreateConversation()
 	if err != nil {
-		errorMessage := core.GetErrorMessage(err)
-		if core.IsRateLimitError(err) {
-			cooldownUntil := time.Time{}
-			cooldownSource := ""
-			now := time.Now()
-			if resetAt, ok := core.GetRateLimitResetAt(err); ok {
-				cooldownUntil, cooldownSource = config.ConfigInstance.CooldownSessionAfterRateLimit(session.SessionKey, resetAt, now)
-			}
-			if cooldownSource == config.CooldownSourceOfficial {
-				errorMessage = fmt.Sprintf("rate limit exceeded - Claude official reset at: %s 中国时间", formatChinaTime(cooldownUntil))
-				logger.Error(fmt.Sprintf(
-					"Admin session test hit rate limit for S%d (%s); cooling down until %s (source: %s)",
-					sessionIdx+1,
-					maskSessionKey(session.SessionKey),
-					formatChinaTime(cooldownUntil),
-					cooldownSource,
-				))
-			} else {
-				errorMessage = "rate limit exceeded - Claude did not return a usable future reset time; session was not frozen"
-				logger.Error(fmt.Sprintf(
-					"Admin session test hit rate limit for S%d (%s) without usable official reset time; not freezing session",
-					sessionIdx+1,
-					maskSessionKey(session.SessionKey),
-				))
-			}
-		}
-		logRequest(c, modelName, sessionIdx, 0, 0, false, startTime, errorMessage)
-		return adminSessionTestResult{Model: selectedModel.PublicID}, fmt.Errorf("OpenAI request test failed: %s", errorMessage)
+		return result, sessionTestError(err, session, sessionIdx)
 	}
-	if inputTokens == 0 && outputTokens == 0 {
-		outputTokens = 1
+	usage, err := client.Complete(ctx, conversationID, processor.Prompt.String(), func(core.Event) {})
+	if err != nil || config.ConfigInstance.ChatDelete {
+		go cleanupConversation(client, conversationID, 3)
+	}
+	if err != nil {
+		return result, sessionTestError(err, session, sessionIdx)
 	}
 
-	logRequest(c, modelName, sessionIdx, inputTokens, outputTokens, true, startTime, "")
-	return adminSessionTestResult{
-		Model:        selectedModel.PublicID,
-		OrgID:        getSessionOrgID(session, sessionIdx),
-		InputTokens:  inputTokens,
-		OutputTokens: outputTokens,
-	}, nil
+	if usage != nil {
+		result.InputTokens = usage.InputTokens
+		result.OutputTokens = usage.OutputTokens
+	}
+	if result.InputTokens == 0 && result.OutputTokens == 0 {
+		result.OutputTokens = 1
+	}
+	result.OrgID = getSessionOrgID(session, sessionIdx)
+	return result, nil
+}
+
+// sessionTestError describes a failed session test, cooling the session down when
+// Claude rate limited it with a usable reset time.
+func sessionTestError(err error, session config.SessionInfo, sessionIdx int) error {
+	errorMessage := core.GetErrorMessage(err)
+	if core.IsRateLimitError(err) {
+		cooldownUntil := time.Time{}
+		cooldownSource := ""
+		now := time.Now()
+		if resetAt, ok := core.GetRateLimitResetAt(err); ok {
+			cooldownUntil, cooldownSource = config.ConfigInstance.CooldownSessionAfterRateLimit(session.SessionKey, resetAt, now)
+		}
+		if cooldownSource == config.CooldownSourceOfficial {
+			errorMessage = fmt.Sprintf("rate limit exceeded - Claude official reset at: %s 中国时间", formatChinaTime(cooldownUntil))
+			logger.Error(fmt.Sprintf(
+				"Admin session test hit rate limit for S%d (%s); cooling down until %s (source: %s)",
+				sessionIdx+1,
+				maskSessionKey(session.SessionKey),
+				formatChinaTime(cooldownUntil),
+				cooldownSource,
+			))
+		} else {
+			errorMessage = "rate limit exceeded - Claude did not return a usable future reset time; session was not frozen"
+			logger.Error(fmt.Sprintf(
+				"Admin session test hit rate limit for S%d (%s) without usable official reset time; not freezing session",
+				sessionIdx+1,
+				maskSessionKey(session.SessionKey),
+			))
+		}
+	}
+	return errors.New(errorMessage)
 }
 
 func getSessionOrgID(session config.SessionInfo, sessionIdx int) string {
@@ -670,22 +758,38 @@ func getSessionOrgID(session config.SessionInfo, sessionIdx int) string {
 
 // UpdateConfigRequest represents the request body for updating config
 type UpdateConfigRequest struct {
-	MaxChatHistoryLength   *int                      `json:"max_chat_history_length"`
-	InternalRetryCount     *int                      `json:"internal_retry_count"`
-	MaxConcurrentPerKey    *int                      `json:"max_concurrent_per_key"`
-	MaxGlobalConcurrency   *int                      `json:"max_global_concurrency"`
-	ChatDelete             *bool                     `json:"chat_delete"`
-	NoRolePrefix           *bool                     `json:"no_role_prefix"`
-	PromptDisableArtifacts *bool                     `json:"prompt_disable_artifacts"`
-	EnableMirrorApi        *bool                     `json:"enable_mirror_api"`
-	MirrorApiPrefix        *string                   `json:"mirror_api_prefix"`
-	APIKey                 *string                   `json:"api_key"`
-	Proxy                  *string                   `json:"proxy"`
-	AdminPassword          *string                   `json:"admin_password"`
-	GlobalSystemPrompt     *string                   `json:"global_system_prompt_override"`
-	GlobalPromptMode       *string                   `json:"global_prompt_override_mode"`
-	ModelDefinitions       *[]config.ModelDefinition `json:"model_definitions"`
-	RequestLogRetention    *int                      `json:"request_log_retention"`
+	MaxChatHistoryLength   *int                              `json:"max_chat_history_length"`
+	InternalRetryCount     *int                              `json:"internal_retry_count"`
+	MaxConcurrentPerKey    *int                              `json:"max_concurrent_per_key"`
+	MaxGlobalConcurrency   *int                              `json:"max_global_concurrency"`
+	SessionStrategy        *string                           `json:"session_strategy"`
+	SessionAffinity        *config.SessionAffinityConfig     `json:"session_affinity"`
+	PredictiveRateLimit    *config.PredictiveRateLimitConfig `json:"predictive_rate_limit"`
+	AdaptiveConcurrency    *config.AdaptiveConcurrencyConfig `json:"adaptive_concurrency"`
+	CircuitBreaker         *config.CircuitBreakerConfig      `json:"circuit_breaker"`
+	HealthProbe            *config.HealthProbeConfig         `json:"health_probe"`
+	Notifications          *config.NotificationConfig        `json:"notifications"`
+	RuntimeState           *config.RuntimeStateConfig        `json:"runtime_state"`
+	Metrics                *config.MetricsConfig             `json:"metrics"`
+	Tracing                *config.TracingConfig             `json:"tracing"`
+	Heartbeat              *config.HeartbeatConfig           `json:"heartbeat"`
+	Upstream               *config.UpstreamConfig            `json:"upstream"`
+	Transcripts            *config.TranscriptConfig          `json:"transcripts"`
+	ChatDelete             *bool                             `json:"chat_delete"`
+	NoRolePrefix           *bool                             `json:"no_role_prefix"`
+	DiagnosticHeaders      *bool                             `json:"diagnostic_headers"`
+	PromptDisableArtifacts *bool                             `json:"prompt_disable_artifacts"`
+	EnableMirrorApi        *bool                             `json:"enable_mirror_api"`
+	MirrorApiPrefix        *string                           `json:"mirror_api_prefix"`
+	APIKey                 *string                           `json:"api_key"`
+	Proxy                  *string                           `json:"proxy"`
+	AdminPassword          *string                           `json:"admin_password"`
+	GlobalSystemPrompt     *string                           `json:"global_system_prompt_override"`
+	GlobalPromptMode       *string                           `json:"global_prompt_override_mode"`
+	ModelDefinitions       *[]config.ModelDefinition         `json:"model_definitions"`
+	RequestLogRetention    *int                              `json:"request_log_retention"`
+	RequestLogStorage      *config.RequestLogStorageConfig   `json:"request_log_storage"`
+	Logging                *config.LoggingConfig             `json:"logging"`
 }
 
 // AdminUpdateConfigHandler handles updating configuration
@@ -729,6 +833,81 @@ func AdminUpdateConfigHandler(c *gin.Context) {
 		config.ConfigInstance.MaxGlobalConcurrency = config.NormalizeMaxGlobalConcurrency(*req.MaxGlobalConcurrency)
 	}
 
+	if req.SessionStrategy != nil {
+		if !config.IsValidSessionStrategy(*req.SessionStrategy) {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Session strategy must be one of " + strings.Join(config.SessionStrategies(), ", ")})
+			return
+		}
+		config.ConfigInstance.SessionStrategy = config.NormalizeSessionStrategy(*req.SessionStrategy)
+	}
+
+	if req.SessionAffinity != nil {
+		affinity := *req.SessionAffinity
+		affinity.Header = strings.TrimSpace(affinity.Header)
+		affinity.TTLSeconds = int(config.NormalizeSessionAffinityTTL(affinity.TTLSeconds).Seconds())
+		config.ConfigInstance.SessionAffinity = affinity
+		if !affinity.Enabled {
+			config.ConfigInstance.ClearSessionAffinity("")
+		}
+	}
+
+	if req.PredictiveRateLimit != nil {
+		predictive := *req.PredictiveRateLimit
+		predictive.WindowMinutes = int(config.NormalizePredictiveWindow(predictive.WindowMinutes).Minutes())
+		predictive.Threshold = config.NormalizePredictiveThreshold(predictive.Threshold)
+		predictive.Mode = config.NormalizePredictiveMode(predictive.Mode)
+		config.ConfigInstance.PredictiveRateLimit = predictive
+	}
+
+	if req.AdaptiveConcurrency != nil {
+		config.ConfigInstance.AdaptiveConcurrency = config.NormalizeAdaptiveConcurrency(*req.AdaptiveConcurrency)
+		config.ConfigInstance.ResetSessionAdaptiveLimits()
+	}
+
+	if req.CircuitBreaker != nil {
+		config.ConfigInstance.CircuitBreaker = config.NormalizeCircuitBreaker(*req.CircuitBreaker)
+	}
+
+	if req.HealthProbe != nil {
+		config.ConfigInstance.HealthProbe = config.NormalizeHealthProbe(*req.HealthProbe)
+	}
+
+	if req.Notifications != nil {
+		config.ConfigInstance.Notifications = config.NormalizeNotification(notify.RestoreMaskedWebhooks(*req.Notifications, config.ConfigInstance.Notifications.Webhooks))
+	}
+
+	if req.RuntimeState != nil {
+		config.ConfigInstance.RuntimeState = config.NormalizeRuntimeState(*req.RuntimeState)
+	}
+
+	if req.Metrics != nil {
+		metricsSettings := config.NormalizeMetrics(*req.Metrics)
+		// The panel only sees the masked token; keep the stored one when it is echoed back.
+		if metricsSettings.Token != "" && metricsSettings.Token == maskAPIKey(config.ConfigInstance.Metrics.Token) {
+			metricsSettings.Token = config.ConfigInstance.Metrics.Token
+		}
+		config.ConfigInstance.Metrics = metricsSettings
+	}
+
+	if req.Tracing != nil {
+		config.ConfigInstance.Tracing = config.NormalizeTracing(*req.Tracing)
+		if err := tracing.Configure(config.ConfigInstance.Tracing); err != nil {
+			logger.Error(fmt.Sprintf("Failed to configure tracing: %v", err))
+		}
+	}
+
+	if req.Heartbeat != nil {
+		config.ConfigInstance.Heartbeat = config.NormalizeHeartbeat(*req.Heartbeat)
+	}
+
+	if req.Upstream != nil {
+		config.ConfigInstance.Upstream = config.NormalizeUpstream(*req.Upstream)
+	}
+
+	if req.Transcripts != nil {
+		config.ConfigInstance.Transcripts = config.NormalizeTranscripts(*req.Transcripts)
+	}
+
 	if req.ChatDelete != nil {
 		config.ConfigInstance.ChatDelete = *req.ChatDelete
 	}
@@ -737,6 +916,10 @@ func AdminUpdateConfigHandler(c *gin.Context) {
 		config.ConfigInstance.NoRolePrefix = *req.NoRolePrefix
 	}
 
+	if req.DiagnosticHeaders != nil {
+		config.ConfigInstance.DiagnosticHeaders = *req.DiagnosticHeaders
+	}
+
 	if req.PromptDisableArtifacts != nil {
 		config.ConfigInstance.PromptDisableArtifacts = *req.PromptDisableArtifacts
 	}
@@ -796,6 +979,25 @@ func AdminUpdateConfigHandler(c *gin.Context) {
 		logger.GlobalRequestLogger.SetMaxLogs(normalizedRetention)
 	}
 
+	if req.RequestLogStorage != nil {
+		config.ConfigInstance.RequestLogStorage = config.NormalizeRequestLogStorage(*req.RequestLogStorage)
+		if err := ConfigureRequestLogStorage(); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to open request log storage: " + err.Error()})
+			return
+		}
+	}
+
+	if req.Logging != nil {
+		loggingSettings := config.NormalizeLogging(*req.Logging)
+		if err := config.ApplyLogging(loggingSettings); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": "Failed to open log file: " + err.Error()})
+			return
+		}
+		config.ConfigInstance.Logging = loggingSettings
+	}
+
+	pruneClientPool()
+
 	// Try to save to config.yaml
 	if err := saveConfigToYAML(); err != nil {
 		logger.Error(fmt.Sprintf("Failed to save config to YAML: %v", err))
@@ -818,6 +1020,14 @@ func AdminUpdateConfigHandler(c *gin.Context) {
 }
 
 // maskAPIKey masks the API key for display
+func maskedMetricsConfig(settings config.MetricsConfig) config.MetricsConfig {
+	settings = config.NormalizeMetrics(settings)
+	if settings.Token != "" {
+		settings.Token = maskAPIKey(settings.Token)
+	}
+	return settings
+}
+
 func maskAPIKey(key string) string {
 	if len(key) <= 8 {
 		return "****"
@@ -851,19 +1061,102 @@ func formatChinaTime(t time.Time) string {
 	return t.In(location).Format("2006-01-02 15:04:05")
 }
 
+// AdminAffinityHandler lists the live end-user to session affinity table.
+func AdminAffinityHandler(c *gin.Context) {
+	now := time.Now()
+	entries := config.ConfigInstance.GetSessionAffinitySnapshot(now)
+	items := make([]gin.H, 0, len(entries))
+	for _, entry := range entries {
+		sessionLabel := "-"
+		if entry.SessionIndex >= 0 {
+			sessionLabel = fmt.Sprintf("S%d / %s", entry.SessionIndex+1, maskSessionKey(entry.SessionKey))
+		}
+		items = append(items, gin.H{
+			"affinity_key":  entry.AffinityKey,
+			"session_index": entry.SessionIndex,
+			"session_label": sessionLabel,
+			"bound_at":      formatChinaTime(entry.BoundAt),
+			"last_seen_at":  formatChinaTime(entry.LastSeenAt),
+			"expires_at":    formatChinaTime(entry.ExpiresAt),
+			"hits":          entry.Hits,
+		})
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"enabled": config.ConfigInstance.SessionAffinity.Enabled,
+		"ttl":     int(config.NormalizeSessionAffinityTTL(config.ConfigInstance.SessionAffinity.TTLSeconds).Seconds()),
+		"count":   len(items),
+		"entries": items,
+	})
+}
+
+// AdminClearAffinityHandler drops one affinity entry (?key=) or the whole table.
+func AdminClearAffinityHandler(c *gin.Context) {
+	removed := config.ConfigInstance.ClearSessionAffinity(c.Query("key"))
+	c.JSON(http.StatusOK, gin.H{
+		"status":  "cleared",
+		"removed": removed,
+	})
+}
+
 // AdminStatsHandler handles the stats endpoint
 func AdminStatsHandler(c *gin.Context) {
 	stats := logger.GlobalRequestLogger.GetStats()
 	c.JSON(http.StatusOK, stats)
 }
 
+// AdminStatsTimeseriesHandler returns per-minute request counters for charts, together
+// with a summary of the same window broken down by model, session and client key.
+func AdminStatsTimeseriesHandler(c *gin.Context) {
+	window, step, filter, err := parseSeriesQuery(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	now := time.Now()
+	c.JSON(http.StatusOK, gin.H{
+		"window_minutes": int(window / time.Minute),
+		"step_minutes":   int(step / time.Minute),
+		"points":         logger.GlobalRequestLogger.StatsSeries(now, window, step, filter),
+		"summary":        logger.GlobalRequestLogger.StatsWindow(now, window),
+	})
+}
+
 // AdminLogsHandler handles the logs endpoint
 // Supports both legacy limit parameter and new pagination parameters
 func AdminLogsHandler(c *gin.Context) {
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	// Check for pagination parameters
 	pageStr := c.Query("page")
 	pageSizeStr := c.Query("page_size")
 
+	if !filter.IsEmpty() {
+		page := 1
+		pageSize := 10
+		if pageStr != "" {
+			fmt.Sscanf(pageStr, "%d", &page)
+		}
+		if pageSizeStr != "" {
+			fmt.Sscanf(pageSizeStr, "%d", &pageSize)
+		}
+
+		logs, total, hasMore := logger.GlobalRequestLogger.QueryLogs(filter, page, pageSize)
+		c.JSON(http.StatusOK, gin.H{
+			"logs":      logs,
+			"page":      page,
+			"page_size": pageSize,
+			"total":     total,
+			"has_more":  hasMore,
+		})
+		return
+	}
+
 	if pageStr != "" || pageSizeStr != "" {
 		// Use pagination mode
 		page := 1
@@ -903,6 +1196,39 @@ func AdminLogsHandler(c *gin.Context) {
 	})
 }
 
+// AdminExportLogsHandler exports the logs matching the /admin-api/logs filters as CSV or JSONL.
+func AdminExportLogsHandler(c *gin.Context) {
+	format := c.Query("format")
+	if format == "" {
+		format = "csv"
+	}
+	if format != "csv" && format != "jsonl" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid format. Use 'csv' or 'jsonl'"})
+		return
+	}
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("request-logs-%s.%s", time.Now().Format("20060102-150405"), format)
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s", filename))
+	if format == "csv" {
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+	} else {
+		c.Header("Content-Type", "application/x-ndjson; charset=utf-8")
+	}
+	c.Status(http.StatusOK)
+
+	writeErr := writeLogExport(c.Writer, format, func(fn func(logger.RequestLog) bool) {
+		logger.GlobalRequestLogger.EachLog(filter, fn)
+	})
+	if writeErr != nil {
+		logger.Error(fmt.Sprintf("Failed to export request logs: %v", writeErr))
+	}
+}
+
 // AdminClearLogsHandler handles clearing logs
 func AdminClearLogsHandler(c *gin.Context) {
 	logger.GlobalRequestLogger.Clear()
@@ -922,7 +1248,22 @@ func buildAdminConfigResponse() gin.H {
 		"max_concurrent_per_key":        config.NormalizeMaxConcurrentPerKey(config.ConfigInstance.MaxConcurrentPerKey),
 		"max_global_concurrency":        config.NormalizeMaxGlobalConcurrency(config.ConfigInstance.MaxGlobalConcurrency),
 		"global_in_flight":              config.ConfigInstance.GetGlobalInFlight(),
+		"session_strategy":              config.NormalizeSessionStrategy(config.ConfigInstance.SessionStrategy),
+		"session_strategies":            config.SessionStrategies(),
+		"session_affinity":              config.ConfigInstance.SessionAffinity,
+		"predictive_rate_limit":         config.ConfigInstance.PredictiveRateLimit,
+		"adaptive_concurrency":          config.NormalizeAdaptiveConcurrency(config.ConfigInstance.AdaptiveConcurrency),
+		"circuit_breaker":               config.NormalizeCircuitBreaker(config.ConfigInstance.CircuitBreaker),
+		"health_probe":                  config.NormalizeHealthProbe(config.ConfigInstance.HealthProbe),
+		"notifications":                 maskedNotificationConfig(config.ConfigInstance.Notifications),
+		"runtime_state":                 config.NormalizeRuntimeState(config.ConfigInstance.RuntimeState),
+		"metrics":                       maskedMetricsConfig(config.ConfigInstance.Metrics),
+		"tracing":                       config.NormalizeTracing(config.ConfigInstance.Tracing),
+		"heartbeat":                     config.NormalizeHeartbeat(config.ConfigInstance.Heartbeat),
+		"upstream":                      config.NormalizeUpstream(config.ConfigInstance.Upstream),
+		"transcripts":                   config.NormalizeTranscripts(config.ConfigInstance.Transcripts),
 		"no_role_prefix":                config.ConfigInstance.NoRolePrefix,
+		"diagnostic_headers":            config.ConfigInstance.DiagnosticHeaders,
 		"prompt_disable_artifacts":      config.ConfigInstance.PromptDisableArtifacts,
 		"enable_mirror_api":             config.ConfigInstance.EnableMirrorApi,
 		"mirror_api_prefix":             config.ConfigInstance.MirrorApiPrefix,
@@ -933,6 +1274,8 @@ func buildAdminConfigResponse() gin.H {
 		"model_definition_count":        len(config.ConfigInstance.ModelDefinitions),
 		"model_definitions":             config.ConfigInstance.ModelDefinitions,
 		"request_log_retention":         config.ConfigInstance.RequestLogRetention,
+		"request_log_storage":           config.NormalizeRequestLogStorage(config.ConfigInstance.RequestLogStorage),
+		"logging":                       config.NormalizeLogging(config.ConfigInstance.Logging),
 	}
 }
 
@@ -957,7 +1300,21 @@ func saveConfigToYAML() error {
 		"internalRetryCount":         config.NormalizeInternalRetryCount(config.ConfigInstance.InternalRetryCount),
 		"maxConcurrentPerKey":        config.NormalizeMaxConcurrentPerKey(config.ConfigInstance.MaxConcurrentPerKey),
 		"maxGlobalConcurrency":       config.NormalizeMaxGlobalConcurrency(config.ConfigInstance.MaxGlobalConcurrency),
+		"sessionStrategy":            config.NormalizeSessionStrategy(config.ConfigInstance.SessionStrategy),
+		"sessionAffinity":            config.ConfigInstance.SessionAffinity,
+		"predictiveRateLimit":        config.ConfigInstance.PredictiveRateLimit,
+		"adaptiveConcurrency":        config.NormalizeAdaptiveConcurrency(config.ConfigInstance.AdaptiveConcurrency),
+		"circuitBreaker":             config.NormalizeCircuitBreaker(config.ConfigInstance.CircuitBreaker),
+		"healthProbe":                config.NormalizeHealthProbe(config.ConfigInstance.HealthProbe),
+		"notifications":              config.NormalizeNotification(config.ConfigInstance.Notifications),
+		"runtimeState":               config.NormalizeRuntimeState(config.ConfigInstance.RuntimeState),
+		"metrics":                    config.NormalizeMetrics(config.ConfigInstance.Metrics),
+		"tracing":                    config.NormalizeTracing(config.ConfigInstance.Tracing),
+		"heartbeat":                  config.NormalizeHeartbeat(config.ConfigInstance.Heartbeat),
+		"upstream":                   config.NormalizeUpstream(config.ConfigInstance.Upstream),
+		"transcripts":                config.NormalizeTranscripts(config.ConfigInstance.Transcripts),
 		"noRolePrefix":               config.ConfigInstance.NoRolePrefix,
+		"diagnosticHeaders":          config.ConfigInstance.DiagnosticHeaders,
 		"promptDisableArtifacts":     config.ConfigInstance.PromptDisableArtifacts,
 		"enableMirrorApi":            config.ConfigInstance.EnableMirrorApi,
 		"mirrorApiPrefix":            config.ConfigInstance.MirrorApiPrefix,
@@ -966,6 +1323,8 @@ func saveConfigToYAML() error {
 		"globalPromptOverrideMode":   normalizePromptMode(config.ConfigInstance.GlobalPromptOverrideMode),
 		"modelDefinitions":           config.ConfigInstance.ModelDefinitions,
 		"requestLogRetention":        config.ConfigInstance.RequestLogRetention,
+		"requestLogStorage":          config.NormalizeRequestLogStorage(config.ConfigInstance.RequestLogStorage),
+		"logging":                    config.NormalizeLogging(config.ConfigInstance.Logging),
 	}
 
 	// Marshal to YAML
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"claude2api/config"
+
+	"github.com/gin-gonic/gin"
+)
+
+// Opt-in response headers describing how a chat request was served.
+const (
+	diagnosticSessionHeader      = "X-Claude2API-Session"
+	diagnosticAttemptsHeader     = "X-Claude2API-Attempts"
+	diagnosticConversationHeader = "X-Claude2API-Conversation-ID"
+	diagnosticModelHeader        = "X-Claude2API-Upstream-Model"
+)
+
+// setDiagnosticHeader sets a diagnostic header when diagnosticHeaders is enabled. Headers
+// are only sent with the first write, so later attempts simply overwrite earlier values.
+func setDiagnosticHeader(c *gin.Context, name string, value string) {
+	if !config.ConfigInstance.DiagnosticHeaders || c.Writer.Written() {
+		return
+	}
+	c.Header(name, value)
+}
@@ -4,16 +4,48 @@ import (
 	"claude2api/config"
 	"claude2api/core"
 	"claude2api/logger"
+	"claude2api/metrics"
 	"claude2api/model"
 	"claude2api/utils"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
 	"fmt"
 	"net/http"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
 )
 
+// statusClientClosedRequest is logged for requests the client abandoned before the
+// response finished; nothing is sent back because the connection is already gone.
+const statusClientClosedRequest = 499
+
+// clientPool keeps each session's connections to claude.ai warm between requests.
+var clientPool = core.NewClientPool()
+
+// pooledClientOption pools only the transports of configured sessions; keys sent through
+// the mirror API or typed into the admin test are used once and never pooled.
+func pooledClientOption(sessionKey string) core.ClientOption {
+	for _, session := range config.ConfigInstance.Sessions {
+		if session.SessionKey == sessionKey {
+			return core.WithClientPool(clientPool)
+		}
+	}
+	return core.WithClientPool(nil)
+}
+
+// pruneClientPool drops the pooled transports of sessions that are no longer configured.
+func pruneClientPool() {
+	sessionKeys := make([]string, 0, len(config.ConfigInstance.Sessions))
+	for _, session := range config.ConfigInstance.Sessions {
+		sessionKeys = append(sessionKeys, session.SessionKey)
+	}
+	clientPool.Retain(sessionKeys)
+}
+
 type ErrorResponse struct {
 	Error string `json:"error"`
 }
@@ -45,6 +77,8 @@ func MoudlesHandler(c *gin.Context) {
 // ChatCompletionsHandler handles the chat completions endpoint
 func ChatCompletionsHandler(c *gin.Context) {
 	startTime := time.Now()
+	metrics.RequestStarted()
+	defer metrics.RequestFinished()
 
 	useMirror, exist := c.Get("UseMirrorApi")
 	if exist && useMirror.(bool) {
@@ -76,10 +110,12 @@ func ChatCompletionsHandler(c *gin.Context) {
 	if selectedModel.Thinking {
 		model += "-think"
 	}
+	setRequestLogField(c, "model", model)
+	setDiagnosticHeader(c, diagnosticModelHeader, selectedModel.UpstreamID)
 	sessionCount := len(config.ConfigInstance.Sessions)
 	if sessionCount == 0 {
 		lastError := "no Claude sessions configured"
-		logger.Error(lastError)
+		requestLogger(c).Error(lastError)
 		logRequest(c, model, -1, 0, 0, false, startTime, lastError)
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error: lastError,
@@ -97,10 +133,20 @@ func ChatCompletionsHandler(c *gin.Context) {
 		maxAttempts = sessionCount
 	}
 	attemptedIndices := make(map[int]bool, maxAttempts)
+	affinityKey := resolveAffinityKey(c, req)
+	// Once an attempt has streamed chunks to the client, another session's answer can no
+	// longer be spliced in, so the request ends with that attempt.
+	streamStarted := false
 
 	// Attempt with retry mechanism
-	for attemptedSessions < maxAttempts {
-		acquired := config.ConfigInstance.AcquireSessionLease(startIndex, attemptedIndices, time.Now())
+	for attemptedSessions < maxAttempts && !streamStarted {
+		acquired := config.ConfigInstance.AcquireSessionLeaseWith(config.SessionAcquireRequest{
+			StartIndex:  startIndex,
+			Excluded:    attemptedIndices,
+			Now:         time.Now(),
+			Strategy:    resolveSessionStrategy(selectedModel),
+			AffinityKey: affinityKey,
+		})
 		if !acquired.OK {
 			lastError = acquired.Reason
 			if !acquired.EarliestCooldown.IsZero() {
@@ -110,7 +156,10 @@ func ChatCompletionsHandler(c *gin.Context) {
 					lastError = fmt.Sprintf("%s; earliest cooldown until: %s 中国时间", lastError, formatChinaTime(acquired.EarliestCooldown))
 				}
 			}
-			logger.Info(fmt.Sprintf("No dispatchable Claude session: %s", lastError))
+			requestLogger(c).Info(fmt.Sprintf("No dispatchable Claude session: %s", lastError))
+			if acquired.BusyCount == 0 {
+				notifyPoolExhausted(lastError, acquired.EarliestCooldown)
+			}
 			break
 		}
 
@@ -120,61 +169,98 @@ func ChatCompletionsHandler(c *gin.Context) {
 		attemptedIndices[index] = true
 		lastSessionIdx = index
 		attemptedSessions++
+		setRequestLogField(c, "session_label", sessionEventLabel(index, session.SessionKey))
+		setDiagnosticHeader(c, diagnosticSessionHeader, sessionEventLabel(index, session.SessionKey))
+		setDiagnosticHeader(c, diagnosticAttemptsHeader, strconv.Itoa(attemptedSessions))
 
-		logger.Info(fmt.Sprintf("Using session for model %s (requested: %s): %s", model, selectedModel.RequestedModel, maskSessionKey(session.SessionKey)))
+		if acquired.AffinityHit {
+			requestLogger(c).Info(fmt.Sprintf("Affinity %s routed to session %d", affinityKey, index+1))
+		}
+		requestLogger(c).Info(fmt.Sprintf("Using session for model %s (requested: %s): %s", model, selectedModel.RequestedModel, maskSessionKey(session.SessionKey)))
 		if attemptedSessions > 1 {
 			processor.Prompt.Reset()
 			processor.Prompt.WriteString(processor.RootPrompt.String())
 		}
 		// Initialize client and process request
-		inputTokens, outputTokens, err := handleChatRequestWithTokens(c, session, model, processor, req.Stream, selectedModel.ThinkingMode, selectedModel.EffortLevel)
+		attemptSpan := startAttemptSpan(c, index, session.SessionKey, model, attemptedSessions)
+		lastAttempt := attemptedSessions >= maxAttempts
+		inputTokens, outputTokens, err := handleChatRequestWithTokens(c, index, session, model, processor, req.Stream, selectedModel.ThinkingMode, selectedModel.EffortLevel, selectedModel.Upstream, lastAttempt)
+		endAttemptSpan(c, attemptSpan, err)
 		if err == nil {
 			lease.Release()
+			config.ConfigInstance.RecordSessionSuccess(session.SessionKey, time.Now())
 			logRequest(c, model, index, inputTokens, outputTokens, true, startTime, "")
 			return // Success, exit the retry loop
 		}
 
+		if core.IsClientCancelledError(err) {
+			// The client went away: the session did nothing wrong and there is nobody to retry for.
+			lease.Release()
+			logRequest(c, model, index, inputTokens, outputTokens, false, startTime, core.GetErrorMessage(err))
+			return
+		}
+
 		lastError = core.GetErrorMessage(err)
+		streamStarted = req.Stream && c.Writer.Written()
+		if core.IsAuthError(err) {
+			lastFailureWasRateLimit = false
+			if until, quarantined := config.ConfigInstance.RecordSessionAuthFailure(session.SessionKey, lastError, time.Now()); quarantined {
+				requestLogger(c).Error(fmt.Sprintf("Session %d (%s) quarantined after authentication failures until %s", index+1, maskSessionKey(session.SessionKey), formatChinaTime(until)))
+				notifySessionQuarantined(index, session.SessionKey, until, lastError)
+			}
+			lease.Release()
+			// A dead key says nothing about the request, so it does not use up the retry budget.
+			if maxAttempts < sessionCount {
+				maxAttempts++
+			}
+			if !streamStarted {
+				requestLogger(c).Info(fmt.Sprintf("Retrying another session after authentication failure on session %d", index+1))
+			}
+			continue
+		}
 		rateLimited := core.IsRateLimitError(err)
 		lastFailureWasRateLimit = rateLimited
 		if rateLimited {
 			cooldownUntil := time.Time{}
 			cooldownSource := ""
 			now := time.Now()
+			config.ConfigInstance.RecordSessionRateLimit(session.SessionKey, now)
 			if resetAt, ok := core.GetRateLimitResetAt(err); ok {
 				cooldownUntil, cooldownSource = config.ConfigInstance.CooldownSessionAfterRateLimit(session.SessionKey, resetAt, now)
 			}
 			if cooldownSource == config.CooldownSourceOfficial {
 				lastError = fmt.Sprintf("rate limit exceeded - Claude official reset at: %s 中国时间", formatChinaTime(cooldownUntil))
-				logger.Error(fmt.Sprintf(
+				requestLogger(c).Error(fmt.Sprintf(
 					"Session %d (%s) hit rate limit; cooling down until %s (source: %s)",
 					index+1,
 					maskSessionKey(session.SessionKey),
 					formatChinaTime(cooldownUntil),
 					cooldownSource,
 				))
+				notifyCooldownSet(index, session.SessionKey, cooldownUntil, "rate limit exceeded")
 			} else {
 				lastError = "rate limit exceeded - Claude did not return a usable future reset time; session was not frozen"
-				logger.Error(fmt.Sprintf(
+				requestLogger(c).Error(fmt.Sprintf(
 					"Session %d (%s) hit rate limit without usable official reset time; not freezing session",
 					index+1,
 					maskSessionKey(session.SessionKey),
 				))
 			}
 			lease.Release()
-			if attemptedSessions < maxAttempts {
-				logger.Info("Retrying another session after rate limit")
+			if attemptedSessions < maxAttempts && !streamStarted {
+				requestLogger(c).Info("Retrying another session after rate limit")
 				continue
 			}
 			break
 		}
 		lease.Release()
 		if !core.IsRetryableError(err) {
-			logger.Error(fmt.Sprintf("Request failed with non-retryable error on session %d: %s", index+1, lastError))
+			requestLogger(c).Error(fmt.Sprintf("Request failed with non-retryable error on session %d: %s", index+1, lastError))
 			break
 		}
-		if attemptedSessions < maxAttempts {
-			logger.Info(fmt.Sprintf("Retrying another session after retryable error: %s", lastError))
+		config.ConfigInstance.RecordSessionFailure(session.SessionKey)
+		if attemptedSessions < maxAttempts && !streamStarted {
+			requestLogger(c).Info(fmt.Sprintf("Retrying another session after retryable error: %s", lastError))
 		}
 	}
 
@@ -184,24 +270,42 @@ func ChatCompletionsHandler(c *gin.Context) {
 			lastError = "no dispatchable Claude sessions"
 		}
 		statusCode = http.StatusTooManyRequests
-		logger.Error(lastError)
+		requestLogger(c).Error(lastError)
 	} else if attemptedSessions > 1 {
 		if lastFailureWasRateLimit {
 			statusCode = http.StatusTooManyRequests
 		}
-		logger.Error(fmt.Sprintf("Failed after %d attempts", attemptedSessions))
+		requestLogger(c).Error(fmt.Sprintf("Failed after %d attempts", attemptedSessions))
 	} else {
 		if lastFailureWasRateLimit {
 			statusCode = http.StatusTooManyRequests
 		}
-		logger.Error("Request failed")
+		requestLogger(c).Error("Request failed")
 	}
+	setDiagnosticHeader(c, diagnosticAttemptsHeader, strconv.Itoa(attemptedSessions))
 	logRequest(c, model, lastSessionIdx, 0, 0, false, startTime, lastError)
+	if streamStarted {
+		writeStreamError(c, lastError)
+		return
+	}
 	c.JSON(statusCode, ErrorResponse{
 		Error: lastError,
 	})
 }
 
+// writeStreamError ends a stream that has already sent its status and chunks: the error
+// goes out as a final SSE chunk, followed by the usual end marker.
+func writeStreamError(c *gin.Context, message string) {
+	data, err := json.Marshal(ErrorResponse{Error: message})
+	if err != nil {
+		requestLogger(c).Error(fmt.Sprintf("Error marshalling stream error: %v", err))
+		return
+	}
+	c.Writer.Write([]byte("data: " + string(data) + "\n\n"))
+	c.Writer.Write([]byte("data: [DONE]\n\n"))
+	c.Writer.Flush()
+}
+
 func MirrorChatHandler(c *gin.Context) {
 	if !config.ConfigInstance.EnableMirrorApi {
 		c.JSON(http.StatusForbidden, ErrorResponse{
@@ -244,7 +348,7 @@ func MirrorChatHandler(c *gin.Context) {
 	}
 
 	// Process the request with the provided session
-	if err := handleChatRequest(c, session, model, processor, req.Stream, selectedModel.ThinkingMode, selectedModel.EffortLevel); err != nil {
+	if err := handleChatRequest(c, session, model, processor, req.Stream, selectedModel.ThinkingMode, selectedModel.EffortLevel, selectedModel.Upstream); err != nil {
 		c.JSON(http.StatusInternalServerError, ErrorResponse{
 			Error: core.GetErrorMessage(err),
 		})
@@ -385,25 +489,84 @@ func resolvePromptOverride(selectedModel ResolvedModelSelection) (string, string
 	return "", "append"
 }
 
-func handleChatRequest(c *gin.Context, session config.SessionInfo, model string, processor *utils.ChatRequestProcessor, stream bool, thinkingMode string, effortLevel string) error {
-	_, _, err := handleChatRequestWithTokens(c, session, model, processor, stream, thinkingMode, effortLevel)
+// resolveSessionStrategy prefers the model group's strategy over the global one.
+func resolveSessionStrategy(selectedModel ResolvedModelSelection) string {
+	if strings.TrimSpace(selectedModel.SessionStrategy) != "" {
+		return config.NormalizeSessionStrategy(selectedModel.SessionStrategy)
+	}
+	return config.NormalizeSessionStrategy(config.ConfigInstance.SessionStrategy)
+}
+
+// getClientKey returns the API key the caller authenticated with.
+func getClientKey(c *gin.Context) string {
+	return strings.TrimSpace(strings.TrimPrefix(c.GetHeader("Authorization"), "Bearer "))
+}
+
+// resolveAffinityKey hashes the client key with the end-user identity taken from the
+// configured header or the OpenAI "user" field. Requests without an identity get no affinity.
+func resolveAffinityKey(c *gin.Context, req *model.ChatCompletionRequest) string {
+	settings := config.ConfigInstance.SessionAffinity
+	if !settings.Enabled {
+		return ""
+	}
+	identity := ""
+	if header := strings.TrimSpace(settings.Header); header != "" {
+		identity = strings.TrimSpace(c.GetHeader(header))
+	}
+	if identity == "" && req != nil {
+		identity = strings.TrimSpace(req.User)
+	}
+	if identity == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(getClientKey(c) + "\x00" + identity))
+	return hex.EncodeToString(sum[:8])
+}
+
+func handleChatRequest(c *gin.Context, session config.SessionInfo, model string, processor *utils.ChatRequestProcessor, stream bool, thinkingMode string, effortLevel string, upstream config.UpstreamConfig) error {
+	// The mirror's session comes from the caller, not from the configured pool.
+	_, _, err := handleChatRequestWithTokens(c, -1, session, model, processor, stream, thinkingMode, effortLevel, upstream, true)
 	return err
 }
 
-// handleChatRequestWithTokens handles the chat request and returns token counts
-func handleChatRequestWithTokens(c *gin.Context, session config.SessionInfo, model string, processor *utils.ChatRequestProcessor, stream bool, thinkingMode string, effortLevel string) (int, int, error) {
+// handleChatRequestWithTokens handles the chat request and returns token counts. The
+// non-stream heartbeat commits a 200 status, so it only runs on the lastAttempt; earlier
+// attempts must leave the response untouched for the retry loop to answer.
+func handleChatRequestWithTokens(c *gin.Context, index int, session config.SessionInfo, model string, processor *utils.ChatRequestProcessor, stream bool, thinkingMode string, effortLevel string, upstream config.UpstreamConfig, lastAttempt bool) (int, int, error) {
+	// Stage timings of this attempt replace those of earlier attempts
+	timings := &logger.StageTimings{}
+	c.Set("stage_timings", timings)
+
+	heartbeatInterval := time.Duration(0)
+	heartbeat := config.ConfigInstance.Heartbeat
+	if heartbeat.Enabled {
+		heartbeatInterval = time.Duration(config.NormalizeHeartbeat(heartbeat).IntervalSeconds) * time.Second
+	}
+
 	// Initialize the Claude client
-	claudeClient := core.NewClientFromSession(session, config.ConfigInstance.Proxy, model, core.WithThinkingOptions(thinkingMode, effortLevel))
+	claudeClient := core.NewClientFromSession(session, config.ConfigInstance.Proxy, model,
+		core.WithThinkingOptions(thinkingMode, effortLevel),
+		core.WithMessageLimitHandler(newSessionQuotaRecorder(index, session.SessionKey, requestLogger(c))),
+		core.WithFirstTokenHandler(func() { c.Set("first_token_at", time.Now()) }),
+		core.WithUpstreamStatusHandler(metrics.ObserveUpstreamStatus),
+		core.WithContext(traceContext(c)),
+		core.WithStageHandler(timings.Record),
+		core.WithLogEntry(requestLogger(c)),
+		core.WithHeartbeat(heartbeatInterval, heartbeat.NonStream && lastAttempt),
+		upstreamClientOption(upstream),
+		transcriptClientOption(),
+		pooledClientOption(session.SessionKey),
+	)
 
 	// Get org ID if not already set
 	if session.OrgID == "" {
 		orgId, err := claudeClient.GetOrgID()
 		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to get org ID: %v", err))
+			requestLogger(c).Error(fmt.Sprintf("Failed to get org ID: %v", err))
 			return 0, 0, fmt.Errorf("failed to get org ID: %w", err)
 		}
 		session.OrgID = orgId
-		config.ConfigInstance.SetSessionOrgID(session.SessionKey, session.OrgID)
+		config.ConfigInstance.SetSessionOrgID(session.SessionKey, session.OrgID, requestLogger(c))
 	}
 
 	claudeClient.SetOrgID(session.OrgID)
@@ -412,7 +575,7 @@ func handleChatRequestWithTokens(c *gin.Context, session config.SessionInfo, mod
 	if len(processor.ImgDataList) > 0 {
 		err := claudeClient.UploadFile(processor.ImgDataList)
 		if err != nil {
-			logger.Error(fmt.Sprintf("Failed to upload file: %v", err))
+			requestLogger(c).Error(fmt.Sprintf("Failed to upload file: %v", err))
 			return 0, 0, fmt.Errorf("failed to upload file: %w", err)
 		}
 	}
@@ -421,20 +584,29 @@ func handleChatRequestWithTokens(c *gin.Context, session config.SessionInfo, mod
 	if processor.Prompt.Len() > config.ConfigInstance.MaxChatHistoryLength {
 		claudeClient.SetBigContext(processor.Prompt.String())
 		processor.ResetForBigContext()
-		logger.Info(fmt.Sprintf("Prompt length exceeds max limit (%d), using file context", config.ConfigInstance.MaxChatHistoryLength))
+		requestLogger(c).Info(fmt.Sprintf("Prompt length exceeds max limit (%d), using file context", config.ConfigInstance.MaxChatHistoryLength))
 	}
 
 	// Create conversation
 	conversationID, err := claudeClient.CreateConversation()
 	if err != nil {
-		logger.Error(fmt.Sprintf("Failed to create conversation: %v", err))
+		requestLogger(c).Error(fmt.Sprintf("Failed to create conversation: %v", err))
 		return 0, 0, err
 	}
+	setDiagnosticHeader(c, diagnosticConversationHeader, conversationID)
 
 	// Send message
 	tokenInfo, err := claudeClient.SendMessage(conversationID, processor.Prompt.String(), stream, c)
+	if core.IsClientCancelledError(err) {
+		requestLogger(c).Info("Client disconnected, stopped Claude generation")
+		go cleanupConversation(claudeClient, conversationID, 3)
+		if tokenInfo == nil {
+			return 0, 0, err
+		}
+		return tokenInfo.InputTokens, tokenInfo.OutputTokens, err
+	}
 	if err != nil {
-		logger.Error(fmt.Sprintf("Failed to send message: %v", err))
+		requestLogger(c).Error(fmt.Sprintf("Failed to send message: %v", err))
 		go cleanupConversation(claudeClient, conversationID, 3)
 		return 0, 0, err
 	}
@@ -454,6 +626,42 @@ func handleChatRequestWithTokens(c *gin.Context, session config.SessionInfo, mod
 	return inputTokens, outputTokens, nil
 }
 
+// newSessionQuotaRecorder stores message_limit updates from the stream on the session,
+// cooling it down ahead of time when Claude reports the quota as used up.
+func newSessionQuotaRecorder(index int, sessionKey string, log *logger.Entry) func(core.MessageLimit) {
+	return func(limit core.MessageLimit) {
+		quota := config.SessionQuota{
+			Type:        limit.Type,
+			Remaining:   limit.Remaining,
+			ResetsAt:    limit.ResetsAt,
+			Utilization: limit.MaxUtilization(),
+		}
+		if until, ok := config.ConfigInstance.UpdateSessionQuota(sessionKey, quota, time.Now()); ok {
+			log.Info(fmt.Sprintf("Session %s reported %s; cooling down until %s", sessionEventLabel(index, sessionKey), limit.Type, formatChinaTime(until)))
+			notifyCooldownSet(index, sessionKey, until, "message_limit reported "+limit.Type)
+		}
+	}
+}
+
+// upstreamClientOption applies resolved upstream settings, global or per model, to a client.
+func upstreamClientOption(upstream config.UpstreamConfig) core.ClientOption {
+	upstream = config.NormalizeUpstream(upstream)
+	return core.WithUpstream(
+		upstream.BaseURL,
+		time.Duration(upstream.TimeoutSeconds)*time.Second,
+		time.Duration(upstream.ResponseHeaderTimeoutSeconds)*time.Second,
+	)
+}
+
+// transcriptClientOption turns on stream recording when transcripts are enabled.
+func transcriptClientOption() core.ClientOption {
+	transcripts := config.ConfigInstance.Transcripts
+	if !transcripts.Enabled {
+		return core.WithTranscriptRecording("")
+	}
+	return core.WithTranscriptRecording(config.NormalizeTranscripts(transcripts).Dir)
+}
+
 func cleanupConversation(client *core.Client, conversationID string, retry int) {
 	for i := 0; i < retry; i++ {
 		if err := client.DeleteConversation(conversationID); err != nil {
@@ -471,17 +679,40 @@ func cleanupConversation(client *core.Client, conversationID string, retry int)
 // logRequest logs the request to the global request logger
 // logRequest logs the request to the global request logger
 func logRequest(c *gin.Context, model string, sessionIdx int, inputTokens int, outputTokens int, success bool, startTime time.Time, errMsg string) {
-	duration := time.Since(startTime).Milliseconds()
+	log := newRequestLog(model, sessionIdx, inputTokens, outputTokens, success, startTime, errMsg)
+
+	if rawMessages, exists := c.Get("request_message_count"); exists {
+		if count, ok := rawMessages.(int); ok {
+			log.ContextCount = count
+		}
+	}
 
+	if firstTokenAt := c.GetTime("first_token_at"); !firstTokenAt.IsZero() {
+		log.TTFTMs = firstTokenAt.Sub(startTime).Milliseconds()
+	}
+
+	if rawTimings, exists := c.Get("stage_timings"); exists {
+		if timings, ok := rawTimings.(*logger.StageTimings); ok && !timings.IsZero() {
+			log.Stages = timings
+		}
+	}
+
+	log.RequestID = c.GetString("request_id")
+	log.Method = c.Request.Method
+	log.Path = c.Request.URL.Path
+	log.ClientKey = config.MaskSecret(getClientKey(c))
+	log.IsStreaming = c.Query("stream") == "true" || c.GetBool("stream")
+	recordRequestLog(log)
+}
+
+// newRequestLog fills in the fields of a request log that do not depend on an HTTP request.
+func newRequestLog(model string, sessionIdx int, inputTokens int, outputTokens int, success bool, startTime time.Time, errMsg string) logger.RequestLog {
+	errorType := logger.ClassifyErrorType(errMsg)
 	statusCode := http.StatusOK
 	if !success {
 		statusCode = http.StatusInternalServerError
-	}
-
-	contextCount := 0
-	if rawMessages, exists := c.Get("request_message_count"); exists {
-		if count, ok := rawMessages.(int); ok {
-			contextCount = count
+		if errorType == logger.ErrorTypeClientCancelled {
+			statusCode = statusClientClosedRequest
 		}
 	}
 
@@ -494,44 +725,22 @@ func logRequest(c *gin.Context, model string, sessionIdx int, inputTokens int, o
 		sessionLabel = fmt.Sprintf("S%d / %s", sessionIdx+1, maskSessionKey(config.ConfigInstance.Sessions[sessionIdx].SessionKey))
 	}
 
-	log := logger.RequestLog{
+	return logger.RequestLog{
 		Timestamp:    startTime,
-		Method:       c.Request.Method,
-		Path:         c.Request.URL.Path,
 		Model:        model,
 		StatusCode:   statusCode,
-		Duration:     duration,
+		Duration:     time.Since(startTime).Milliseconds(),
 		Success:      success,
 		Error:        errMsg,
-		ErrorType:    classifyErrorType(errMsg),
+		ErrorType:    errorType,
 		SessionIdx:   sessionIdx,
 		SessionLabel: sessionLabel,
-		IsStreaming:  c.Query("stream") == "true" || c.GetBool("stream"),
-		ContextCount: contextCount,
 		InputTokens:  inputTokens,
 		OutputTokens: outputTokens,
 	}
-
-	logger.GlobalRequestLogger.LogRequest(log)
 }
 
-func classifyErrorType(errMsg string) string {
-	if errMsg == "" {
-		return ""
-	}
-
-	lowerErr := strings.ToLower(errMsg)
-
-	switch {
-	case strings.Contains(lowerErr, "invalid request") || strings.Contains(lowerErr, "bind") || strings.Contains(lowerErr, "parse"):
-		return "请求解析失败"
-	case strings.Contains(lowerErr, "rate limit") || strings.Contains(lowerErr, "429") || strings.Contains(lowerErr, "retry-after"):
-		return "限流"
-	case strings.Contains(lowerErr, "auth") || strings.Contains(lowerErr, "unauthorized") || strings.Contains(lowerErr, "forbidden") || strings.Contains(lowerErr, "api key"):
-		return "认证失败"
-	case strings.Contains(lowerErr, "claude") || strings.Contains(lowerErr, "conversation") || strings.Contains(lowerErr, "send message"):
-		return "Claude 接口错误"
-	default:
-		return "未知错误"
-	}
+func recordRequestLog(log logger.RequestLog) {
+	logger.GlobalRequestLogger.LogRequest(log)
+	metrics.ObserveRequest(log)
 }
@@ -0,0 +1,108 @@
+package service
+
+import (
+	"claude2api/config"
+	"claude2api/fakeupstream"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func useChatTestConfig(t *testing.T, baseURL string, heartbeat config.HeartbeatConfig) {
+	t.Helper()
+	previous, previousSr := config.ConfigInstance, config.Sr
+	config.ConfigInstance = &config.Config{
+		Sessions:             []config.SessionInfo{{SessionKey: "sk-a"}, {SessionKey: "sk-b"}},
+		InternalRetryCount:   2,
+		MaxChatHistoryLength: 100000,
+		MaxConcurrentPerKey:  1,
+		MaxGlobalConcurrency: 10,
+		SessionStrategy:      "round_robin",
+		Upstream:             config.UpstreamConfig{BaseURL: baseURL, TimeoutSeconds: 10, ResponseHeaderTimeoutSeconds: 10},
+		Heartbeat:            heartbeat,
+	}
+	config.Sr = &config.SessionRagen{}
+	t.Cleanup(func() {
+		config.ConfigInstance, config.Sr = previous, previousSr
+	})
+}
+
+func postChatCompletion(body string) *httptest.ResponseRecorder {
+	gin.SetMode(gin.TestMode)
+	recorder := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(recorder)
+	c.Request = httptest.NewRequest(http.MethodPost, "/v1/chat/completions", strings.NewReader(body))
+	c.Request.Header.Set("Content-Type", "application/json")
+	ChatCompletionsHandler(c)
+	return recorder
+}
+
+func TestNonStreamHeartbeatWaitsForTheLastAttempt(t *testing.T) {
+	// sk-a breaks off its answer after more than one heartbeat interval, sk-b is rate limited.
+	fake := fakeupstream.New(fakeupstream.Options{
+		ChunkDelay: 600 * time.Millisecond,
+		Scripts: map[string][]string{
+			"sk-a": {fakeupstream.ScenarioStreamAbort},
+			"sk-b": {fakeupstream.ScenarioRateLimit},
+		},
+	})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	useChatTestConfig(t, server.URL, config.HeartbeatConfig{Enabled: true, IntervalSeconds: 1, NonStream: true})
+
+	recorder := postChatCompletion(`{"model":"claude-sonnet-4-6","messages":[{"role":"user","content":"hi"}]}`)
+	if recorder.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the retry's rate limit status, got %d: %q", recorder.Code, recorder.Body.String())
+	}
+	if strings.HasPrefix(recorder.Body.String(), "\n") {
+		t.Fatalf("expected no keepalive from the first attempt, got %q", recorder.Body.String())
+	}
+	if stats := fake.Stats(); stats.Completions != 2 {
+		t.Fatalf("expected both sessions to be tried, got %+v", stats)
+	}
+}
+
+func TestStreamErrorIsRetriedOnAnotherSession(t *testing.T) {
+	fake := fakeupstream.New(fakeupstream.Options{Scripts: map[string][]string{
+		"sk-a": {fakeupstream.ScenarioStreamError},
+		"sk-b": {fakeupstream.ScenarioText},
+	}})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	useChatTestConfig(t, server.URL, config.HeartbeatConfig{})
+
+	recorder := postChatCompletion(`{"model":"claude-sonnet-4-6","messages":[{"role":"user","content":"hi"}]}`)
+	body := recorder.Body.String()
+	if recorder.Code != http.StatusOK || !strings.Contains(body, "fake upstream") {
+		t.Fatalf("expected sk-b to answer, got %d: %q", recorder.Code, body)
+	}
+	if strings.Contains(body, "Overloaded") {
+		t.Fatalf("expected the stream error to stay out of the answer, got %q", body)
+	}
+}
+
+func TestStreamErrorAfterChunksEndsTheStream(t *testing.T) {
+	fake := fakeupstream.New(fakeupstream.Options{Scripts: map[string][]string{
+		"sk-a": {fakeupstream.ScenarioStreamError},
+		"sk-b": {fakeupstream.ScenarioText},
+	}})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	useChatTestConfig(t, server.URL, config.HeartbeatConfig{})
+
+	recorder := postChatCompletion(`{"model":"claude-sonnet-4-6","stream":true,"messages":[{"role":"user","content":"hi"}]}`)
+	body := recorder.Body.String()
+	if !strings.Contains(body, "This answer will not ") || strings.Contains(body, "fake upstream") {
+		t.Fatalf("expected only sk-a's partial answer, got %q", body)
+	}
+	if !strings.Contains(body, "data: {\"error\":") || !strings.HasSuffix(body, "Overloaded\"}\n\ndata: [DONE]\n\n") {
+		t.Fatalf("expected the error as a final SSE chunk, got %q", body)
+	}
+	if stats := fake.Stats(); stats.Completions != 1 {
+		t.Fatalf("expected no retry after streaming, got %+v", stats)
+	}
+}
@@ -0,0 +1,25 @@
+package service
+
+import (
+	"claude2api/logger"
+
+	"github.com/gin-gonic/gin"
+)
+
+const logEntryKey = "log_entry"
+
+// requestLogger returns the log entry carrying the request's fields, such as request_id,
+// model and session_label, so its log lines can be correlated.
+func requestLogger(c *gin.Context) *logger.Entry {
+	if value, ok := c.Get(logEntryKey); ok {
+		if entry, ok := value.(*logger.Entry); ok {
+			return entry
+		}
+	}
+	return logger.WithFields(nil).WithField("request_id", c.GetString("request_id"))
+}
+
+// setRequestLogField adds a field to every later log line of the request.
+func setRequestLogField(c *gin.Context, key string, value interface{}) {
+	c.Set(logEntryKey, requestLogger(c).WithField(key, value))
+}
@@ -0,0 +1,205 @@
+package service
+
+import (
+	"claude2api/config"
+	"claude2api/logger"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+var logExportColumns = []string{
+	"timestamp", "method", "path", "model", "status_code", "duration_ms", "ttft_ms", "success",
+	"error_type", "error", "session_idx", "session_label", "client_key", "is_streaming",
+	"context_count", "input_tokens", "output_tokens", "org_lookup_ms", "settings_ms",
+	"conversation_ms", "upload_ms", "first_byte_ms", "first_token_ms", "stream_ms",
+	"request_id",
+}
+
+// parseLogFilter reads the log filters from the query string:
+// start, end (RFC3339 or unix seconds), model, session_idx, success, error_type,
+// streaming, client_key, min_duration_ms, request_id and q (error text search).
+func parseLogFilter(c *gin.Context) (logger.LogFilter, error) {
+	filter := logger.LogFilter{
+		Model:     strings.TrimSpace(c.Query("model")),
+		ErrorType: strings.TrimSpace(c.Query("error_type")),
+		RequestID: strings.TrimSpace(c.Query("request_id")),
+		Search:    strings.TrimSpace(c.Query("q")),
+	}
+
+	var err error
+	if filter.Start, err = parseLogTime(c.Query("start")); err != nil {
+		return filter, fmt.Errorf("invalid start: %v", err)
+	}
+	if filter.End, err = parseLogTime(c.Query("end")); err != nil {
+		return filter, fmt.Errorf("invalid end: %v", err)
+	}
+	if raw := strings.TrimSpace(c.Query("session_idx")); raw != "" {
+		idx, err := strconv.Atoi(raw)
+		if err != nil {
+			return filter, fmt.Errorf("invalid session_idx: %s", raw)
+		}
+		filter.SessionIdx = &idx
+	}
+	if filter.Success, err = parseOptionalBool(c.Query("success")); err != nil {
+		return filter, fmt.Errorf("invalid success: %v", err)
+	}
+	if filter.Streaming, err = parseOptionalBool(c.Query("streaming")); err != nil {
+		return filter, fmt.Errorf("invalid streaming: %v", err)
+	}
+	if raw := strings.TrimSpace(c.Query("min_duration_ms")); raw != "" {
+		if filter.MinDuration, err = strconv.ParseInt(raw, 10, 64); err != nil {
+			return filter, fmt.Errorf("invalid min_duration_ms: %s", raw)
+		}
+	}
+	if clientKey := strings.TrimSpace(c.Query("client_key")); clientKey != "" {
+		// Logs only keep the masked key, so a full key is masked the same way.
+		if !strings.Contains(clientKey, "...") && clientKey != "****" {
+			clientKey = config.MaskSecret(clientKey)
+		}
+		filter.ClientKey = clientKey
+	}
+	return filter, nil
+}
+
+// parseSeriesQuery reads the /admin-api/stats/timeseries parameters: window and step in
+// minutes, and at most one of model, session_idx and client_key.
+func parseSeriesQuery(c *gin.Context) (time.Duration, time.Duration, logger.SeriesFilter, error) {
+	filter := logger.SeriesFilter{Model: strings.TrimSpace(c.Query("model"))}
+	windowMinutes, err := parsePositiveMinutes(c.Query("window"), 60, 24*60)
+	if err != nil {
+		return 0, 0, filter, fmt.Errorf("invalid window: %v", err)
+	}
+	// Default to at most about 100 points so long windows stay chartable.
+	defaultStep := (windowMinutes + 99) / 100
+	stepMinutes, err := parsePositiveMinutes(c.Query("step"), defaultStep, windowMinutes)
+	if err != nil {
+		return 0, 0, filter, fmt.Errorf("invalid step: %v", err)
+	}
+
+	dimensions := 0
+	if filter.Model != "" {
+		dimensions++
+	}
+	if raw := strings.TrimSpace(c.Query("session_idx")); raw != "" {
+		idx, err := strconv.Atoi(raw)
+		if err != nil {
+			return 0, 0, filter, fmt.Errorf("invalid session_idx: %s", raw)
+		}
+		filter.SessionIdx = &idx
+		dimensions++
+	}
+	if clientKey := strings.TrimSpace(c.Query("client_key")); clientKey != "" {
+		if !strings.Contains(clientKey, "...") && clientKey != "****" {
+			clientKey = config.MaskSecret(clientKey)
+		}
+		filter.ClientKey = clientKey
+		dimensions++
+	}
+	if dimensions > 1 {
+		return 0, 0, filter, fmt.Errorf("only one of model, session_idx and client_key can be set")
+	}
+	return time.Duration(windowMinutes) * time.Minute, time.Duration(stepMinutes) * time.Minute, filter, nil
+}
+
+// parsePositiveMinutes parses a minute count, using fallback when empty and capping at max.
+func parsePositiveMinutes(raw string, fallback int, max int) (int, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return fallback, nil
+	}
+	minutes, err := strconv.Atoi(raw)
+	if err != nil || minutes < 1 {
+		return 0, fmt.Errorf("%q is not a positive number of minutes", raw)
+	}
+	if minutes > max {
+		minutes = max
+	}
+	return minutes, nil
+}
+
+func parseLogTime(raw string) (time.Time, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return time.Time{}, nil
+	}
+	if seconds, err := strconv.ParseInt(raw, 10, 64); err == nil {
+		return time.Unix(seconds, 0), nil
+	}
+	return time.Parse(time.RFC3339, raw)
+}
+
+func parseOptionalBool(raw string) (*bool, error) {
+	raw = strings.TrimSpace(raw)
+	if raw == "" {
+		return nil, nil
+	}
+	value, err := strconv.ParseBool(raw)
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+// writeLogExport streams the logs produced by each as CSV or JSONL.
+func writeLogExport(w io.Writer, format string, each func(func(logger.RequestLog) bool)) error {
+	var writeErr error
+	if format == "jsonl" {
+		encoder := json.NewEncoder(w)
+		each(func(log logger.RequestLog) bool {
+			writeErr = encoder.Encode(log)
+			return writeErr == nil
+		})
+		return writeErr
+	}
+
+	writer := csv.NewWriter(w)
+	if err := writer.Write(logExportColumns); err != nil {
+		return err
+	}
+	each(func(log logger.RequestLog) bool {
+		stages := logger.StageTimings{}
+		if log.Stages != nil {
+			stages = *log.Stages
+		}
+		writeErr = writer.Write([]string{
+			log.Timestamp.Format(time.RFC3339),
+			log.Method,
+			log.Path,
+			log.Model,
+			strconv.Itoa(log.StatusCode),
+			strconv.FormatInt(log.Duration, 10),
+			strconv.FormatInt(log.TTFTMs, 10),
+			strconv.FormatBool(log.Success),
+			log.ErrorType,
+			log.Error,
+			strconv.Itoa(log.SessionIdx),
+			log.SessionLabel,
+			log.ClientKey,
+			strconv.FormatBool(log.IsStreaming),
+			strconv.Itoa(log.ContextCount),
+			strconv.Itoa(log.InputTokens),
+			strconv.Itoa(log.OutputTokens),
+			strconv.FormatInt(stages.OrgLookupMs, 10),
+			strconv.FormatInt(stages.SettingsMs, 10),
+			strconv.FormatInt(stages.ConversationMs, 10),
+			strconv.FormatInt(stages.UploadMs, 10),
+			strconv.FormatInt(stages.FirstByteMs, 10),
+			strconv.FormatInt(stages.FirstTokenMs, 10),
+			strconv.FormatInt(stages.StreamMs, 10),
+			log.RequestID,
+		})
+		return writeErr == nil
+	})
+	writer.Flush()
+	if writeErr != nil {
+		return writeErr
+	}
+	return writer.Error()
+}
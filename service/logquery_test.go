@@ -0,0 +1,122 @@
+package service
+
+import (
+	"bytes"
+	"claude2api/config"
+	"claude2api/logger"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestParseLogFilterReadsQuery(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/admin-api/logs?start=1783670400&end=2026-07-11T00:00:00Z&session_idx=2&success=false&streaming=true&min_duration_ms=1500&client_key=sk-client-key-1234&q=timeout", nil)
+
+	filter, err := parseLogFilter(c)
+	if err != nil {
+		t.Fatalf("parse filter: %v", err)
+	}
+	if !filter.Start.Equal(time.Unix(1783670400, 0)) || filter.End.Format(time.RFC3339) != "2026-07-11T00:00:00Z" {
+		t.Fatalf("unexpected time range: %s - %s", filter.Start, filter.End)
+	}
+	if *filter.SessionIdx != 2 || *filter.Success || !*filter.Streaming || filter.MinDuration != 1500 || filter.Search != "timeout" {
+		t.Fatalf("unexpected filter: %+v", filter)
+	}
+	if filter.ClientKey != "sk-c...1234" {
+		t.Fatalf("expected full client key to be masked, got %q", filter.ClientKey)
+	}
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/admin-api/logs?success=maybe", nil)
+	if _, err := parseLogFilter(c); err == nil {
+		t.Fatal("expected invalid success flag to be rejected")
+	}
+}
+
+func TestWriteLogExportCSVAndJSONL(t *testing.T) {
+	logs := []logger.RequestLog{
+		{Timestamp: time.Date(2026, 7, 10, 8, 0, 0, 0, time.UTC), Model: "claude-sonnet-4-6", Success: true},
+		{Timestamp: time.Date(2026, 7, 10, 8, 1, 0, 0, time.UTC), Error: "upstream said \"no\", retry", SessionIdx: 1},
+	}
+	each := func(fn func(logger.RequestLog) bool) {
+		for _, log := range logs {
+			if !fn(log) {
+				return
+			}
+		}
+	}
+
+	var csvOut bytes.Buffer
+	if err := writeLogExport(&csvOut, "csv", each); err != nil {
+		t.Fatalf("csv export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(csvOut.String()), "\n")
+	if len(lines) != 3 || !strings.HasPrefix(lines[0], "timestamp,method,path,model") {
+		t.Fatalf("unexpected csv export: %q", csvOut.String())
+	}
+	if !strings.Contains(lines[2], `"upstream said ""no"", retry"`) {
+		t.Fatalf("expected error text to be quoted, got %q", lines[2])
+	}
+
+	var jsonlOut bytes.Buffer
+	if err := writeLogExport(&jsonlOut, "jsonl", each); err != nil {
+		t.Fatalf("jsonl export: %v", err)
+	}
+	if got := strings.Count(jsonlOut.String(), "\n"); got != 2 {
+		t.Fatalf("expected one JSON line per log, got %d", got)
+	}
+}
+
+func TestParseSeriesQueryDefaultsAndLimits(t *testing.T) {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/admin-api/stats/timeseries?window=5000&session_idx=1", nil)
+
+	window, step, filter, err := parseSeriesQuery(c)
+	if err != nil {
+		t.Fatalf("parse series query: %v", err)
+	}
+	if window != 24*time.Hour || step != 15*time.Minute {
+		t.Fatalf("unexpected window %s / step %s", window, step)
+	}
+	if filter.SessionIdx == nil || *filter.SessionIdx != 1 {
+		t.Fatalf("unexpected filter: %+v", filter)
+	}
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/admin-api/stats/timeseries?model=claude-sonnet-4-6&client_key=sk-client-key-1234", nil)
+	if _, _, _, err := parseSeriesQuery(c); err == nil {
+		t.Fatal("expected combined dimensions to be rejected")
+	}
+
+	c, _ = gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/admin-api/stats/timeseries?step=0", nil)
+	if _, _, _, err := parseSeriesQuery(c); err == nil {
+		t.Fatal("expected zero step to be rejected")
+	}
+}
+
+func TestSetDiagnosticHeaderIsOptIn(t *testing.T) {
+	previous := config.ConfigInstance
+	config.ConfigInstance = &config.Config{}
+	defer func() { config.ConfigInstance = previous }()
+
+	w := httptest.NewRecorder()
+	c, _ := gin.CreateTestContext(w)
+	config.ConfigInstance.DiagnosticHeaders = false
+	setDiagnosticHeader(c, diagnosticSessionHeader, "S1 / sk-a...1111")
+	if w.Header().Get(diagnosticSessionHeader) != "" {
+		t.Fatal("expected no diagnostic header when disabled")
+	}
+
+	config.ConfigInstance.DiagnosticHeaders = true
+	setDiagnosticHeader(c, diagnosticSessionHeader, "S1 / sk-a...1111")
+	setDiagnosticHeader(c, diagnosticAttemptsHeader, "2")
+	if w.Header().Get(diagnosticSessionHeader) != "S1 / sk-a...1111" || w.Header().Get(diagnosticAttemptsHeader) != "2" {
+		t.Fatalf("unexpected diagnostic headers: %v", w.Header())
+	}
+}
@@ -0,0 +1,42 @@
+package service
+
+import (
+	"claude2api/config"
+	"claude2api/logger"
+	"fmt"
+	"time"
+)
+
+// ConfigureRequestLogStorage attaches (or detaches) the durable request log store
+// according to the current config, closing the previous store.
+func ConfigureRequestLogStorage() error {
+	settings := config.NormalizeRequestLogStorage(config.ConfigInstance.RequestLogStorage)
+	var sink logger.LogSink
+	if settings.Enabled {
+		jsonlSink, err := logger.OpenJSONLSink(
+			settings.Dir,
+			int64(settings.MaxSizeMB)*1024*1024,
+			time.Duration(settings.MaxAgeDays)*24*time.Hour,
+		)
+		if err != nil {
+			return err
+		}
+		sink = jsonlSink
+		logger.Info(fmt.Sprintf("Request logs are stored in %s (%d entries)", settings.Dir, jsonlSink.Count()))
+	}
+	if previous := logger.GlobalRequestLogger.SetSink(sink); previous != nil {
+		if err := previous.Close(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to close request log storage: %v", err))
+		}
+	}
+	return nil
+}
+
+// CloseRequestLogStorage flushes and detaches the durable request log store on shutdown.
+func CloseRequestLogStorage() {
+	if sink := logger.GlobalRequestLogger.SetSink(nil); sink != nil {
+		if err := sink.Close(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to close request log storage: %v", err))
+		}
+	}
+}
@@ -0,0 +1,24 @@
+package service
+
+import (
+	"claude2api/config"
+	"claude2api/logger"
+	"claude2api/metrics"
+	"fmt"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// MetricsHandler serves Prometheus metrics when they are enabled.
+func MetricsHandler(c *gin.Context) {
+	if !config.ConfigInstance.Metrics.Enabled {
+		c.JSON(http.StatusNotFound, ErrorResponse{Error: "Metrics are not enabled"})
+		return
+	}
+	c.Header("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	c.Status(http.StatusOK)
+	if err := metrics.Default.WriteText(c.Writer); err != nil {
+		logger.Error(fmt.Sprintf("Failed to write metrics: %v", err))
+	}
+}
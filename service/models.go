@@ -16,11 +16,14 @@ type ResolvedModel struct {
 	Visible              bool   `json:"visible"`
 	SystemPromptOverride string `json:"system_prompt_override,omitempty"`
 	PromptOverrideMode   string `json:"prompt_override_mode,omitempty"`
+	SessionStrategy      string `json:"session_strategy,omitempty"`
 	Notes                string `json:"notes,omitempty"`
 	VariantOf            string `json:"variant_of,omitempty"`
 	VariantType          string `json:"variant_type,omitempty"`
 	EffortLevel          string `json:"effort_level,omitempty"`
 	Source               string `json:"source"`
+	// Upstream is the model's override of the global upstream settings, if any.
+	Upstream *config.UpstreamConfig `json:"upstream,omitempty"`
 }
 
 type ResolvedModelSelection struct {
@@ -35,6 +38,8 @@ type ResolvedModelSelection struct {
 	RemoveModelField     bool
 	SystemPromptOverride string
 	PromptOverrideMode   string
+	SessionStrategy      string
+	Upstream             config.UpstreamConfig
 }
 
 var supportedEffortLevels = []string{"low", "medium", "high", "max"}
@@ -243,6 +248,8 @@ func ResolveModel(requested string) ResolvedModelSelection {
 		RemoveModelField:     shouldRemoveModelField(selected.UpstreamID),
 		SystemPromptOverride: selected.SystemPromptOverride,
 		PromptOverrideMode:   normalizePromptMode(selected.PromptOverrideMode),
+		SessionStrategy:      selected.SessionStrategy,
+		Upstream:             config.MergeUpstream(config.ConfigInstance.Upstream, selected.Upstream),
 	}
 }
 
@@ -295,7 +302,9 @@ func GetAdminModelSummaries() []map[string]interface{} {
 			"has_system_prompt":      strings.TrimSpace(item.SystemPromptOverride) != "",
 			"prompt_override_mode":   item.PromptOverrideMode,
 			"system_prompt_override": item.SystemPromptOverride,
+			"session_strategy":       item.SessionStrategy,
 			"notes":                  item.Notes,
+			"upstream":               item.Upstream,
 		})
 	}
 	return result
@@ -334,11 +343,13 @@ func buildResolvedModel(item config.ModelDefinition, thinking bool, effortLevel
 		Visible:              item.Visible,
 		SystemPromptOverride: item.SystemPromptOverride,
 		PromptOverrideMode:   normalizePromptMode(item.PromptOverrideMode),
+		SessionStrategy:      item.SessionStrategy,
 		Notes:                item.Notes,
 		VariantOf:            variantOf,
 		VariantType:          variantType,
 		EffortLevel:          effortLevel,
 		Source:               "config",
+		Upstream:             item.Upstream,
 	}
 }
 
@@ -350,6 +361,10 @@ func normalizeModelDefinition(item config.ModelDefinition) config.ModelDefinitio
 	item.Notes = strings.TrimSpace(item.Notes)
 	item.SystemPromptOverride = strings.TrimSpace(item.SystemPromptOverride)
 	item.PromptOverrideMode = normalizePromptMode(item.PromptOverrideMode)
+	if strings.TrimSpace(item.SessionStrategy) != "" {
+		item.SessionStrategy = config.NormalizeSessionStrategy(item.SessionStrategy)
+	}
+	item.Upstream = config.NormalizeUpstreamOverride(item.Upstream)
 
 	if item.UpstreamID == "" {
 		item.UpstreamID = item.PublicID
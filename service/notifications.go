@@ -0,0 +1,56 @@
+package service
+
+import (
+	"claude2api/config"
+	"claude2api/notify"
+	"fmt"
+	"time"
+)
+
+func sessionEventLabel(index int, sessionKey string) string {
+	if index < 0 {
+		return maskSessionKey(sessionKey)
+	}
+	return fmt.Sprintf("S%d / %s", index+1, maskSessionKey(sessionKey))
+}
+
+func notifySessionQuarantined(index int, sessionKey string, until time.Time, message string) {
+	notify.Publish(notify.Event{
+		Type:     config.NotifyEventSessionQuarantined,
+		Title:    "Session quarantined after authentication failures",
+		Message:  message,
+		Session:  sessionEventLabel(index, sessionKey),
+		ResetAt:  until,
+		DedupKey: maskSessionKey(sessionKey),
+	})
+}
+
+func notifyCooldownSet(index int, sessionKey string, until time.Time, reason string) {
+	notify.Publish(notify.Event{
+		Type:     config.NotifyEventCooldownSet,
+		Title:    "Session cooling down until Claude official reset",
+		Message:  reason,
+		Session:  sessionEventLabel(index, sessionKey),
+		ResetAt:  until,
+		DedupKey: maskSessionKey(sessionKey),
+	})
+}
+
+func notifyPoolExhausted(reason string, earliest time.Time) {
+	notify.Publish(notify.Event{
+		Type:    config.NotifyEventPoolExhausted,
+		Title:   "No dispatchable Claude session",
+		Message: reason,
+		ResetAt: earliest,
+	})
+}
+
+func notifySessionRecovered(index int, sessionKey string) {
+	notify.Publish(notify.Event{
+		Type:     config.NotifyEventProberRecovery,
+		Title:    "Session recovered",
+		Message:  "Background health probe succeeded again",
+		Session:  sessionEventLabel(index, sessionKey),
+		DedupKey: maskSessionKey(sessionKey),
+	})
+}
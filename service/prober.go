@@ -0,0 +1,170 @@
+package service
+
+import (
+	"claude2api/config"
+	"claude2api/core"
+	"claude2api/logger"
+	"claude2api/metrics"
+	"context"
+	"fmt"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// healthProbePath labels completion probes in the request log.
+const healthProbePath = "/internal/health-probe"
+
+// delay between two sessions of one probe cycle, so a cycle is not a burst.
+const sessionProbeSpacing = 2 * time.Second
+
+// sessionProbeResult is what one probe learned about a session.
+type sessionProbeResult struct {
+	Err   error
+	OrgID string
+}
+
+type sessionProbeFunc func(session config.SessionInfo, index int, settings config.HealthProbeConfig) sessionProbeResult
+
+// StartSessionProber runs the background health prober until ctx is cancelled. Settings
+// are re-read every cycle, so enabling it from the admin panel takes effect without restart.
+func StartSessionProber(ctx context.Context) {
+	go func() {
+		for {
+			settings := config.NormalizeHealthProbe(config.ConfigInstance.HealthProbe)
+			if !sleepContext(ctx, nextProbeDelay(settings, rand.Intn)) {
+				return
+			}
+			settings = config.NormalizeHealthProbe(config.ConfigInstance.HealthProbe)
+			if !settings.Enabled {
+				continue
+			}
+			runSessionProbeCycle(ctx, settings, probeSession, saveConfigToYAML, sessionProbeSpacing)
+		}
+	}()
+}
+
+// nextProbeDelay is the interval plus a random jitter in [0, jitter].
+func nextProbeDelay(settings config.HealthProbeConfig, intn func(n int) int) time.Duration {
+	delay := time.Duration(settings.IntervalSeconds) * time.Second
+	if settings.JitterSeconds > 0 {
+		delay += time.Duration(intn(settings.JitterSeconds+1)) * time.Second
+	}
+	return delay
+}
+
+func sleepContext(ctx context.Context, delay time.Duration) bool {
+	if delay <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(delay)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+// runSessionProbeCycle probes every configured session once and records the outcome.
+// save persists the config when a probe refreshed an org ID.
+func runSessionProbeCycle(ctx context.Context, settings config.HealthProbeConfig, probe sessionProbeFunc, save func() error, spacing time.Duration) {
+	config.ConfigInstance.RwMutx.RLock()
+	sessions := append([]config.SessionInfo(nil), config.ConfigInstance.Sessions...)
+	config.ConfigInstance.RwMutx.RUnlock()
+	orgChanged := false
+	for index, session := range sessions {
+		if strings.TrimSpace(session.SessionKey) == "" {
+			continue
+		}
+		if index > 0 && !sleepContext(ctx, spacing) {
+			return
+		}
+
+		startedAt := time.Now()
+		result := probe(session, index, settings)
+		now := time.Now()
+		if result.Err != nil {
+			message := core.GetErrorMessage(result.Err)
+			config.ConfigInstance.RecordSessionHealth(session.SessionKey, false, now.Sub(startedAt), message, now)
+			logger.Error(fmt.Sprintf("Health probe failed for session %d (%s): %s", index+1, maskSessionKey(session.SessionKey), message))
+			if core.IsAuthError(result.Err) {
+				if until, quarantined := config.ConfigInstance.RecordSessionAuthFailure(session.SessionKey, message, now); quarantined {
+					notifySessionQuarantined(index, session.SessionKey, until, message)
+				}
+			}
+			continue
+		}
+
+		recovered := config.ConfigInstance.RecordSessionHealth(session.SessionKey, true, now.Sub(startedAt), "", now)
+		config.ConfigInstance.ResetSessionBreaker(session.SessionKey)
+		if recovered {
+			logger.Info(fmt.Sprintf("Health probe: session %d (%s) recovered", index+1, maskSessionKey(session.SessionKey)))
+			notifySessionRecovered(index, session.SessionKey)
+		}
+		if result.OrgID != "" && result.OrgID != session.OrgID {
+			logger.Info(fmt.Sprintf("Health probe refreshed stale org ID for session %d (%s)", index+1, maskSessionKey(session.SessionKey)))
+			config.ConfigInstance.SetSessionOrgID(session.SessionKey, result.OrgID, logger.WithFields(nil))
+			orgChanged = true
+		}
+	}
+	if orgChanged {
+		if err := save(); err != nil {
+			logger.Error(fmt.Sprintf("Failed to save refreshed org IDs: %v", err))
+		}
+	}
+}
+
+// probeSession checks a session with the organizations lookup, which costs no message
+// quota, and in completion mode also sends a one-line chat with the probe model.
+func probeSession(session config.SessionInfo, index int, settings config.HealthProbeConfig) sessionProbeResult {
+	client := core.NewClientFromSession(session, config.ConfigInstance.Proxy, "",
+		core.WithUpstreamStatusHandler(metrics.ObserveUpstreamStatus),
+		upstreamClientOption(config.ConfigInstance.Upstream),
+		core.WithClientPool(clientPool),
+	)
+	orgs, err := client.GetOrganizations()
+	if err != nil {
+		return sessionProbeResult{Err: err}
+	}
+	orgID := currentOrgID(session.OrgID, orgs)
+	if orgID == "" {
+		if orgID, err = core.SelectOrgID(orgs); err != nil {
+			return sessionProbeResult{Err: err}
+		}
+	}
+	if settings.Mode != config.HealthProbeModeCompletion {
+		return sessionProbeResult{OrgID: orgID}
+	}
+
+	session.OrgID = orgID
+	startTime := time.Now()
+	log := logger.WithFields(nil).WithField("session_label", fmt.Sprintf("S%d", index+1))
+	result, err := runSessionTestCompletion(context.Background(), session, index, settings.Model, log)
+	errMsg := ""
+	if err != nil {
+		errMsg = err.Error()
+	}
+	// Completion probes spend quota, so they show up in the request log like admin tests.
+	entry := newRequestLog(result.UpstreamModel, index, result.InputTokens, result.OutputTokens, err == nil, startTime, errMsg)
+	entry.Method = http.MethodPost
+	entry.Path = healthProbePath
+	entry.ContextCount = 1
+	recordRequestLog(entry)
+	if err != nil {
+		return sessionProbeResult{Err: fmt.Errorf("OpenAI request test failed: %s", errMsg), OrgID: orgID}
+	}
+	return sessionProbeResult{OrgID: orgID}
+}
+
+// currentOrgID keeps the configured org ID while the session still belongs to it.
+func currentOrgID(orgID string, orgs []core.Organization) string {
+	for _, org := range orgs {
+		if orgID != "" && org.UUID == orgID {
+			return orgID
+		}
+	}
+	return ""
+}
@@ -0,0 +1,116 @@
+package service
+
+import (
+	"claude2api/config"
+	"claude2api/core"
+	"claude2api/fakeupstream"
+	"claude2api/logger"
+	"context"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func useProbeTestConfig(t *testing.T, sessions ...config.SessionInfo) *config.Config {
+	t.Helper()
+	previous := config.ConfigInstance
+	cfg := &config.Config{
+		Sessions:             sessions,
+		MaxConcurrentPerKey:  1,
+		MaxGlobalConcurrency: 10,
+	}
+	config.ConfigInstance = cfg
+	t.Cleanup(func() {
+		config.ConfigInstance = previous
+	})
+	return cfg
+}
+
+func TestNextProbeDelayAddsJitter(t *testing.T) {
+	settings := config.NormalizeHealthProbe(config.HealthProbeConfig{IntervalSeconds: 120, JitterSeconds: 30})
+	delay := nextProbeDelay(settings, func(n int) int {
+		if n != 31 {
+			t.Fatalf("expected jitter range 0..30, got n=%d", n)
+		}
+		return 30
+	})
+	if delay != 150*time.Second {
+		t.Fatalf("expected 150s, got %s", delay)
+	}
+}
+
+func TestRunSessionProbeCycleRecordsHealth(t *testing.T) {
+	cfg := useProbeTestConfig(t,
+		config.SessionInfo{SessionKey: "sk-live", OrgID: "org-old"},
+		config.SessionInfo{SessionKey: "sk-dead", OrgID: "org-dead"},
+	)
+	cfg.CircuitBreaker = config.CircuitBreakerConfig{FailureThreshold: 1}
+	now := time.Now()
+	cfg.RecordSessionHealth("sk-live", false, 0, "timeout", now.Add(-time.Hour))
+
+	probe := func(session config.SessionInfo, index int, settings config.HealthProbeConfig) sessionProbeResult {
+		if session.SessionKey == "sk-dead" {
+			return sessionProbeResult{Err: core.NewAuthAPIError("failed to get organizations: unauthorized status code 401")}
+		}
+		return sessionProbeResult{OrgID: "org-new"}
+	}
+	saves := 0
+	save := func() error {
+		saves++
+		return nil
+	}
+	runSessionProbeCycle(context.Background(), config.NormalizeHealthProbe(config.HealthProbeConfig{Enabled: true}), probe, save, 0)
+
+	live := cfg.GetSessionHealthByIndex(0)
+	if live.Status != config.SessionHealthHealthy || live.LastHealthyAt.IsZero() {
+		t.Fatalf("expected live session to be healthy, got %+v", live)
+	}
+	if cfg.Sessions[0].OrgID != "org-new" || saves != 1 {
+		t.Fatalf("expected stale org ID to be refreshed and saved once, got %q (%d saves)", cfg.Sessions[0].OrgID, saves)
+	}
+
+	dead := cfg.GetSessionHealthByIndex(1)
+	if dead.Status != config.SessionHealthUnhealthy || dead.ConsecutiveFailures != 1 || dead.LastError == "" {
+		t.Fatalf("expected dead session to be unhealthy, got %+v", dead)
+	}
+	if _, _, _, status, _ := cfg.GetSessionDispatchSnapshot(1, time.Now()); status != "quarantined" {
+		t.Fatalf("expected auth failure from the probe to quarantine the session, got %s", status)
+	}
+}
+
+func TestCompletionProbeChatsWithoutAnHTTPRequest(t *testing.T) {
+	fake := fakeupstream.New(fakeupstream.Options{Scripts: map[string][]string{
+		"sk-ok":     {fakeupstream.ScenarioText},
+		"sk-broken": {fakeupstream.ScenarioStreamError},
+	}})
+	server := httptest.NewServer(fake)
+	defer server.Close()
+	cfg := useProbeTestConfig(t, config.SessionInfo{SessionKey: "sk-ok"}, config.SessionInfo{SessionKey: "sk-broken"})
+	cfg.MaxChatHistoryLength = 100000
+	cfg.Upstream = config.UpstreamConfig{BaseURL: server.URL, TimeoutSeconds: 5, ResponseHeaderTimeoutSeconds: 5}
+	settings := config.NormalizeHealthProbe(config.HealthProbeConfig{Enabled: true, Mode: config.HealthProbeModeCompletion})
+
+	if result := probeSession(cfg.Sessions[0], 0, settings); result.Err != nil || result.OrgID == "" {
+		t.Fatalf("expected the completion probe to pass, got %+v", result)
+	}
+	if logs := logger.GlobalRequestLogger.GetRecentLogs(1); len(logs) != 1 || logs[0].Path != healthProbePath || !logs[0].Success {
+		t.Fatalf("expected the probe in the request log, got %+v", logs)
+	}
+	if result := probeSession(cfg.Sessions[1], 1, settings); result.Err == nil || !strings.Contains(result.Err.Error(), "overloaded_error") {
+		t.Fatalf("expected the stream error to fail the probe, got %+v", result)
+	}
+	if stats := fake.Stats(); stats.Completions != 2 {
+		t.Fatalf("expected one completion per probe, got %+v", stats)
+	}
+}
+
+func TestCurrentOrgIDDetectsStaleOrg(t *testing.T) {
+	orgs := []core.Organization{{UUID: "org-a"}, {UUID: "org-b"}}
+	if got := currentOrgID("org-b", orgs); got != "org-b" {
+		t.Fatalf("expected configured org to be kept, got %q", got)
+	}
+	if got := currentOrgID("org-gone", orgs); got != "" {
+		t.Fatalf("expected missing org to be reported stale, got %q", got)
+	}
+}
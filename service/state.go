@@ -0,0 +1,54 @@
+package service
+
+import (
+	"claude2api/config"
+	"claude2api/logger"
+	"context"
+	"fmt"
+	"time"
+)
+
+// RestoreRuntimeState reloads cooldowns, quotas, breakers and session statistics
+// saved by a previous run. It should run once before the server accepts requests.
+func RestoreRuntimeState() {
+	settings := config.NormalizeRuntimeState(config.ConfigInstance.RuntimeState)
+	if settings.Disabled {
+		return
+	}
+	state, err := config.ReadRuntimeState(settings.Path)
+	if err != nil {
+		logger.Error(fmt.Sprintf("Failed to read runtime state from %s: %v", settings.Path, err))
+		return
+	}
+	restored, stats := config.ConfigInstance.ImportRuntimeState(state, time.Now())
+	logger.GlobalRequestLogger.RestoreSessionStats(stats)
+	if restored > 0 {
+		logger.Info(fmt.Sprintf("Restored runtime state for %d sessions from %s", restored, settings.Path))
+	}
+}
+
+// SaveRuntimeState writes the current runtime state to the state file.
+func SaveRuntimeState() error {
+	settings := config.NormalizeRuntimeState(config.ConfigInstance.RuntimeState)
+	if settings.Disabled {
+		return nil
+	}
+	state := config.ConfigInstance.ExportRuntimeState(logger.GlobalRequestLogger.ExportSessionStats(), time.Now())
+	return config.WriteRuntimeState(settings.Path, state)
+}
+
+// StartRuntimeStatePersister saves the runtime state every saveIntervalSeconds
+// until ctx is cancelled. The final save on shutdown is left to the caller.
+func StartRuntimeStatePersister(ctx context.Context) {
+	go func() {
+		for {
+			settings := config.NormalizeRuntimeState(config.ConfigInstance.RuntimeState)
+			if !sleepContext(ctx, time.Duration(settings.SaveIntervalSeconds)*time.Second) {
+				return
+			}
+			if err := SaveRuntimeState(); err != nil {
+				logger.Error(fmt.Sprintf("Failed to save runtime state: %v", err))
+			}
+		}
+	}()
+}
@@ -0,0 +1,47 @@
+package service
+
+import (
+	"claude2api/core"
+	"claude2api/logger"
+	"claude2api/tracing"
+	"context"
+
+	"github.com/gin-gonic/gin"
+)
+
+const attemptContextKey = "trace_attempt_ctx"
+
+// startAttemptSpan traces one session attempt of a chat request. Upstream calls made
+// while handling the attempt are recorded as its children.
+func startAttemptSpan(c *gin.Context, index int, sessionKey string, model string, attempt int) *tracing.Span {
+	ctx, span := tracing.Start(c.Request.Context(), "session.attempt")
+	span.SetAttribute("session", sessionEventLabel(index, sessionKey))
+	span.SetAttribute("model", model)
+	span.SetAttribute("attempt", attempt)
+	c.Set(attemptContextKey, ctx)
+	return span
+}
+
+// traceContext returns the context of the current session attempt, falling back to the
+// request context.
+func traceContext(c *gin.Context) context.Context {
+	if value, ok := c.Get(attemptContextKey); ok {
+		if ctx, ok := value.(context.Context); ok {
+			return ctx
+		}
+	}
+	if c.Request != nil {
+		return c.Request.Context()
+	}
+	return context.Background()
+}
+
+// endAttemptSpan finishes an attempt span, recording the failure if there was one.
+func endAttemptSpan(c *gin.Context, span *tracing.Span, err error) {
+	if err != nil {
+		span.RecordError(err)
+		span.SetAttribute("error_type", logger.ClassifyErrorType(core.GetErrorMessage(err)))
+	}
+	span.End()
+	c.Set(attemptContextKey, nil)
+}
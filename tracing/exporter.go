@@ -0,0 +1,251 @@
+package tracing
+
+import (
+	"bytes"
+	"claude2api/config"
+	"claude2api/logger"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	otlpBatchSize     = 64
+	otlpFlushInterval = 2 * time.Second
+)
+
+// Configure installs a global tracer for the settings, or removes it when tracing is
+// disabled, shutting the previous exporter down.
+func Configure(settings config.TracingConfig) error {
+	settings = config.NormalizeTracing(settings)
+	var tracer *Tracer
+	if settings.Enabled {
+		exporter, err := newExporter(settings)
+		if err != nil {
+			return err
+		}
+		tracer = NewTracer(settings.ServiceName, exporter)
+	}
+	if previous := SetGlobalTracer(tracer); previous != nil {
+		return previous.Shutdown()
+	}
+	return nil
+}
+
+func newExporter(settings config.TracingConfig) (Exporter, error) {
+	switch settings.Exporter {
+	case config.TracingExporterFile:
+		file, err := os.OpenFile(settings.FilePath, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0644)
+		if err != nil {
+			return nil, err
+		}
+		return NewWriterExporter(file), nil
+	case config.TracingExporterOTLP:
+		return NewOTLPExporter(settings.Endpoint, settings.ServiceName), nil
+	default:
+		return NewWriterExporter(nopCloser{os.Stdout}), nil
+	}
+}
+
+type nopCloser struct {
+	io.Writer
+}
+
+func (nopCloser) Close() error { return nil }
+
+// WriterExporter writes one JSON span per line.
+type WriterExporter struct {
+	mu     sync.Mutex
+	writer io.WriteCloser
+}
+
+func NewWriterExporter(writer io.WriteCloser) *WriterExporter {
+	return &WriterExporter{writer: writer}
+}
+
+func (e *WriterExporter) Export(spans []SpanData) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	encoder := json.NewEncoder(e.writer)
+	for _, span := range spans {
+		if err := encoder.Encode(span); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (e *WriterExporter) Shutdown() error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.writer.Close()
+}
+
+// OTLPExporter batches spans and posts them to an OTLP/HTTP JSON endpoint.
+type OTLPExporter struct {
+	endpoint string
+	service  string
+	client   *http.Client
+	spans    chan SpanData
+	done     chan struct{}
+
+	// mu guards closed, so spans ending after Shutdown are dropped instead of
+	// being sent on the closed channel.
+	mu     sync.RWMutex
+	closed bool
+}
+
+func NewOTLPExporter(endpoint, service string) *OTLPExporter {
+	e := &OTLPExporter{
+		endpoint: endpoint,
+		service:  service,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		spans:    make(chan SpanData, 1024),
+		done:     make(chan struct{}),
+	}
+	go e.run()
+	return e
+}
+
+// Export queues spans without blocking; spans are dropped when the queue is full.
+func (e *OTLPExporter) Export(spans []SpanData) error {
+	e.mu.RLock()
+	defer e.mu.RUnlock()
+	if e.closed {
+		return fmt.Errorf("otlp exporter is shut down")
+	}
+	for _, span := range spans {
+		select {
+		case e.spans <- span:
+		default:
+			return fmt.Errorf("otlp span queue is full")
+		}
+	}
+	return nil
+}
+
+// Shutdown flushes queued spans and stops the exporter.
+func (e *OTLPExporter) Shutdown() error {
+	e.mu.Lock()
+	if e.closed {
+		e.mu.Unlock()
+		return nil
+	}
+	e.closed = true
+	close(e.spans)
+	e.mu.Unlock()
+	<-e.done
+	return nil
+}
+
+func (e *OTLPExporter) run() {
+	defer close(e.done)
+	ticker := time.NewTicker(otlpFlushInterval)
+	defer ticker.Stop()
+
+	batch := make([]SpanData, 0, otlpBatchSize)
+	flush := func() {
+		if len(batch) == 0 {
+			return
+		}
+		if err := e.post(batch); err != nil {
+			logger.Error(fmt.Sprintf("Failed to export %d spans: %v", len(batch), err))
+		}
+		batch = batch[:0]
+	}
+	for {
+		select {
+		case span, ok := <-e.spans:
+			if !ok {
+				flush()
+				return
+			}
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		}
+	}
+}
+
+func (e *OTLPExporter) post(spans []SpanData) error {
+	body, err := json.Marshal(buildOTLPRequest(e.service, spans))
+	if err != nil {
+		return err
+	}
+	resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d", resp.StatusCode)
+	}
+	return nil
+}
+
+// buildOTLPRequest renders spans as an OTLP ExportTraceServiceRequest in JSON form.
+func buildOTLPRequest(service string, spans []SpanData) map[string]interface{} {
+	otlpSpans := make([]map[string]interface{}, 0, len(spans))
+	for _, span := range spans {
+		otlpSpan := map[string]interface{}{
+			"traceId":           span.TraceID,
+			"spanId":            span.SpanID,
+			"name":              span.Name,
+			"kind":              1,
+			"startTimeUnixNano": strconv.FormatInt(span.Start.UnixNano(), 10),
+			"endTimeUnixNano":   strconv.FormatInt(span.End.UnixNano(), 10),
+			"attributes":        otlpAttributes(span.Attributes),
+		}
+		if span.ParentID != "" {
+			otlpSpan["parentSpanId"] = span.ParentID
+		}
+		if span.Error != "" {
+			otlpSpan["status"] = map[string]interface{}{"code": 2, "message": span.Error}
+		}
+		otlpSpans = append(otlpSpans, otlpSpan)
+	}
+	return map[string]interface{}{
+		"resourceSpans": []interface{}{
+			map[string]interface{}{
+				"resource": map[string]interface{}{
+					"attributes": otlpAttributes(map[string]interface{}{"service.name": service}),
+				},
+				"scopeSpans": []interface{}{
+					map[string]interface{}{
+						"scope": map[string]interface{}{"name": "claude2api"},
+						"spans": otlpSpans,
+					},
+				},
+			},
+		},
+	}
+}
+
+func otlpAttributes(attributes map[string]interface{}) []map[string]interface{} {
+	result := make([]map[string]interface{}, 0, len(attributes))
+	for key, value := range attributes {
+		var otlpValue map[string]interface{}
+		switch v := value.(type) {
+		case bool:
+			otlpValue = map[string]interface{}{"boolValue": v}
+		case int:
+			otlpValue = map[string]interface{}{"intValue": strconv.Itoa(v)}
+		case int64:
+			otlpValue = map[string]interface{}{"intValue": strconv.FormatInt(v, 10)}
+		case float64:
+			otlpValue = map[string]interface{}{"doubleValue": v}
+		default:
+			otlpValue = map[string]interface{}{"stringValue": fmt.Sprint(v)}
+		}
+		result = append(result, map[string]interface{}{"key": key, "value": otlpValue})
+	}
+	return result
+}
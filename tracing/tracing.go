@@ -0,0 +1,213 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"strings"
+	"sync"
+	"time"
+)
+
+type contextKey struct{}
+
+// SpanData is a finished span as handed to exporters.
+type SpanData struct {
+	TraceID    string                 `json:"trace_id"`
+	SpanID     string                 `json:"span_id"`
+	ParentID   string                 `json:"parent_span_id,omitempty"`
+	Name       string                 `json:"name"`
+	Service    string                 `json:"service"`
+	Start      time.Time              `json:"start"`
+	End        time.Time              `json:"end"`
+	DurationMs float64                `json:"duration_ms"`
+	Attributes map[string]interface{} `json:"attributes,omitempty"`
+	Error      string                 `json:"error,omitempty"`
+}
+
+// Span is an in-progress span. A nil *Span is valid and records nothing, so call
+// sites do not need to check whether tracing is enabled.
+type Span struct {
+	tracer *Tracer
+	mu     sync.Mutex
+	data   SpanData
+	ended  bool
+}
+
+// Tracer creates spans and hands finished ones to its exporter.
+type Tracer struct {
+	service  string
+	exporter Exporter
+}
+
+// Exporter receives finished spans.
+type Exporter interface {
+	Export(spans []SpanData) error
+	Shutdown() error
+}
+
+var (
+	globalMu     sync.RWMutex
+	globalTracer *Tracer
+)
+
+// SetGlobalTracer installs the tracer used by Start; nil disables tracing. The
+// previous tracer is returned so the caller can shut its exporter down.
+func SetGlobalTracer(tracer *Tracer) *Tracer {
+	globalMu.Lock()
+	defer globalMu.Unlock()
+	previous := globalTracer
+	globalTracer = tracer
+	return previous
+}
+
+func NewTracer(service string, exporter Exporter) *Tracer {
+	return &Tracer{service: service, exporter: exporter}
+}
+
+// Shutdown flushes and closes the tracer's exporter.
+func (t *Tracer) Shutdown() error {
+	if t == nil || t.exporter == nil {
+		return nil
+	}
+	return t.exporter.Shutdown()
+}
+
+// Start begins a span as a child of the span in ctx, or of a remote parent extracted
+// from a traceparent header, and returns a context carrying the new span.
+func Start(ctx context.Context, name string) (context.Context, *Span) {
+	globalMu.RLock()
+	tracer := globalTracer
+	globalMu.RUnlock()
+	if tracer == nil {
+		return ctx, nil
+	}
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	span := &Span{tracer: tracer, data: SpanData{
+		SpanID:  randomHex(8),
+		Name:    name,
+		Service: tracer.service,
+		Start:   time.Now(),
+	}}
+	if parent, ok := ctx.Value(contextKey{}).(*Span); ok && parent != nil {
+		span.data.TraceID = parent.data.TraceID
+		span.data.ParentID = parent.data.SpanID
+	} else if remote, ok := ctx.Value(remoteKey{}).(remoteParent); ok {
+		span.data.TraceID = remote.traceID
+		span.data.ParentID = remote.spanID
+	} else {
+		span.data.TraceID = randomHex(16)
+	}
+	return context.WithValue(ctx, contextKey{}, span), span
+}
+
+// FromContext returns the current span, or nil.
+func FromContext(ctx context.Context) *Span {
+	if ctx == nil {
+		return nil
+	}
+	span, _ := ctx.Value(contextKey{}).(*Span)
+	return span
+}
+
+func (s *Span) SetAttribute(key string, value interface{}) {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.data.Attributes == nil {
+		s.data.Attributes = make(map[string]interface{})
+	}
+	s.data.Attributes[key] = value
+}
+
+// RecordError marks the span as failed; a nil error is ignored.
+func (s *Span) RecordError(err error) {
+	if s == nil || err == nil {
+		return
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data.Error = err.Error()
+}
+
+// End finishes the span and exports it; later calls are ignored.
+func (s *Span) End() {
+	if s == nil {
+		return
+	}
+	s.mu.Lock()
+	if s.ended {
+		s.mu.Unlock()
+		return
+	}
+	s.ended = true
+	s.data.End = time.Now()
+	s.data.DurationMs = float64(s.data.End.Sub(s.data.Start).Microseconds()) / 1000
+	data := s.data
+	s.mu.Unlock()
+
+	if s.tracer.exporter != nil {
+		s.tracer.exporter.Export([]SpanData{data})
+	}
+}
+
+// TraceID returns the span's trace ID, or "" for a nil span.
+func (s *Span) TraceID() string {
+	if s == nil {
+		return ""
+	}
+	return s.data.TraceID
+}
+
+// Traceparent renders the W3C traceparent header for the span.
+func (s *Span) Traceparent() string {
+	if s == nil {
+		return ""
+	}
+	return "00-" + s.data.TraceID + "-" + s.data.SpanID + "-01"
+}
+
+type remoteKey struct{}
+
+type remoteParent struct {
+	traceID string
+	spanID  string
+}
+
+// ContextWithTraceparent returns ctx carrying the remote parent from a W3C
+// traceparent header; invalid headers are ignored.
+func ContextWithTraceparent(ctx context.Context, header string) context.Context {
+	traceID, spanID, ok := ParseTraceparent(header)
+	if !ok {
+		return ctx
+	}
+	return context.WithValue(ctx, remoteKey{}, remoteParent{traceID: traceID, spanID: spanID})
+}
+
+// ParseTraceparent validates a version 00 traceparent header.
+func ParseTraceparent(header string) (string, string, bool) {
+	parts := strings.Split(strings.TrimSpace(header), "-")
+	if len(parts) != 4 || parts[0] != "00" || len(parts[1]) != 32 || len(parts[2]) != 16 || len(parts[3]) != 2 {
+		return "", "", false
+	}
+	for _, part := range parts[1:] {
+		if _, err := hex.DecodeString(part); err != nil {
+			return "", "", false
+		}
+	}
+	if strings.Trim(parts[1], "0") == "" || strings.Trim(parts[2], "0") == "" {
+		return "", "", false
+	}
+	return strings.ToLower(parts[1]), strings.ToLower(parts[2]), true
+}
+
+func randomHex(n int) string {
+	buf := make([]byte, n)
+	rand.Read(buf)
+	return hex.EncodeToString(buf)
+}
@@ -0,0 +1,140 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type recordingExporter struct {
+	spans []SpanData
+}
+
+func (e *recordingExporter) Export(spans []SpanData) error {
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *recordingExporter) Shutdown() error { return nil }
+
+func TestParseTraceparent(t *testing.T) {
+	traceID, spanID, ok := ParseTraceparent("00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01")
+	if !ok || traceID != "4bf92f3577b34da6a3ce929d0e0e4736" || spanID != "00f067aa0ba902b7" {
+		t.Fatalf("unexpected parse result: %q %q %t", traceID, spanID, ok)
+	}
+	for _, header := range []string{
+		"",
+		"01-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473z-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+	} {
+		if _, _, ok := ParseTraceparent(header); ok {
+			t.Fatalf("expected %q to be rejected", header)
+		}
+	}
+}
+
+func TestStartLinksChildrenToRemoteParent(t *testing.T) {
+	exporter := &recordingExporter{}
+	previous := SetGlobalTracer(NewTracer("test", exporter))
+	defer SetGlobalTracer(previous)
+
+	ctx := ContextWithTraceparent(context.Background(), "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	ctx, root := Start(ctx, "GET /v1/chat/completions")
+	_, child := Start(ctx, "session.attempt")
+	child.SetAttribute("attempt", 1)
+	child.RecordError(io.EOF)
+	child.End()
+	child.End()
+	root.End()
+
+	if len(exporter.spans) != 2 {
+		t.Fatalf("expected 2 exported spans, got %d", len(exporter.spans))
+	}
+	childData, rootData := exporter.spans[0], exporter.spans[1]
+	if rootData.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" || rootData.ParentID != "00f067aa0ba902b7" {
+		t.Fatalf("root span did not continue the remote trace: %+v", rootData)
+	}
+	if childData.TraceID != rootData.TraceID || childData.ParentID != rootData.SpanID {
+		t.Fatalf("child span is not linked to root: %+v", childData)
+	}
+	if childData.Error != "EOF" || childData.Attributes["attempt"] != 1 {
+		t.Fatalf("unexpected child span data: %+v", childData)
+	}
+	if got := root.Traceparent(); got != "00-"+rootData.TraceID+"-"+rootData.SpanID+"-01" {
+		t.Fatalf("unexpected traceparent %q", got)
+	}
+}
+
+func TestStartWithoutTracerIsNoop(t *testing.T) {
+	previous := SetGlobalTracer(nil)
+	defer SetGlobalTracer(previous)
+
+	ctx, span := Start(context.Background(), "noop")
+	if span != nil || FromContext(ctx) != nil {
+		t.Fatal("expected no span without a tracer")
+	}
+	span.SetAttribute("key", "value")
+	span.RecordError(io.EOF)
+	span.End()
+}
+
+func TestWriterExporterWritesJSONLines(t *testing.T) {
+	var buf bytes.Buffer
+	exporter := NewWriterExporter(nopCloser{&buf})
+	if err := exporter.Export([]SpanData{{TraceID: "t1", SpanID: "s1", Name: "a"}, {TraceID: "t1", SpanID: "s2", Name: "b"}}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	lines := strings.Split(strings.TrimSpace(buf.String()), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %q", buf.String())
+	}
+	var span SpanData
+	if err := json.Unmarshal([]byte(lines[1]), &span); err != nil || span.Name != "b" {
+		t.Fatalf("unexpected line %q: %v", lines[1], err)
+	}
+}
+
+func TestOTLPExporterPostsBatchOnShutdown(t *testing.T) {
+	bodies := make(chan map[string]interface{}, 1)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var body map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&body)
+		bodies <- body
+	}))
+	defer server.Close()
+
+	exporter := NewOTLPExporter(server.URL, "claude2api")
+	if err := exporter.Export([]SpanData{{TraceID: "t1", SpanID: "s1", ParentID: "p1", Name: "claude.send_message", Attributes: map[string]interface{}{"stream": true}, Error: "boom"}}); err != nil {
+		t.Fatalf("export: %v", err)
+	}
+	if err := exporter.Shutdown(); err != nil {
+		t.Fatalf("shutdown: %v", err)
+	}
+	if err := exporter.Export([]SpanData{{Name: "late"}}); err == nil {
+		t.Fatal("expected export after shutdown to fail")
+	}
+
+	body := <-bodies
+	resourceSpans := body["resourceSpans"].([]interface{})
+	scopeSpans := resourceSpans[0].(map[string]interface{})["scopeSpans"].([]interface{})
+	spans := scopeSpans[0].(map[string]interface{})["spans"].([]interface{})
+	span := spans[0].(map[string]interface{})
+	if span["name"] != "claude.send_message" || span["parentSpanId"] != "p1" {
+		t.Fatalf("unexpected otlp span: %v", span)
+	}
+	if status := span["status"].(map[string]interface{}); status["message"] != "boom" {
+		t.Fatalf("unexpected otlp status: %v", status)
+	}
+	attribute := span["attributes"].([]interface{})[0].(map[string]interface{})
+	if attribute["key"] != "stream" || attribute["value"].(map[string]interface{})["boolValue"] != true {
+		t.Fatalf("unexpected otlp attribute: %v", attribute)
+	}
+}